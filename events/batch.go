@@ -0,0 +1,155 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+var ErrEventTooLarge = errors.New("encoded event exceeds the maximum batch size")
+
+// Batcher splits a list of cloud events into batches
+// that are capped by the number of events and by the
+// total size of the encoded events in each batch.
+type Batcher struct {
+	maxCount,
+	maxBytes int
+
+	encoder *PayloadEncoder
+}
+
+// BatchHandler publishes a batch of events. It
+// should return one result for each event in the
+// batch in the same order as the batch. The handler
+// owns the slices it is given and may retain them
+// i.e. to retry the batch asynchronously.
+type BatchHandler func(
+	batch []*cloudevents.Event,
+	dataPayloads []PublishDataInput,
+) ([]PublishEventResult, error)
+
+// Returns a batcher that creates batches of at most
+// 'maxCount' events whose encoded size is no more
+// than 'maxBytes'. A limit of 0 means no limit.
+func NewBatcher(maxCount, maxBytes int) *Batcher {
+	return &Batcher{
+		maxCount: maxCount,
+		maxBytes: maxBytes,
+	}
+}
+
+// Returns a copy of the batcher that encodes
+// events with the given encoder instead of
+// the default encoder.
+func (b *Batcher) WithEncoder(encoder *PayloadEncoder) *Batcher {
+	bb := *b
+	bb.encoder = encoder
+	return &bb
+}
+
+// Encodes the given events and invokes the handler
+// for each batch. The returned results have one
+// entry for each of the given events so they can be
+// passed to CreateCloudEventErrorList along with the
+// events. If a handler invocation fails then all
+// remaining events are flagged as failed and the
+// handler error is returned.
+func (b *Batcher) Publish(
+	cloudEvents []*cloudevents.Event,
+	handler BatchHandler,
+) ([]PublishEventResult, error) {
+
+	var (
+		err error
+
+		dataPayload *PublishDataInput
+		data        []byte
+	)
+
+	encoder := b.encoder
+	if encoder == nil {
+		encoder = getDefaultEncoder()
+	}
+	results := make([]PublishEventResult, len(cloudEvents))
+
+	// indexes, events and payloads of current batch
+	batchIndexes := []int{}
+	batchEvents := []*cloudevents.Event{}
+	batchPayloads := []PublishDataInput{}
+	batchBytes := 0
+
+	flush := func() error {
+		if len(batchIndexes) == 0 {
+			return nil
+		}
+		batchResults, err := handler(batchEvents, batchPayloads)
+		if err == nil && len(batchResults) != len(batchIndexes) {
+			err = fmt.Errorf(
+				"expected %d results for published batch but received %d",
+				len(batchIndexes), len(batchResults),
+			)
+		}
+		for i, index := range batchIndexes {
+			if err != nil {
+				results[index] = PublishEventResult{Error: err.Error()}
+			} else {
+				results[index] = batchResults[i]
+			}
+		}
+		// the next batch is collected in new slices
+		// as the handler may have retained these
+		batchIndexes = batchIndexes[:0]
+		batchEvents = nil
+		batchPayloads = nil
+		batchBytes = 0
+		return err
+	}
+
+	for i, event := range cloudEvents {
+		if dataPayload, err = encoder.Encode(event); err != nil {
+			results[i] = PublishEventResult{Error: err.Error()}
+			continue
+		}
+		if data, err = json.Marshal(dataPayload); err != nil {
+			results[i] = PublishEventResult{Error: err.Error()}
+			continue
+		}
+		// size of payload within a json array
+		size := len(data) + 1
+
+		if b.maxBytes > 0 && size > b.maxBytes {
+			logger.ErrorMessage(
+				"Batcher.Publish(): Event with id %s has an encoded size of %d bytes which exceeds the maximum batch size of %d bytes.",
+				event.Context.GetID(), size, b.maxBytes,
+			)
+			results[i] = PublishEventResult{Error: ErrEventTooLarge.Error()}
+			continue
+		}
+		if (b.maxCount > 0 && len(batchIndexes) == b.maxCount) ||
+			(b.maxBytes > 0 && batchBytes+size > b.maxBytes) {
+
+			if err = flush(); err != nil {
+				failRemaining(results, i, err)
+				return results, err
+			}
+		}
+		batchIndexes = append(batchIndexes, i)
+		batchEvents = append(batchEvents, event)
+		batchPayloads = append(batchPayloads, *dataPayload)
+		batchBytes += size
+	}
+	if err = flush(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func failRemaining(results []PublishEventResult, from int, err error) {
+	for i := from; i < len(results); i++ {
+		results[i] = PublishEventResult{Error: err.Error()}
+	}
+}
@@ -0,0 +1,153 @@
+package events_test
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batcher", func() {
+
+	var (
+		cloudEvents []*cloudevents.Event
+		payloadSize int
+	)
+
+	BeforeEach(func() {
+		cloudEvents = []*cloudevents.Event{}
+		for _, e := range testEvents {
+			event := cloudevents.NewEvent()
+			err := json.Unmarshal([]byte(e), &event)
+			Expect(err).NotTo(HaveOccurred())
+			cloudEvents = append(cloudEvents, &event)
+		}
+
+		dataPayload, err := events.NewPublishDataInput(cloudEvents[0])
+		Expect(err).NotTo(HaveOccurred())
+		data, err := json.Marshal(dataPayload)
+		Expect(err).NotTo(HaveOccurred())
+		payloadSize = len(data) + 1
+	})
+
+	It("splits events into batches by count", func() {
+
+		batchSizes := []int{}
+		results, err := events.NewBatcher(2, 0).Publish(cloudEvents,
+			func(batch []*cloudevents.Event, dataPayloads []events.PublishDataInput) ([]events.PublishEventResult, error) {
+				Expect(len(batch)).To(Equal(len(dataPayloads)))
+				batchSizes = append(batchSizes, len(batch))
+
+				results := make([]events.PublishEventResult, len(batch))
+				for i := range results {
+					results[i].Success = true
+				}
+				return results, nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batchSizes).To(Equal([]int{2, 2, 1}))
+		Expect(len(results)).To(Equal(len(cloudEvents)))
+		Expect(len(events.CreateCloudEventErrorList(results, cloudEvents))).To(Equal(0))
+	})
+
+	It("splits events into batches by size and maps results back to the events", func() {
+
+		published := []string{}
+		results, err := events.NewBatcher(0, payloadSize*3+payloadSize/2).Publish(cloudEvents,
+			func(batch []*cloudevents.Event, dataPayloads []events.PublishDataInput) ([]events.PublishEventResult, error) {
+				Expect(len(batch)).To(BeNumerically("<=", 3))
+
+				results := make([]events.PublishEventResult, len(batch))
+				for i, event := range batch {
+					published = append(published, event.ID())
+					// fail the 2nd event of each batch
+					results[i].Success = i != 1
+					if i == 1 {
+						results[i].Error = fmt.Sprintf("%s failed", event.ID())
+					}
+				}
+				return results, nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(published)).To(Equal(len(cloudEvents)))
+
+		errorList := events.CreateCloudEventErrorList(results, cloudEvents)
+		Expect(len(errorList)).To(Equal(2))
+		Expect(errorList[0].Event).To(Equal(cloudEvents[1]))
+		Expect(errorList[0].Error).To(Equal(cloudEvents[1].ID() + " failed"))
+		Expect(errorList[1].Event).To(Equal(cloudEvents[4]))
+	})
+
+	It("does not reuse the slices retained by the handler for later batches", func() {
+
+		retainedEvents := [][]*cloudevents.Event{}
+		retainedPayloads := [][]events.PublishDataInput{}
+		_, err := events.NewBatcher(2, 0).Publish(cloudEvents,
+			func(batch []*cloudevents.Event, dataPayloads []events.PublishDataInput) ([]events.PublishEventResult, error) {
+				retainedEvents = append(retainedEvents, batch)
+				retainedPayloads = append(retainedPayloads, dataPayloads)
+
+				results := make([]events.PublishEventResult, len(batch))
+				for i := range results {
+					results[i].Success = true
+				}
+				return results, nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(retainedEvents)).To(Equal(3))
+
+		i := 0
+		for b, batch := range retainedEvents {
+			Expect(len(retainedPayloads[b])).To(Equal(len(batch)))
+			for j, event := range batch {
+				Expect(event).To(Equal(cloudEvents[i]))
+				decoded, err := events.DecodePublishDataInput(&retainedPayloads[b][j])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(decoded.ID()).To(Equal(cloudEvents[i].ID()))
+				i++
+			}
+		}
+	})
+
+	It("fails events that are too large and all remaining events when a batch fails", func() {
+
+		calls := 0
+		results, err := events.NewBatcher(1, payloadSize/2).Publish(cloudEvents,
+			func(batch []*cloudevents.Event, dataPayloads []events.PublishDataInput) ([]events.PublishEventResult, error) {
+				calls++
+				return nil, nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls).To(Equal(0))
+		for _, r := range results {
+			Expect(r.Success).To(BeFalse())
+			Expect(r.Error).To(Equal(events.ErrEventTooLarge.Error()))
+		}
+
+		results, err = events.NewBatcher(2, 0).Publish(cloudEvents,
+			func(batch []*cloudevents.Event, dataPayloads []events.PublishDataInput) ([]events.PublishEventResult, error) {
+				calls++
+				if calls == 2 {
+					return nil, fmt.Errorf("post failed")
+				}
+				return []events.PublishEventResult{{Success: true}, {Success: true}}, nil
+			},
+		)
+		Expect(err).To(HaveOccurred())
+		Expect(calls).To(Equal(2))
+		Expect(results[0].Success).To(BeTrue())
+		Expect(results[1].Success).To(BeTrue())
+		for _, r := range results[2:] {
+			Expect(r.Success).To(BeFalse())
+			Expect(r.Error).To(Equal("post failed"))
+		}
+	})
+})
@@ -0,0 +1,342 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// SlowConsumerPolicy determines what happens when
+// an event is published to a subscriber whose
+// buffer is full.
+type SlowConsumerPolicy int
+
+const (
+	// the event being published is dropped
+	DropNewest SlowConsumerPolicy = iota
+	// the oldest buffered event is dropped
+	DropOldest
+	// the publisher blocks until there is room in the
+	// buffer or the bus's block timeout elapses after
+	// which the event is dropped
+	Block
+)
+
+// Bus is an in-process publish/subscribe bus
+// for cloud events.
+type Bus struct {
+	// replaced rather than modified when subscriptions
+	// are added or removed so publishers can deliver
+	// to a snapshot of it without holding the lock
+	subscriptions []*Subscription
+	blockTimeout  time.Duration
+
+	closed bool
+	mx     sync.RWMutex
+}
+
+// Subscription receives events published to the
+// bus whose type matches the subscription's filter.
+type Subscription struct {
+	bus *Bus
+
+	filter string
+	policy SlowConsumerPolicy
+
+	events chan *cloudevents.Event
+	// number of events dropped because
+	// the subscriber was too slow
+	dropped uint64
+
+	// callback subscriptions
+	callback func(event *cloudevents.Event)
+	done     chan struct{}
+	// set while the callback is handling an event
+	inCallback atomic.Bool
+
+	// closed when the subscription is cancelled
+	// to unblock publishers waiting to deliver
+	closing chan struct{}
+	// the channel is closed only once no
+	// events are being delivered to it
+	closed bool
+	sendMx sync.RWMutex
+
+	closeOnce sync.Once
+	mx        sync.Mutex
+}
+
+// Returns a new bus. Publishers to subscribers with
+// the Block policy wait at most 'blockTimeout' for
+// room in the subscriber's buffer.
+func NewBus(blockTimeout time.Duration) *Bus {
+	return &Bus{
+		subscriptions: []*Subscription{},
+		blockTimeout:  blockTimeout,
+	}
+}
+
+// Subscribes to events whose type matches the given
+// filter. The filter is either an exact event type or
+// a type prefix ending with '*' such as
+// 'io.appbricks.mycs.network.*'. An empty filter or
+// '*' matches all events. Events are delivered on the
+// subscription's channel which buffers at most
+// 'bufferSize' events.
+func (b *Bus) Subscribe(filter string, bufferSize int, policy SlowConsumerPolicy) *Subscription {
+
+	s := &Subscription{
+		bus:     b,
+		filter:  filter,
+		policy:  policy,
+		events:  make(chan *cloudevents.Event, bufferSize),
+		closing: make(chan struct{}),
+	}
+	b.add(s)
+	return s
+}
+
+// Subscribes to events whose type matches the given
+// filter and invokes the callback for each event in
+// the order published. The callback is invoked on a
+// separate goroutine with events buffered as for
+// channel subscriptions. The callback may cancel
+// the subscription.
+func (b *Bus) SubscribeFunc(
+	filter string,
+	bufferSize int,
+	policy SlowConsumerPolicy,
+	callback func(event *cloudevents.Event),
+) *Subscription {
+
+	s := &Subscription{
+		bus:      b,
+		filter:   filter,
+		policy:   policy,
+		events:   make(chan *cloudevents.Event, bufferSize),
+		callback: callback,
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		for event := range s.events {
+			s.inCallback.Store(true)
+			s.callback(event)
+			s.inCallback.Store(false)
+		}
+	}()
+	b.add(s)
+	return s
+}
+
+func (b *Bus) add(s *Subscription) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.closed {
+		s.close()
+		return
+	}
+	subscriptions := make([]*Subscription, 0, len(b.subscriptions)+1)
+	b.subscriptions = append(append(subscriptions, b.subscriptions...), s)
+}
+
+func (b *Bus) remove(s *Subscription) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	subscriptions := make([]*Subscription, 0, len(b.subscriptions))
+	for _, ss := range b.subscriptions {
+		if ss != s {
+			subscriptions = append(subscriptions, ss)
+		}
+	}
+	b.subscriptions = subscriptions
+}
+
+// Publishes the given events to all
+// subscribers with a matching filter.
+func (b *Bus) Publish(cloudEvents ...*cloudevents.Event) {
+	// events are delivered without the lock held so
+	// a blocked delivery to a slow subscriber does
+	// not stall subscribing or cancelling
+	b.mx.RLock()
+	subscriptions := b.subscriptions
+	closed := b.closed
+	b.mx.RUnlock()
+
+	if closed {
+		return
+	}
+	for _, event := range cloudEvents {
+		eventType := event.Type()
+		for _, s := range subscriptions {
+			if s.matches(eventType) {
+				s.deliver(event, b.blockTimeout)
+			}
+		}
+	}
+}
+
+// Closes the bus and all its subscriptions
+func (b *Bus) Close() {
+	b.mx.Lock()
+	subscriptions := b.subscriptions
+	b.subscriptions = nil
+	b.closed = true
+	b.mx.Unlock()
+
+	for _, s := range subscriptions {
+		s.close()
+	}
+}
+
+// Returns the channel on which events are delivered.
+// The channel is closed when the subscription is
+// cancelled. Callback subscriptions should not read
+// from this channel.
+func (s *Subscription) Events() <-chan *cloudevents.Event {
+	return s.events
+}
+
+// Returns the number of events that were not
+// delivered because the subscriber's buffer
+// was full.
+func (s *Subscription) Dropped() uint64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.dropped
+}
+
+// Cancels the subscription and closes its channel.
+// For callback subscriptions this waits for all
+// buffered events to be handled unless the callback
+// is handling an event, such as when it is called
+// from the callback, in which case it returns
+// immediately and no further events are handled
+// once the callback returns.
+func (s *Subscription) Cancel() {
+	s.bus.remove(s)
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.closeOnce.Do(func() {
+		// unblock publishers waiting for room in the
+		// buffer before the channel is closed
+		close(s.closing)
+
+		s.sendMx.Lock()
+		s.closed = true
+		close(s.events)
+		s.sendMx.Unlock()
+	})
+	if s.done != nil {
+		if s.inCallback.Load() {
+			// the callback may be the caller in
+			// which case it cannot wait for itself
+			s.discardBuffered()
+			return
+		}
+		<-s.done
+	}
+}
+
+// drains the events buffered for a callback
+// subscription cancelled while its callback was
+// handling an event
+func (s *Subscription) discardBuffered() {
+	for {
+		select {
+		case _, ok := <-s.events:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *Subscription) matches(eventType string) bool {
+	switch {
+	case len(s.filter) == 0 || s.filter == "*":
+		return true
+	case strings.HasSuffix(s.filter, "*"):
+		return strings.HasPrefix(eventType, s.filter[:len(s.filter)-1])
+	default:
+		return eventType == s.filter
+	}
+}
+
+func (s *Subscription) deliver(event *cloudevents.Event, blockTimeout time.Duration) {
+	s.sendMx.RLock()
+	defer s.sendMx.RUnlock()
+
+	if s.closed {
+		// cancelled after the publisher took
+		// its snapshot of the subscriptions
+		return
+	}
+
+	select {
+	case s.events <- event:
+		return
+	default:
+	}
+
+	switch s.policy {
+	case DropOldest:
+		if cap(s.events) == 0 {
+			// nothing buffered to drop
+			break
+		}
+		// events may be consumed concurrently so
+		// retry until the event has been buffered
+		for {
+			select {
+			case oldest := <-s.events:
+				s.drop(oldest)
+			default:
+			}
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+		}
+
+	case Block:
+		timer := time.NewTimer(blockTimeout)
+		defer timer.Stop()
+
+		select {
+		case s.events <- event:
+			return
+		case <-s.closing:
+			return
+		case <-timer.C:
+		}
+	}
+	s.drop(event)
+}
+
+func (s *Subscription) drop(event *cloudevents.Event) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.dropped == 0 {
+		logger.WarnMessage(
+			"Subscription.deliver(): Subscriber to '%s' is not keeping up. Dropping event with id %s.",
+			s.filter, event.Context.GetID(),
+		)
+	}
+	s.dropped++
+}
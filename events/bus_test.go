@@ -0,0 +1,188 @@
+package events_test
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bus", func() {
+
+	var (
+		bus *events.Bus
+	)
+
+	BeforeEach(func() {
+		bus = events.NewBus(50 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		bus.Close()
+	})
+
+	It("delivers events to subscribers with matching filters", func() {
+
+		networkSub := bus.Subscribe("io.appbricks.mycs.network.*", 10, events.DropNewest)
+		metricSub := bus.Subscribe("io.appbricks.mycs.network.metric", 10, events.DropNewest)
+		allSub := bus.Subscribe("*", 10, events.DropNewest)
+
+		received := []string{}
+		receivedMx := sync.Mutex{}
+		funcSub := bus.SubscribeFunc("io.appbricks.mycs.vpn.*", 10, events.Block,
+			func(event *cloudevents.Event) {
+				receivedMx.Lock()
+				defer receivedMx.Unlock()
+				received = append(received, event.ID())
+			},
+		)
+
+		bus.Publish(
+			newBusEvent("1", "io.appbricks.mycs.network.metric"),
+			newBusEvent("2", "io.appbricks.mycs.network.status"),
+			newBusEvent("3", "io.appbricks.mycs.vpn.connected"),
+		)
+
+		Expect(receiveIDs(networkSub, 2)).To(Equal([]string{"1", "2"}))
+		Expect(receiveIDs(metricSub, 1)).To(Equal([]string{"1"}))
+		Expect(receiveIDs(allSub, 3)).To(Equal([]string{"1", "2", "3"}))
+
+		funcSub.Cancel()
+		Expect(received).To(Equal([]string{"3"}))
+
+		// cancelled subscriptions receive no further events
+		bus.Publish(newBusEvent("4", "io.appbricks.mycs.vpn.disconnected"))
+		Expect(received).To(Equal([]string{"3"}))
+
+		metricSub.Cancel()
+		_, ok := <-metricSub.Events()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("applies the slow consumer policy when a subscriber's buffer is full", func() {
+
+		dropNewestSub := bus.Subscribe("", 2, events.DropNewest)
+		dropOldestSub := bus.Subscribe("", 2, events.DropOldest)
+		blockSub := bus.Subscribe("", 2, events.Block)
+
+		start := time.Now()
+		for i := 1; i <= 4; i++ {
+			bus.Publish(newBusEvent(fmt.Sprintf("%d", i), "io.appbricks.mycs.test"))
+		}
+		// blocked for two publishes
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+
+		Expect(receiveIDs(dropNewestSub, 2)).To(Equal([]string{"1", "2"}))
+		Expect(dropNewestSub.Dropped()).To(Equal(uint64(2)))
+		Expect(receiveIDs(dropOldestSub, 2)).To(Equal([]string{"3", "4"}))
+		Expect(dropOldestSub.Dropped()).To(Equal(uint64(2)))
+		Expect(receiveIDs(blockSub, 2)).To(Equal([]string{"1", "2"}))
+		Expect(blockSub.Dropped()).To(Equal(uint64(2)))
+
+		// a blocked publish completes once the consumer catches up
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			<-blockSub.Events()
+		}()
+		bus.Publish(newBusEvent("5", "io.appbricks.mycs.test"))
+		bus.Publish(newBusEvent("6", "io.appbricks.mycs.test"))
+		bus.Publish(newBusEvent("7", "io.appbricks.mycs.test"))
+		Expect(receiveIDs(blockSub, 2)).To(Equal([]string{"6", "7"}))
+		Expect(blockSub.Dropped()).To(Equal(uint64(2)))
+	})
+
+	It("subscribes and cancels while a publisher is blocked on a slow subscriber", func() {
+
+		slowBus := events.NewBus(5 * time.Second)
+		defer slowBus.Close()
+
+		blockSub := slowBus.Subscribe("", 1, events.Block)
+		slowBus.Publish(newBusEvent("1", "io.appbricks.mycs.test"))
+
+		published := make(chan struct{})
+		go func() {
+			defer close(published)
+			slowBus.Publish(newBusEvent("2", "io.appbricks.mycs.test"))
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		start := time.Now()
+		otherSub := slowBus.Subscribe("", 1, events.DropNewest)
+		otherSub.Cancel()
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+		// cancelling the slow subscriber
+		// unblocks the publisher
+		blockSub.Cancel()
+		Eventually(published, time.Second).Should(BeClosed())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("allows a callback subscription to be cancelled from its callback", func() {
+
+		var sub *events.Subscription
+
+		received := []string{}
+		receivedMx := sync.Mutex{}
+		cancelled := make(chan struct{})
+		sub = bus.SubscribeFunc("", 10, events.DropNewest,
+			func(event *cloudevents.Event) {
+				receivedMx.Lock()
+				received = append(received, event.ID())
+				receivedMx.Unlock()
+
+				if event.ID() == "2" {
+					sub.Cancel()
+					close(cancelled)
+				}
+			},
+		)
+
+		bus.Publish(
+			newBusEvent("1", "io.appbricks.mycs.test"),
+			newBusEvent("2", "io.appbricks.mycs.test"),
+			newBusEvent("3", "io.appbricks.mycs.test"),
+		)
+		Eventually(cancelled, time.Second).Should(BeClosed())
+
+		// cancelling again from another goroutine returns
+		// once the callback goroutine has exited
+		sub.Cancel()
+		bus.Publish(newBusEvent("4", "io.appbricks.mycs.test"))
+
+		receivedMx.Lock()
+		defer receivedMx.Unlock()
+		Expect(received).To(Equal([]string{"1", "2"}))
+	})
+})
+
+func newBusEvent(id, eventType string) *cloudevents.Event {
+	event := cloudevents.NewEvent()
+	event.SetID(id)
+	event.SetType(eventType)
+	event.SetSource("urn:mycs:test")
+	return &event
+}
+
+func receiveIDs(s *events.Subscription, count int) []string {
+	ids := []string{}
+	for i := 0; i < count; i++ {
+		select {
+		case event := <-s.Events():
+			ids = append(ids, event.ID())
+		case <-time.After(time.Second):
+			Fail("timed out waiting for event")
+		}
+	}
+	select {
+	case event := <-s.Events():
+		Fail(fmt.Sprintf("unexpected event %s", event.ID()))
+	default:
+	}
+	return ids
+}
@@ -0,0 +1,209 @@
+package events
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"tailscale.com/smallzstd"
+)
+
+// Codec compresses and decompresses
+// encoded event payloads.
+type Codec interface {
+	Name() string
+
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+const (
+	CodecNone = "none"
+	CodecZlib = "zlib"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+var ErrUnknownCodec = errors.New("unknown codec")
+
+var (
+	codecs   = make(map[string]Codec)
+	codecsMx sync.RWMutex
+)
+
+func init() {
+	RegisterCodec(noneCodec{})
+	RegisterCodec(zlibCodec{})
+	RegisterCodec(gzipCodec{})
+	RegisterCodec(&zstdCodec{})
+}
+
+// Registers a codec so it can be referenced by
+// name when encoding and decoding payloads. A
+// codec registered with the name of an existing
+// codec replaces it.
+func RegisterCodec(codec Codec) {
+	codecsMx.Lock()
+	defer codecsMx.Unlock()
+
+	codecs[codec.Name()] = codec
+}
+
+// Returns the registered codec with the given name
+func GetCodec(name string) (Codec, error) {
+	codecsMx.RLock()
+	defer codecsMx.RUnlock()
+
+	if codec, ok := codecs[name]; ok {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrUnknownCodec, name)
+}
+
+// none
+
+type noneCodec struct{}
+
+func (noneCodec) Name() string {
+	return CodecNone
+}
+
+func (noneCodec) Compress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (noneCodec) Decompress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// zlib
+
+type zlibCodec struct{}
+
+func (zlibCodec) Name() string {
+	return CodecZlib
+}
+
+func (zlibCodec) Compress(data []byte) ([]byte, error) {
+
+	var (
+		err error
+
+		compressed bytes.Buffer
+	)
+
+	zlibWriter := zlib.NewWriter(&compressed)
+	if _, err = zlibWriter.Write(data); err != nil {
+		zlibWriter.Close()
+		return nil, err
+	}
+	if err = zlibWriter.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func (zlibCodec) Decompress(data []byte) ([]byte, error) {
+
+	var (
+		err error
+
+		zlibReader io.ReadCloser
+	)
+
+	if zlibReader, err = zlib.NewReader(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	defer zlibReader.Close()
+
+	return io.ReadAll(zlibReader)
+}
+
+// gzip
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+	return CodecGzip
+}
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+
+	var (
+		err error
+
+		compressed bytes.Buffer
+	)
+
+	gzipWriter := gzip.NewWriter(&compressed)
+	if _, err = gzipWriter.Write(data); err != nil {
+		gzipWriter.Close()
+		return nil, err
+	}
+	if err = gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+
+	var (
+		err error
+
+		gzipReader *gzip.Reader
+	)
+
+	if gzipReader, err = gzip.NewReader(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	return io.ReadAll(gzipReader)
+}
+
+// zstd
+
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+
+	// encoder and decoder are created on first use
+	// and shared as they are safe for concurrent
+	// use via EncodeAll/DecodeAll
+	initOnce sync.Once
+	initErr  error
+}
+
+func (c *zstdCodec) init() error {
+	c.initOnce.Do(func() {
+		if c.encoder, c.initErr = smallzstd.NewEncoder(nil); c.initErr != nil {
+			return
+		}
+		c.decoder, c.initErr = smallzstd.NewDecoder(nil)
+	})
+	return c.initErr
+}
+
+func (c *zstdCodec) Name() string {
+	return CodecZstd
+}
+
+func (c *zstdCodec) Compress(data []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *zstdCodec) Decompress(data []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.decoder.DecodeAll(data, nil)
+}
@@ -0,0 +1,133 @@
+package events_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Codecs", func() {
+
+	var (
+		event cloudevents.Event
+	)
+
+	BeforeEach(func() {
+		event = cloudevents.NewEvent()
+		err := json.Unmarshal([]byte(testEvents[0]), &event)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("encodes and decodes payloads with each registered codec", func() {
+
+		for _, codecName := range []string{
+			events.CodecZlib,
+			events.CodecGzip,
+			events.CodecZstd,
+		} {
+			encoder, err := events.NewPayloadEncoder(codecName, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			dataPayload, err := encoder.Encode(&event)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dataPayload.Compressed).To(BeTrue())
+			if codecName == events.CodecZlib {
+				// zlib payloads are encoded as before
+				// codecs could be chosen
+				Expect(dataPayload.Codec).To(BeEmpty())
+			} else {
+				Expect(dataPayload.Codec).To(Equal(codecName))
+			}
+
+			decodedEvent, err := events.DecodePublishDataInput(dataPayload)
+			Expect(err).NotTo(HaveOccurred())
+			data, err := json.Marshal(decodedEvent)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal(testEvents[0]))
+		}
+	})
+
+	It("does not compress payloads below the threshold", func() {
+
+		encoder, err := events.NewPayloadEncoder(events.CodecZstd, 1024)
+		Expect(err).NotTo(HaveOccurred())
+		dataPayload, err := encoder.Encode(&event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataPayload.Compressed).To(BeFalse())
+		Expect(dataPayload.Codec).To(BeEmpty())
+
+		decodedEvent, err := events.DecodePublishDataInput(dataPayload)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decodedEvent.ID()).To(Equal(event.ID()))
+
+		encoder, err = events.NewPayloadEncoder(events.CodecNone, 0)
+		Expect(err).NotTo(HaveOccurred())
+		dataPayload, err = encoder.Encode(&event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataPayload.Compressed).To(BeFalse())
+	})
+
+	It("uses a custom codec and the default encoder", func() {
+
+		events.RegisterCodec(reverseCodec{})
+		encoder, err := events.NewPayloadEncoder("reverse", 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		events.SetDefaultEncoder(encoder)
+		defer func() {
+			encoder, err = events.NewPayloadEncoder(events.CodecZlib, 0)
+			Expect(err).NotTo(HaveOccurred())
+			events.SetDefaultEncoder(encoder)
+		}()
+
+		dataPayload, err := events.NewPublishDataInput(&event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataPayload.Codec).To(Equal("reverse"))
+
+		decodedEvent, err := events.DecodePublishDataInput(dataPayload)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decodedEvent.ID()).To(Equal(event.ID()))
+	})
+
+	It("fails for unknown codecs", func() {
+
+		_, err := events.NewPayloadEncoder("unknown", 0)
+		Expect(errors.Is(err, events.ErrUnknownCodec)).To(BeTrue())
+
+		dataPayload, err := events.NewPublishDataInput(&event)
+		Expect(err).NotTo(HaveOccurred())
+		dataPayload.Codec = "unknown"
+
+		_, err = events.DecodePublishDataInput(dataPayload)
+		Expect(errors.Is(err, events.ErrInvalidCompression)).To(BeTrue())
+		Expect(errors.Is(err, events.ErrUnknownCodec)).To(BeTrue())
+	})
+})
+
+type reverseCodec struct{}
+
+func (reverseCodec) Name() string {
+	return "reverse"
+}
+
+func (reverseCodec) Compress(data []byte) ([]byte, error) {
+	return []byte(reverse(string(data))), nil
+}
+
+func (reverseCodec) Decompress(data []byte) ([]byte, error) {
+	return []byte(reverse(string(data))), nil
+}
+
+func reverse(s string) string {
+	var b strings.Builder
+	for i := len(s) - 1; i >= 0; i-- {
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
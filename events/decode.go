@@ -0,0 +1,159 @@
+package events
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+var (
+	ErrInvalidType        = errors.New("publish data input is not of type 'event'")
+	ErrInvalidEncoding    = errors.New("publish data input payload is not base64 encoded")
+	ErrInvalidCompression = errors.New("publish data input payload could not be decompressed")
+	ErrInvalidEvent       = errors.New("publish data input payload is not a valid cloud event")
+)
+
+// DecodeError is returned when a publish data input
+// cannot be decoded into a valid cloud event. The
+// index is the position of the input in the list
+// being decoded so it lines up with the result
+// list returned when publishing that list.
+type DecodeError struct {
+	Index int
+
+	// one of the ErrInvalid* errors above
+	Err error
+	// underlying error if any
+	Cause error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("entry %d: %s: %s", e.Index, e.Err.Error(), e.Cause.Error())
+	}
+	return fmt.Sprintf("entry %d: %s", e.Index, e.Err.Error())
+}
+
+func (e *DecodeError) Unwrap() []error {
+	if e.Cause != nil {
+		return []error{e.Err, e.Cause}
+	}
+	return []error{e.Err}
+}
+
+// DecodeErrors is the list of errors returned
+// when decoding a list of publish data inputs.
+type DecodeErrors []*DecodeError
+
+func (e DecodeErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Returns a list of 'count' publish event results
+// with the entries that failed to decode flagged
+// as errors.
+func (e DecodeErrors) Results(count int) []PublishEventResult {
+
+	results := make([]PublishEventResult, count)
+	for i := range results {
+		results[i].Success = true
+	}
+	for _, err := range e {
+		if err.Index >= 0 && err.Index < count {
+			results[err.Index] = PublishEventResult{
+				Success: false,
+				Error:   err.Error(),
+			}
+		}
+	}
+	return results
+}
+
+// Decodes a publish data input created by
+// NewPublishDataInput back to the cloud event
+// it was created from and validates it. Any
+// error returned will be a *DecodeError.
+// Encrypted inputs need to be decrypted with
+// DecryptPublishDataInput before decoding.
+func DecodePublishDataInput(dataPayload *PublishDataInput) (*cloudevents.Event, error) {
+
+	var (
+		err error
+
+		codec Codec
+
+		eventPayload,
+		decodedPayload []byte
+	)
+
+	if dataPayload.Type != PublishDataTypeEvent {
+		return nil, &DecodeError{
+			Err:   ErrInvalidType,
+			Cause: fmt.Errorf("found type '%s'", dataPayload.Type),
+		}
+	}
+	if dataPayload.Encrypted {
+		return nil, &DecodeError{Err: ErrEncryptedPayload}
+	}
+	if decodedPayload, err = base64.StdEncoding.DecodeString(dataPayload.Payload); err != nil {
+		return nil, &DecodeError{Err: ErrInvalidEncoding, Cause: err}
+	}
+	if dataPayload.Compressed {
+		codecName := dataPayload.Codec
+		if len(codecName) == 0 {
+			codecName = CodecZlib
+		}
+		if codec, err = GetCodec(codecName); err != nil {
+			return nil, &DecodeError{Err: ErrInvalidCompression, Cause: err}
+		}
+		if eventPayload, err = codec.Decompress(decodedPayload); err != nil {
+			return nil, &DecodeError{Err: ErrInvalidCompression, Cause: err}
+		}
+	} else {
+		eventPayload = decodedPayload
+	}
+
+	event := cloudevents.NewEvent()
+	if err = event.UnmarshalJSON(eventPayload); err != nil {
+		return nil, &DecodeError{Err: ErrInvalidEvent, Cause: err}
+	}
+	if err = event.Validate(); err != nil {
+		return nil, &DecodeError{Err: ErrInvalidEvent, Cause: err}
+	}
+	return &event, nil
+}
+
+// Decodes a list of publish data inputs. The
+// returned list of events is the same length
+// as the input list with nil entries for the
+// inputs that failed to decode. If any entries
+// failed the error returned will be of type
+// DecodeErrors.
+func DecodePublishDataInputs(dataPayloads []PublishDataInput) ([]*cloudevents.Event, error) {
+
+	var (
+		err error
+
+		decodeErrors DecodeErrors
+	)
+
+	cloudEvents := make([]*cloudevents.Event, len(dataPayloads))
+	for i := range dataPayloads {
+		if cloudEvents[i], err = DecodePublishDataInput(&dataPayloads[i]); err != nil {
+			decodeError := err.(*DecodeError)
+			decodeError.Index = i
+			decodeErrors = append(decodeErrors, decodeError)
+		}
+	}
+	if len(decodeErrors) > 0 {
+		return cloudEvents, decodeErrors
+	}
+	return cloudEvents, nil
+}
@@ -0,0 +1,96 @@
+package events_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Decode", func() {
+
+	It("decodes a list of published events", func() {
+
+		cloudEvents := []*cloudevents.Event{}
+		for _, e := range testEvents {
+			event := cloudevents.NewEvent()
+			err := json.Unmarshal([]byte(e), &event)
+			Expect(err).NotTo(HaveOccurred())
+			cloudEvents = append(cloudEvents, &event)
+		}
+		publishEventList := events.CreatePublishEventList("urn:mycs:device:12345", cloudEvents)
+
+		decodedEvents, err := events.DecodePublishDataInputs(publishEventList)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(decodedEvents)).To(Equal(len(testEvents)))
+
+		for i, event := range decodedEvents {
+			data, err := json.Marshal(event)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal(testEvents[i]))
+		}
+	})
+
+	It("decodes an uncompressed payload", func() {
+
+		event, err := events.DecodePublishDataInput(&events.PublishDataInput{
+			Type:       "event",
+			Compressed: false,
+			Payload:    base64.StdEncoding.EncodeToString([]byte(testEvents[0])),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.ID()).To(Equal("441d7a42-06b2-4a23-84a3-85b08dc3c28a"))
+	})
+
+	It("returns typed errors aligned with the input list", func() {
+
+		event := cloudevents.NewEvent()
+		err := json.Unmarshal([]byte(testEvents[0]), &event)
+		Expect(err).NotTo(HaveOccurred())
+		validInput, err := events.NewPublishDataInput(&event)
+		Expect(err).NotTo(HaveOccurred())
+
+		inputs := []events.PublishDataInput{
+			*validInput,
+			{Type: "metric", Compressed: true, Payload: validInput.Payload},
+			{Type: "event", Compressed: true, Payload: "%%%"},
+			{Type: "event", Compressed: true, Payload: base64.StdEncoding.EncodeToString([]byte("not zlib"))},
+			{Type: "event", Compressed: false, Payload: base64.StdEncoding.EncodeToString([]byte(`{"specversion":"1.0","type":"t"}`))},
+			*validInput,
+		}
+
+		decodedEvents, err := events.DecodePublishDataInputs(inputs)
+		Expect(err).To(HaveOccurred())
+		Expect(len(decodedEvents)).To(Equal(len(inputs)))
+		Expect(decodedEvents[0]).NotTo(BeNil())
+		Expect(decodedEvents[1]).To(BeNil())
+		Expect(decodedEvents[5]).NotTo(BeNil())
+
+		var decodeErrors events.DecodeErrors
+		Expect(errors.As(err, &decodeErrors)).To(BeTrue())
+		Expect(len(decodeErrors)).To(Equal(4))
+
+		expected := []error{
+			events.ErrInvalidType,
+			events.ErrInvalidEncoding,
+			events.ErrInvalidCompression,
+			events.ErrInvalidEvent,
+		}
+		for i, decodeError := range decodeErrors {
+			Expect(decodeError.Index).To(Equal(i + 1))
+			Expect(errors.Is(decodeError, expected[i])).To(BeTrue())
+		}
+
+		results := decodeErrors.Results(len(inputs))
+		Expect(len(results)).To(Equal(len(inputs)))
+		Expect(results[0].Success).To(BeTrue())
+		Expect(results[4].Success).To(BeFalse())
+		Expect(results[4].Error).To(HavePrefix("entry 4: "))
+		Expect(results[5].Success).To(BeTrue())
+	})
+})
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"encoding/base64"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/sirupsen/logrus"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// PayloadEncoder encodes cloud events as
+// publish data inputs.
+type PayloadEncoder struct {
+	codec Codec
+
+	// payloads smaller than this
+	// are sent uncompressed
+	threshold int
+
+	// if set payloads are encrypted
+	cryptProvider CryptProvider
+	// if set payloads are signed
+	signer PayloadSigner
+}
+
+var (
+	defaultEncoder   = &PayloadEncoder{codec: zlibCodec{}}
+	defaultEncoderMx sync.RWMutex
+)
+
+// Returns an encoder that compresses payloads using
+// the named codec. Payloads that are smaller than
+// 'threshold' bytes are not compressed.
+func NewPayloadEncoder(codecName string, threshold int) (*PayloadEncoder, error) {
+
+	var (
+		err error
+
+		codec Codec
+	)
+
+	if codec, err = GetCodec(codecName); err != nil {
+		return nil, err
+	}
+	return &PayloadEncoder{
+		codec:     codec,
+		threshold: threshold,
+	}, nil
+}
+
+// Sets the encoder used by NewPublishDataInput and
+// the publish event list functions. The default
+// encoder compresses all payloads using zlib.
+func SetDefaultEncoder(encoder *PayloadEncoder) {
+	defaultEncoderMx.Lock()
+	defer defaultEncoderMx.Unlock()
+
+	defaultEncoder = encoder
+}
+
+func getDefaultEncoder() *PayloadEncoder {
+	defaultEncoderMx.RLock()
+	defer defaultEncoderMx.RUnlock()
+
+	return defaultEncoder
+}
+
+// Returns a copy of the encoder that adds a detached
+// signature created with the given signer to each
+// encoded payload.
+func (e *PayloadEncoder) WithSigner(signer PayloadSigner) *PayloadEncoder {
+	ee := *e
+	ee.signer = signer
+	return &ee
+}
+
+// Returns a copy of the encoder that encrypts each
+// encoded payload with the current session key of
+// the given provider. Payloads are encrypted before
+// they are signed.
+func (e *PayloadEncoder) WithCrypt(cryptProvider CryptProvider) *PayloadEncoder {
+	ee := *e
+	ee.cryptProvider = cryptProvider
+	return &ee
+}
+
+func (e *PayloadEncoder) Encode(event *cloudevents.Event) (*PublishDataInput, error) {
+
+	var (
+		err error
+
+		eventPayload,
+		compressedPayload []byte
+	)
+
+	if logrus.IsLevelEnabled(logrus.TraceLevel) {
+		logger.DebugMessage("PayloadEncoder.Encode(): Preparing event for posting: %s", event.String())
+	}
+
+	if eventPayload, err = event.MarshalJSON(); err != nil {
+		logger.ErrorMessage("PayloadEncoder.Encode(): Unable to marshal event: %s", err.Error())
+		return nil, err
+	}
+
+	dataPayload := &PublishDataInput{
+		Type: PublishDataTypeEvent,
+	}
+	if len(eventPayload) < e.threshold || e.codec.Name() == CodecNone {
+		dataPayload.Payload = base64.StdEncoding.EncodeToString(eventPayload)
+
+	} else {
+		if compressedPayload, err = e.codec.Compress(eventPayload); err != nil {
+			logger.ErrorMessage(
+				"PayloadEncoder.Encode(): Unable to compress marshaled event using codec '%s': %s",
+				e.codec.Name(), event.String(),
+			)
+			return nil, err
+		}
+		dataPayload.Compressed = true
+		if e.codec.Name() != CodecZlib {
+			// zlib is assumed when no codec is given so the
+			// payloads of existing clients are unchanged
+			dataPayload.Codec = e.codec.Name()
+		}
+		dataPayload.Payload = base64.StdEncoding.EncodeToString(compressedPayload)
+	}
+
+	if e.cryptProvider != nil {
+		if err = e.encrypt(dataPayload); err != nil {
+			logger.ErrorMessage(
+				"PayloadEncoder.Encode(): Unable to encrypt payload of event with id %s: %s",
+				event.Context.GetID(), err.Error(),
+			)
+			return nil, err
+		}
+	}
+	if e.signer != nil {
+		if err = SignPublishDataInput(dataPayload, e.signer); err != nil {
+			logger.ErrorMessage(
+				"PayloadEncoder.Encode(): Unable to sign payload of event with id %s: %s",
+				event.Context.GetID(), err.Error(),
+			)
+			return nil, err
+		}
+	}
+	return dataPayload, nil
+}
+
+func (e *PayloadEncoder) encrypt(dataPayload *PublishDataInput) error {
+	crypt, cryptMx := e.cryptProvider.Crypt()
+	if cryptMx != nil {
+		cryptMx.Lock()
+		defer cryptMx.Unlock()
+	}
+	return EncryptPublishDataInput(dataPayload, crypt)
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"encoding/base64"
+	"errors"
+	"sync"
+
+	"github.com/mevansam/goutils/crypto"
+)
+
+// CryptProvider provides the current session key
+// used to encrypt payloads along with the mutex
+// that guards it. This is implemented by the
+// mycsnode.ApiClient whose key is renewed each
+// time it re-authenticates with the space node.
+type CryptProvider interface {
+	Crypt() (*crypto.Crypt, *sync.Mutex)
+}
+
+var (
+	ErrNoSessionKey     = errors.New("no session key available to encrypt payload")
+	ErrEncryptedPayload = errors.New("publish data input payload is encrypted")
+	ErrDecryptPayload   = errors.New("publish data input payload could not be decrypted")
+)
+
+// Seals the payload of the given publish data input
+// with the given crypt and flags it as encrypted.
+func EncryptPublishDataInput(dataPayload *PublishDataInput, crypt *crypto.Crypt) error {
+
+	var (
+		err error
+
+		encryptedPayload string
+	)
+
+	if crypt == nil {
+		return ErrNoSessionKey
+	}
+	if encryptedPayload, err = crypt.EncryptB64(dataPayload.Payload); err != nil {
+		return err
+	}
+	dataPayload.Payload = encryptedPayload
+	dataPayload.Encrypted = true
+	return nil
+}
+
+// Returns a copy of the given publish data input
+// with its payload decrypted using the given crypt
+// so it can be decoded with DecodePublishDataInput.
+// Inputs that are not encrypted are returned as is.
+func DecryptPublishDataInput(dataPayload *PublishDataInput, crypt *crypto.Crypt) (*PublishDataInput, error) {
+
+	var (
+		err error
+
+		decryptedPayload string
+	)
+
+	decryptedInput := *dataPayload
+	if !dataPayload.Encrypted {
+		return &decryptedInput, nil
+	}
+	if crypt == nil {
+		return nil, ErrNoSessionKey
+	}
+	if decryptedPayload, err = crypt.DecryptB64(dataPayload.Payload); err != nil {
+		return nil, &DecodeError{Err: ErrDecryptPayload, Cause: err}
+	}
+	if _, err = base64.StdEncoding.DecodeString(decryptedPayload); err != nil {
+		return nil, &DecodeError{Err: ErrDecryptPayload, Cause: err}
+	}
+	decryptedInput.Payload = decryptedPayload
+	decryptedInput.Encrypted = false
+	return &decryptedInput, nil
+}
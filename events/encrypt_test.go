@@ -0,0 +1,87 @@
+package events_test
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mevansam/goutils/crypto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encryption", func() {
+
+	var (
+		event cloudevents.Event
+
+		sessionCrypt *crypto.Crypt
+	)
+
+	BeforeEach(func() {
+		event = cloudevents.NewEvent()
+		err := json.Unmarshal([]byte(testEvents[0]), &event)
+		Expect(err).NotTo(HaveOccurred())
+
+		sessionCrypt, err = crypto.NewCrypt([]byte("0123456789abcdef0123456789abcdef"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("encrypts encoded payloads and decrypts them", func() {
+
+		encoder, err := events.NewPayloadEncoder(events.CodecZstd, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		dataPayload, err := encoder.
+			WithCrypt(&testCryptProvider{crypt: sessionCrypt}).
+			Encode(&event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataPayload.Encrypted).To(BeTrue())
+		Expect(dataPayload.Compressed).To(BeTrue())
+
+		_, err = events.DecodePublishDataInput(dataPayload)
+		Expect(errors.Is(err, events.ErrEncryptedPayload)).To(BeTrue())
+
+		decryptedPayload, err := events.DecryptPublishDataInput(dataPayload, sessionCrypt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decryptedPayload.Encrypted).To(BeFalse())
+		Expect(dataPayload.Encrypted).To(BeTrue())
+
+		decodedEvent, err := events.DecodePublishDataInput(decryptedPayload)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := json.Marshal(decodedEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(testEvents[0]))
+	})
+
+	It("fails to encrypt without a session key and to decrypt with the wrong key", func() {
+
+		encoder, err := events.NewPayloadEncoder(events.CodecZlib, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = encoder.WithCrypt(&testCryptProvider{}).Encode(&event)
+		Expect(errors.Is(err, events.ErrNoSessionKey)).To(BeTrue())
+
+		dataPayload, err := encoder.
+			WithCrypt(&testCryptProvider{crypt: sessionCrypt}).
+			Encode(&event)
+		Expect(err).NotTo(HaveOccurred())
+
+		otherCrypt, err := crypto.NewCrypt([]byte("fedcba9876543210fedcba9876543210"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = events.DecryptPublishDataInput(dataPayload, otherCrypt)
+		Expect(errors.Is(err, events.ErrDecryptPayload)).To(BeTrue())
+	})
+})
+
+type testCryptProvider struct {
+	crypt *crypto.Crypt
+	mx    sync.Mutex
+}
+
+func (p *testCryptProvider) Crypt() (*crypto.Crypt, *sync.Mutex) {
+	return p.crypt, &p.mx
+}
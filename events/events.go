@@ -1,20 +1,33 @@
 package events
 
 import (
-	"bytes"
-	"compress/zlib"
-	"encoding/base64"
+	"errors"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
-	"github.com/sirupsen/logrus"
 
 	"github.com/mevansam/goutils/logger"
 )
 
+// type of publish data input
+// payloads that are cloud events
+const PublishDataTypeEvent = "event"
+
 type PublishDataInput struct {
 	Type       string `json:"type"`
 	Compressed bool   `json:"compressed"`
 	Payload    string `json:"payload"`
+
+	// codec used to compress the payload. if the
+	// payload is compressed and no codec is given
+	// then zlib is assumed.
+	Codec string `json:"codec,omitempty"`
+	// payload has been encrypted with
+	// the space node session key
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// optional detached signature of the payload
+	Signature          string `json:"signature,omitempty"`
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
 }
 
 type PublishEventResult struct {
@@ -25,6 +38,25 @@ type PublishEventResult struct {
 type CloudEventError struct {
 	Event *cloudevents.Event
 	Error string	
+
+	// structured error if known which
+	// is used to classify the failure
+	Cause error
+}
+
+// Returns the error of the failed event. This is the
+// structured cause if known otherwise an error with
+// the reported message.
+func (e CloudEventError) Err() error {
+	if e.Cause != nil {
+		return e.Cause
+	}
+	if e.Error == ErrEventTooLarge.Error() {
+		// results of events rejected by the batcher
+		// only carry the message of the error
+		return ErrEventTooLarge
+	}
+	return errors.New(e.Error)
 }
 
 func CreatePublishEventList(eventSource string, cloudEvents []*cloudevents.Event) []PublishDataInput {
@@ -94,37 +126,5 @@ func FilterCloudEventsWithErrors(publishEventResults []PublishEventResult, cloud
 }
 
 func NewPublishDataInput(event *cloudevents.Event) (*PublishDataInput, error) {
-
-	var (
-		err error
-
-		zlibWriter *zlib.Writer
-
-		eventPayload      []byte
-		compressedPayload bytes.Buffer
-	)
-
-	if logrus.IsLevelEnabled(logrus.TraceLevel) {
-		logger.DebugMessage("events.CreatePublishEventList(): Preparing event for posting: %s", event.String())
-	}
-	
-	if eventPayload, err = event.MarshalJSON(); err != nil {
-		logger.ErrorMessage("events.CreatePublishEventList(): Unable to marshal event: %s", err.Error())
-		return nil, err
-	}
-
-	// compress payload and add it to list of payloads
-	zlibWriter = zlib.NewWriter(&compressedPayload)
-	if _, err = zlibWriter.Write([]byte(eventPayload)); err != nil {
-		logger.ErrorMessage("EventsAPI.PostMeasurementEvents(): Unable to compress marshaled event: %s", event.String())
-		zlibWriter.Close()
-		return nil, err
-	}
-	zlibWriter.Close()
-
-	return &PublishDataInput{
-		Type: "event",
-		Compressed: true,
-		Payload: base64.StdEncoding.EncodeToString(compressedPayload.Bytes()),
-	}, nil
+	return getDefaultEncoder().Encode(event)
 }
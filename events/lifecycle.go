@@ -0,0 +1,104 @@
+package events
+
+import (
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+)
+
+// lifecycle event types emitted by the vpn
+// clients and the mesh network daemon
+const (
+	VPNConnectedEventType      = `io.appbricks.mycs.vpn.connected`
+	VPNDisconnectedEventType   = `io.appbricks.mycs.vpn.disconnected`
+	VPNHandshakeStaleEventType = `io.appbricks.mycs.vpn.handshake-stale`
+
+	MeshPeerOnlineEventType  = `io.appbricks.mycs.mesh.peer-online`
+	MeshPeerOfflineEventType = `io.appbricks.mycs.mesh.peer-offline`
+
+	AlertFiringEventType   = `io.appbricks.mycs.monitor.alert-firing`
+	AlertResolvedEventType = `io.appbricks.mycs.monitor.alert-resolved`
+)
+
+// VPNSessionData is the data of vpn connected and
+// disconnected events. Both events of a session
+// have the same session id so the backend can
+// record when a session started and ended.
+type VPNSessionData struct {
+	SessionID string `json:"sessionID"`
+	Interface string `json:"interface"`
+	VPNType   string `json:"vpnType"`
+
+	// endpoints of the vpn service peers
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	StartTime time.Time `json:"startTime"`
+
+	// only set on disconnected events
+	EndTime       *time.Time `json:"endTime,omitempty"`
+	BytesSent     int64      `json:"bytesSent,omitempty"`
+	BytesReceived int64      `json:"bytesReceived,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+}
+
+// VPNHandshakeData is the data of the event emitted
+// when a vpn peer has not completed a handshake
+// within the expected interval.
+type VPNHandshakeData struct {
+	SessionID string `json:"sessionID"`
+	Interface string `json:"interface"`
+
+	PeerPublicKey string `json:"peerPublicKey"`
+	Endpoint      string `json:"endpoint,omitempty"`
+
+	// zero if the peer has never completed a handshake
+	LastHandshake time.Time `json:"lastHandshake"`
+	// seconds since the last handshake
+	HandshakeAge int64 `json:"handshakeAge"`
+}
+
+// MeshPeerData is the data of the events emitted
+// when a mesh peer comes online or goes offline.
+type MeshPeerData struct {
+	PeerID   string `json:"peerID"`
+	HostName string `json:"hostName"`
+	DNSName  string `json:"dnsName"`
+
+	Addresses []string `json:"addresses,omitempty"`
+
+	Online   bool      `json:"online"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// AlertData is the data of the events emitted
+// when a monitor alert rule starts firing or is
+// resolved.
+type AlertData struct {
+	Rule      string `json:"rule"`
+	Monitor   string `json:"monitor"`
+	Metric    string `json:"metric"`
+	Condition string `json:"condition"`
+
+	Firing    bool    `json:"firing"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Returns a new lifecycle event of the given
+// type with the given data as its json payload.
+func NewLifecycleEvent(eventType, subject string, data interface{}) (*cloudevents.Event, error) {
+
+	event := cloudevents.NewEvent()
+	event.SetID(uuid.NewString())
+	event.SetType(eventType)
+	event.SetSource("urn:mycs")
+	event.SetSubject(subject)
+	event.SetTime(time.Now())
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
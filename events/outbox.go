@@ -0,0 +1,515 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// Outbox is a durable append-only spool of event
+// payloads that are waiting to be published. Every
+// change is appended to the spool file and synced to
+// disk so entries that have not been acknowledged
+// survive a process restart or crash.
+type Outbox struct {
+	path    string
+	maxSize int64
+
+	file     *os.File
+	fileSize int64
+
+	entries     []*OutboxEntry
+	index       map[string]*OutboxEntry
+	pendingSize int64
+
+	// number of corrupt records skipped
+	// when the spool was loaded
+	corruptRecords int
+
+	mx sync.Mutex
+}
+
+type OutboxEntry struct {
+	ID    string           `json:"id"`
+	Input PublishDataInput `json:"input"`
+
+	size int64
+}
+
+type outboxRecord struct {
+	Op    string            `json:"op"`
+	ID    string            `json:"id"`
+	Input *PublishDataInput `json:"input,omitempty"`
+}
+
+const (
+	outboxOpAdd = "add"
+	outboxOpAck = "ack"
+
+	// spool files smaller than this are never compacted
+	outboxMinCompactSize = 64 * 1024
+
+	// suffix of the spool to which
+	// quarantined entries are moved
+	outboxQuarantineSuffix = ".quarantine"
+)
+
+// Returns the cloud event encoded in the entry's payload
+func (e *OutboxEntry) Event() (*cloudevents.Event, error) {
+	return DecodePublishDataInput(&e.Input)
+}
+
+// Opens the outbox spool at the given path creating
+// it if it does not exist. Any entries that were not
+// acknowledged when the spool was last open are
+// loaded and returned by Pending(). If 'maxSize' is
+// greater than 0 the total size of pending entries
+// is capped at that many bytes by dropping the oldest
+// entries.
+func NewOutbox(path string, maxSize int64) (*Outbox, error) {
+
+	var (
+		err error
+	)
+
+	o := &Outbox{
+		path:    path,
+		maxSize: maxSize,
+
+		entries: []*OutboxEntry{},
+		index:   make(map[string]*OutboxEntry),
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if o.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		return nil, err
+	}
+	if err = o.load(); err != nil {
+		o.file.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// replays the spool file to rebuild the list of pending
+// entries. complete records that are corrupt are skipped
+// so they do not affect the records that follow them. a
+// partially written last record, which can happen if the
+// process dies mid-write, is discarded.
+func (o *Outbox) load() error {
+
+	var (
+		err error
+
+		line   []byte
+		offset int64
+	)
+
+	reader := bufio.NewReader(o.file)
+	for {
+		if line, err = reader.ReadBytes('\n'); err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+
+		if line[len(line)-1] != '\n' {
+			logger.WarnMessage(
+				"Outbox.load(): Discarding partial record at offset %d of outbox spool '%s'.",
+				offset, o.path,
+			)
+			break
+		}
+		record := outboxRecord{}
+		if json.Unmarshal(line, &record) != nil {
+			logger.WarnMessage(
+				"Outbox.load(): Skipping corrupt record at offset %d of outbox spool '%s'.",
+				offset, o.path,
+			)
+			o.corruptRecords++
+		} else {
+			o.replay(&record, int64(len(line)))
+		}
+		offset += int64(len(line))
+	}
+
+	// truncate any trailing partial record and
+	// position the file for further appends
+	if err = o.file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err = o.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	o.fileSize = offset
+	return nil
+}
+
+func (o *Outbox) replay(record *outboxRecord, size int64) {
+
+	switch record.Op {
+	case outboxOpAdd:
+		if _, exists := o.index[record.ID]; !exists && record.Input != nil {
+			entry := &OutboxEntry{
+				ID:    record.ID,
+				Input: *record.Input,
+				size:  size,
+			}
+			o.entries = append(o.entries, entry)
+			o.index[record.ID] = entry
+			o.pendingSize += size
+		}
+	case outboxOpAck:
+		if entry, exists := o.index[record.ID]; exists {
+			delete(o.index, record.ID)
+			o.pendingSize -= entry.size
+			for i, e := range o.entries {
+				if e == entry {
+					o.entries = append(o.entries[:i], o.entries[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+// Appends the given entries to the outbox. Entries
+// with an id that is already pending are ignored.
+func (o *Outbox) Append(entries ...OutboxEntry) error {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	var (
+		err error
+	)
+
+	records := []*outboxRecord{}
+	for i := range entries {
+		entry := entries[i]
+		if _, exists := o.index[entry.ID]; !exists {
+			records = append(records, &outboxRecord{
+				Op:    outboxOpAdd,
+				ID:    entry.ID,
+				Input: &entry.Input,
+			})
+		}
+	}
+	if err = o.write(records); err != nil {
+		return err
+	}
+	return o.enforceMaxSize()
+}
+
+// Removes the entries with the given ids from the
+// outbox once they have been successfully published.
+func (o *Outbox) Remove(ids ...string) error {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	var (
+		err error
+	)
+
+	records := []*outboxRecord{}
+	for _, id := range ids {
+		if _, exists := o.index[id]; exists {
+			records = append(records, &outboxRecord{
+				Op: outboxOpAck,
+				ID: id,
+			})
+		}
+	}
+	if err = o.write(records); err != nil {
+		return err
+	}
+	if o.fileSize > outboxMinCompactSize && o.fileSize > 2*o.pendingSize {
+		return o.compact()
+	}
+	return nil
+}
+
+// Moves the entries with the given ids out of the
+// outbox to its quarantine spool so they are no
+// longer pending but are not lost. This is used for
+// entries that cannot be decoded, i.e. because they
+// were encrypted with a session key that is no
+// longer available, so they can be recovered later.
+func (o *Outbox) Quarantine(ids ...string) error {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	var (
+		err error
+
+		data []byte
+		buf  bytes.Buffer
+		file *os.File
+	)
+
+	records := []*outboxRecord{}
+	for _, id := range ids {
+		if entry, exists := o.index[id]; exists {
+			if data, err = json.Marshal(&outboxRecord{
+				Op:    outboxOpAdd,
+				ID:    entry.ID,
+				Input: &entry.Input,
+			}); err != nil {
+				return err
+			}
+			buf.Write(data)
+			buf.WriteByte('\n')
+
+			records = append(records, &outboxRecord{
+				Op: outboxOpAck,
+				ID: id,
+			})
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	// entries are synced to the quarantine
+	// spool before they are acknowledged
+	if file, err = os.OpenFile(o.QuarantinePath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	logger.WarnMessage(
+		"Outbox.Quarantine(): Moved %d entries of outbox '%s' to quarantine spool '%s'.",
+		len(records), o.path, o.QuarantinePath(),
+	)
+	return o.write(records)
+}
+
+// Returns the path of the spool to which
+// quarantined entries are moved. This spool
+// has the same format as the outbox spool.
+func (o *Outbox) QuarantinePath() string {
+	return o.path + outboxQuarantineSuffix
+}
+
+// Returns a copy of all entries that have not been
+// removed from the outbox in the order they were
+// appended.
+func (o *Outbox) Pending() []OutboxEntry {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	pending := make([]OutboxEntry, 0, len(o.entries))
+	for _, e := range o.entries {
+		pending = append(pending, *e)
+	}
+	return pending
+}
+
+// Returns the number of pending entries
+func (o *Outbox) Len() int {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	return len(o.entries)
+}
+
+// Returns the number of corrupt records that
+// were skipped when the spool was loaded
+func (o *Outbox) CorruptRecords() int {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	return o.corruptRecords
+}
+
+// Rewrites the spool file so that it only
+// contains records for pending entries.
+func (o *Outbox) Compact() error {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	return o.compact()
+}
+
+// Closes the outbox spool file.
+func (o *Outbox) Close() error {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+func (o *Outbox) write(records []*outboxRecord) error {
+
+	var (
+		err error
+
+		data []byte
+		buf  bytes.Buffer
+	)
+
+	if len(records) == 0 {
+		return nil
+	}
+	if o.file == nil {
+		return fmt.Errorf("outbox '%s' is closed", o.path)
+	}
+
+	sizes := make([]int64, 0, len(records))
+	for _, record := range records {
+		if data, err = json.Marshal(record); err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+		sizes = append(sizes, int64(len(data)+1))
+	}
+	if _, err = o.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err = o.file.Sync(); err != nil {
+		return err
+	}
+	o.fileSize += int64(buf.Len())
+
+	for i, record := range records {
+		o.replay(record, sizes[i])
+	}
+	return nil
+}
+
+func (o *Outbox) enforceMaxSize() error {
+
+	if o.maxSize <= 0 || o.pendingSize <= o.maxSize {
+		return nil
+	}
+
+	records := []*outboxRecord{}
+	size := o.pendingSize
+	for _, e := range o.entries {
+		if size <= o.maxSize {
+			break
+		}
+		records = append(records, &outboxRecord{
+			Op: outboxOpAck,
+			ID: e.ID,
+		})
+		size -= e.size
+	}
+	logger.WarnMessage(
+		"Outbox.enforceMaxSize(): Outbox '%s' exceeded its size limit of %d bytes. Dropping %d oldest entries.",
+		o.path, o.maxSize, len(records),
+	)
+	if err := o.write(records); err != nil {
+		return err
+	}
+	return o.compact()
+}
+
+func (o *Outbox) compact() error {
+
+	var (
+		err error
+
+		data  []byte
+		buf   bytes.Buffer
+		sizes []int64
+		tmp   *os.File
+	)
+
+	if o.file == nil {
+		return fmt.Errorf("outbox '%s' is closed", o.path)
+	}
+
+	sizes = make([]int64, 0, len(o.entries))
+	for _, e := range o.entries {
+		if data, err = json.Marshal(&outboxRecord{
+			Op:    outboxOpAdd,
+			ID:    e.ID,
+			Input: &e.Input,
+		}); err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+		sizes = append(sizes, int64(len(data)+1))
+	}
+
+	// write compacted spool to a temporary file
+	// and atomically swap it with the current one
+	tmpPath := o.path + ".tmp"
+	if tmp, err = os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+		return err
+	}
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	// open files cannot be replaced on windows so the
+	// spool is closed while it is swapped and reopened
+	// for appending afterwards. if it could not be
+	// swapped the current spool is reopened.
+	var swapErr error
+	if swapErr = o.file.Close(); swapErr == nil {
+		if swapErr = os.Rename(tmpPath, o.path); swapErr == nil {
+			syncDir(filepath.Dir(o.path))
+		}
+	}
+	if swapErr != nil {
+		os.Remove(tmpPath)
+	}
+	if o.file, err = os.OpenFile(o.path, os.O_RDWR|os.O_APPEND, 0600); err != nil {
+		logger.ErrorMessage(
+			"Outbox.compact(): Unable to reopen outbox '%s': %s",
+			o.path, err.Error(),
+		)
+		o.file = nil
+		return err
+	}
+	if swapErr != nil {
+		return swapErr
+	}
+
+	for i, e := range o.entries {
+		e.size = sizes[i]
+	}
+	o.fileSize = int64(buf.Len())
+	o.pendingSize = o.fileSize
+	return nil
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		// not supported on all platforms so errors are ignored
+		_ = d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,254 @@
+package events_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Outbox", func() {
+
+	var (
+		err error
+
+		tmpDir     string
+		outboxPath string
+	)
+
+	BeforeEach(func() {
+		tmpDir, err = os.MkdirTemp("", "outbox")
+		Expect(err).NotTo(HaveOccurred())
+		outboxPath = filepath.Join(tmpDir, "spool", "outbox.log")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("persists pending entries across restarts", func() {
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		entries := newOutboxEntries()
+		err = outbox.Append(entries...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outbox.Len()).To(Equal(len(testEvents)))
+
+		// appending existing entries is a no-op
+		err = outbox.Append(entries[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outbox.Len()).To(Equal(len(testEvents)))
+
+		err = outbox.Remove(entries[0].ID, entries[2].ID)
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		pending := outbox.Pending()
+		Expect(len(pending)).To(Equal(3))
+		Expect(pending[0].ID).To(Equal(entries[1].ID))
+		Expect(pending[1].ID).To(Equal(entries[3].ID))
+		Expect(pending[2].ID).To(Equal(entries[4].ID))
+
+		event, err := pending[0].Event()
+		Expect(err).NotTo(HaveOccurred())
+		data, err := json.Marshal(event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(testEvents[1]))
+
+		// compaction retains only pending entries
+		err = outbox.Compact()
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Remove(pending[1].ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outbox.Len()).To(Equal(2))
+	})
+
+	It("appends to the compacted spool after it has been swapped", func() {
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		entries := newOutboxEntries()
+		err = outbox.Append(entries[:3]...)
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Remove(entries[0].ID)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = outbox.Compact()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = os.Stat(outboxPath + ".tmp")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		err = outbox.Append(entries[3:]...)
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Remove(entries[1].ID)
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		pending := outbox.Pending()
+		Expect(len(pending)).To(Equal(3))
+		Expect(pending[0].ID).To(Equal(entries[2].ID))
+		Expect(pending[1].ID).To(Equal(entries[3].ID))
+		Expect(pending[2].ID).To(Equal(entries[4].ID))
+		Expect(outbox.CorruptRecords()).To(Equal(0))
+	})
+
+	It("discards a partially written record", func() {
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		entries := newOutboxEntries()
+		err = outbox.Append(entries[:2]...)
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		f, err := os.OpenFile(outboxPath, os.O_APPEND|os.O_WRONLY, 0600)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.WriteString(`{"op":"add","id":"partial","inp`)
+		Expect(err).NotTo(HaveOccurred())
+		f.Close()
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outbox.Len()).To(Equal(2))
+
+		err = outbox.Append(entries[2])
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+		Expect(outbox.Len()).To(Equal(3))
+	})
+
+	It("skips a corrupt record without discarding the records after it", func() {
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		entries := newOutboxEntries()
+		err = outbox.Append(entries[0])
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		f, err := os.OpenFile(outboxPath, os.O_APPEND|os.O_WRONLY, 0600)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.WriteString("{\"op\":\"add\",\"id\":\"corrupt\",\x00\x00}\n")
+		Expect(err).NotTo(HaveOccurred())
+		f.Close()
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outbox.Len()).To(Equal(1))
+		Expect(outbox.CorruptRecords()).To(Equal(1))
+
+		err = outbox.Append(entries[1:3]...)
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		pending := outbox.Pending()
+		Expect(len(pending)).To(Equal(3))
+		Expect(pending[0].ID).To(Equal(entries[0].ID))
+		Expect(pending[1].ID).To(Equal(entries[1].ID))
+		Expect(pending[2].ID).To(Equal(entries[2].ID))
+		Expect(outbox.CorruptRecords()).To(Equal(1))
+	})
+
+	It("moves quarantined entries to the quarantine spool", func() {
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		entries := newOutboxEntries()
+		err = outbox.Append(entries...)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = outbox.Quarantine(entries[1].ID, entries[3].ID, "unknown")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outbox.Len()).To(Equal(3))
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+		Expect(outbox.Len()).To(Equal(3))
+
+		// the quarantine spool can be opened as an outbox
+		quarantine, err := events.NewOutbox(outbox.QuarantinePath(), 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer quarantine.Close()
+
+		pending := quarantine.Pending()
+		Expect(len(pending)).To(Equal(2))
+		Expect(pending[0].ID).To(Equal(entries[1].ID))
+		Expect(pending[0].Input).To(Equal(entries[1].Input))
+		Expect(pending[1].ID).To(Equal(entries[3].ID))
+	})
+
+	It("drops the oldest entries when the size cap is exceeded", func() {
+
+		entries := newOutboxEntries()
+		record, err := json.Marshal(map[string]interface{}{
+			"op":    "add",
+			"id":    entries[0].ID,
+			"input": entries[0].Input,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// cap allows roughly two entries
+		outbox, err := events.NewOutbox(outboxPath, int64(2*len(record)+20))
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		err = outbox.Append(entries...)
+		Expect(err).NotTo(HaveOccurred())
+
+		pending := outbox.Pending()
+		Expect(len(pending)).To(Equal(2))
+		Expect(pending[0].ID).To(Equal(entries[3].ID))
+		Expect(pending[1].ID).To(Equal(entries[4].ID))
+	})
+})
+
+func newOutboxEntries() []events.OutboxEntry {
+
+	entries := []events.OutboxEntry{}
+	for _, e := range testEvents {
+		event := cloudevents.NewEvent()
+		err := json.Unmarshal([]byte(e), &event)
+		Expect(err).NotTo(HaveOccurred())
+
+		input, err := events.NewPublishDataInput(&event)
+		Expect(err).NotTo(HaveOccurred())
+		entries = append(entries, events.OutboxEntry{
+			ID:    event.ID(),
+			Input: *input,
+		})
+	}
+	return entries
+}
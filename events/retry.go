@@ -0,0 +1,400 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// RetryPolicy determines how often and how soon
+// an event that failed to publish is retried.
+type RetryPolicy struct {
+	// maximum number of attempts to publish an
+	// event before it is moved to the dead-letter
+	// store. 0 means retry indefinitely.
+	MaxAttempts int
+
+	// backoff after the first failure which is then
+	// multiplied by 'Multiplier' after each failure
+	// up to 'MaxBackoff'
+	InitialBackoff,
+	MaxBackoff time.Duration
+	Multiplier float64
+
+	// fraction of the backoff that is randomized
+	// to spread out retries. i.e. 0.2 is +/- 20%.
+	Jitter float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: 5 * time.Second,
+	MaxBackoff:     30 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// upper bound of a backoff which is well
+// within the range of a time.Duration
+const maxRetryBackoff = time.Duration(math.MaxInt64 / 2)
+
+// ErrorClassifier returns whether an error returned
+// by the backend for a published event is transient
+// and the event should be retried.
+type ErrorClassifier func(err error) bool
+
+// RetryableError is implemented by errors that know
+// whether the failed request may succeed if it is
+// retried, such as the api errors of the mycsnode
+// package.
+type RetryableError interface {
+	error
+	IsRetryable() bool
+}
+
+// StatusError is the error of an event that was
+// rejected by a backend with the given http status.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.Message, e.StatusCode)
+}
+
+// Client errors are permanent unless the request
+// was not authorized, timed out or was throttled.
+func (e *StatusError) IsRetryable() bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode < http.StatusBadRequest ||
+		e.StatusCode >= http.StatusInternalServerError
+}
+
+// error messages that indicate the event itself
+// is at fault and will never be accepted
+var PermanentErrorMarkers = []string{
+	"invalid",
+	"malformed",
+	"not a valid",
+	"unmarshal",
+	"validation",
+	"bad request",
+	"exceeds the maximum",
+}
+
+// Classifies errors by their type. Errors that know
+// whether they are retryable are classified as such
+// and errors decoding an event or events that exceed
+// the maximum batch size are permanent. All other
+// errors are retryable.
+func DefaultErrorClassifier(err error) bool {
+	retryable, _ := classifyError(err)
+	return retryable
+}
+
+// Returns a classifier that classifies errors by
+// their type like DefaultErrorClassifier but falls
+// back to classifying errors that are only known by
+// their message, such as errors reported for events
+// by the backend, as permanent if the message
+// contains any of the given markers. If no markers
+// are given PermanentErrorMarkers are used.
+func NewMessageErrorClassifier(markers ...string) ErrorClassifier {
+	if len(markers) == 0 {
+		markers = PermanentErrorMarkers
+	}
+	return func(err error) bool {
+		if retryable, classified := classifyError(err); classified {
+			return retryable
+		}
+		message := strings.ToLower(err.Error())
+		for _, marker := range markers {
+			if strings.Contains(message, strings.ToLower(marker)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// returns whether the error is retryable and
+// whether it was classified by its type
+func classifyError(err error) (bool, bool) {
+
+	var (
+		retryableError RetryableError
+		decodeError    *DecodeError
+	)
+
+	switch {
+	case errors.As(err, &retryableError):
+		return retryableError.IsRetryable(), true
+	case errors.As(err, &decodeError),
+		errors.Is(err, ErrEventTooLarge):
+		return false, true
+	}
+	return true, false
+}
+
+// RetryManager tracks the number of attempts made to
+// publish each event by the event's id and determines
+// when the event should be retried or given up on.
+type RetryManager struct {
+	policy      RetryPolicy
+	classifier  ErrorClassifier
+	deadLetters *DeadLetterStore
+
+	retries map[string]*retryState
+
+	mx sync.Mutex
+}
+
+type retryState struct {
+	attempts int
+	// failures that were not due to the event
+	// which back off but are not attempts
+	deferrals   int
+	nextRetryAt time.Time
+}
+
+// Returns a retry manager which moves events that are
+// not to be retried to the given dead-letter store. If
+// 'classifier' is nil DefaultErrorClassifier is used.
+func NewRetryManager(
+	policy RetryPolicy,
+	classifier ErrorClassifier,
+	deadLetters *DeadLetterStore,
+) *RetryManager {
+
+	if classifier == nil {
+		classifier = DefaultErrorClassifier
+	}
+	return &RetryManager{
+		policy:      policy,
+		classifier:  classifier,
+		deadLetters: deadLetters,
+
+		retries: make(map[string]*retryState),
+	}
+}
+
+// Records a failed attempt to publish the given
+// event. Returns true if the event should be
+// retried or false if it was moved to the
+// dead-letter store.
+func (rm *RetryManager) Failed(event *cloudevents.Event, err error) bool {
+	rm.mx.Lock()
+	defer rm.mx.Unlock()
+
+	id := event.Context.GetID()
+	state, exists := rm.retries[id]
+	if !exists {
+		state = &retryState{}
+		rm.retries[id] = state
+	}
+	state.attempts++
+
+	permanent := !rm.classifier(err)
+	if permanent || (rm.policy.MaxAttempts > 0 && state.attempts >= rm.policy.MaxAttempts) {
+		logger.ErrorMessage(
+			"RetryManager.Failed(): Giving up on event with id %s after %d attempts (permanent error: %t): %s",
+			id, state.attempts, permanent, err.Error(),
+		)
+		delete(rm.retries, id)
+
+		if rm.deadLetters != nil {
+			rm.deadLetters.Add(DeadLetter{
+				Event:     event,
+				Error:     err.Error(),
+				Attempts:  state.attempts,
+				Permanent: permanent,
+				Timestamp: time.Now(),
+			})
+		}
+		return false
+	}
+
+	state.nextRetryAt = time.Now().Add(rm.backoff(state.attempts + state.deferrals))
+	return true
+}
+
+// Records a failure to publish the event with the
+// given id that was not due to the event itself,
+// such as a loss of connectivity. The event backs
+// off as it would after a failed attempt but the
+// failure does not count towards the policy's
+// maximum attempts so the event is never given up
+// on.
+func (rm *RetryManager) Deferred(id string) {
+	rm.mx.Lock()
+	defer rm.mx.Unlock()
+
+	state, exists := rm.retries[id]
+	if !exists {
+		state = &retryState{}
+		rm.retries[id] = state
+	}
+	state.deferrals++
+	state.nextRetryAt = time.Now().Add(rm.backoff(state.attempts + state.deferrals))
+}
+
+// Clears the retry state of the events with the
+// given ids once they have been published.
+func (rm *RetryManager) Succeeded(ids ...string) {
+	rm.mx.Lock()
+	defer rm.mx.Unlock()
+
+	for _, id := range ids {
+		delete(rm.retries, id)
+	}
+}
+
+// Returns whether the event with the given id
+// is due to be published. Events that have not
+// failed are always ready.
+func (rm *RetryManager) IsReady(id string) bool {
+	rm.mx.Lock()
+	defer rm.mx.Unlock()
+
+	if state, exists := rm.retries[id]; exists {
+		return !time.Now().Before(state.nextRetryAt)
+	}
+	return true
+}
+
+// Returns the number of failed attempts
+// to publish the event with the given id.
+func (rm *RetryManager) Attempts(id string) int {
+	rm.mx.Lock()
+	defer rm.mx.Unlock()
+
+	if state, exists := rm.retries[id]; exists {
+		return state.attempts
+	}
+	return 0
+}
+
+func (rm *RetryManager) backoff(attempts int) time.Duration {
+
+	maxBackoff := float64(maxRetryBackoff)
+	if rm.policy.MaxBackoff > 0 && rm.policy.MaxBackoff < maxRetryBackoff {
+		maxBackoff = float64(rm.policy.MaxBackoff)
+	}
+	// the backoff grows beyond the range of a
+	// duration after many attempts so it is
+	// clamped before it is converted
+	clamp := func(backoff float64) float64 {
+		if math.IsNaN(backoff) || backoff > maxBackoff {
+			return maxBackoff
+		}
+		return math.Max(backoff, 0)
+	}
+
+	backoff := float64(rm.policy.InitialBackoff)
+	if rm.policy.Multiplier > 1 {
+		backoff *= math.Pow(rm.policy.Multiplier, float64(attempts-1))
+	}
+	backoff = clamp(backoff)
+	if rm.policy.Jitter > 0 {
+		backoff = clamp(backoff + backoff*rm.policy.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(backoff)
+}
+
+// DeadLetter is an event that will no
+// longer be retried along with the last
+// error returned when publishing it.
+type DeadLetter struct {
+	Event     *cloudevents.Event
+	Error     string
+	Attempts  int
+	Permanent bool
+	Timestamp time.Time
+}
+
+// DeadLetterStore retains events that failed to
+// publish so they can be inspected or requeued.
+type DeadLetterStore struct {
+	maxSize int
+	letters []DeadLetter
+
+	mx sync.Mutex
+}
+
+// Returns a dead-letter store that retains at most
+// 'maxSize' events discarding the oldest events once
+// full. A size of 0 means no limit.
+func NewDeadLetterStore(maxSize int) *DeadLetterStore {
+	return &DeadLetterStore{
+		maxSize: maxSize,
+		letters: []DeadLetter{},
+	}
+}
+
+func (s *DeadLetterStore) Add(letter DeadLetter) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.letters = append(s.letters, letter)
+	if s.maxSize > 0 && len(s.letters) > s.maxSize {
+		s.letters = s.letters[len(s.letters)-s.maxSize:]
+	}
+}
+
+// Returns a copy of all events in the store
+func (s *DeadLetterStore) List() []DeadLetter {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	letters := make([]DeadLetter, len(s.letters))
+	copy(letters, s.letters)
+	return letters
+}
+
+func (s *DeadLetterStore) Len() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return len(s.letters)
+}
+
+// Removes the event with the given id and
+// returns it. Returns nil if not found.
+func (s *DeadLetterStore) Remove(id string) *DeadLetter {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for i, letter := range s.letters {
+		if letter.Event.Context.GetID() == id {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+			return &letter
+		}
+	}
+	return nil
+}
+
+// Removes and returns all events in the store
+func (s *DeadLetterStore) Drain() []DeadLetter {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	letters := s.letters
+	s.letters = []DeadLetter{}
+	return letters
+}
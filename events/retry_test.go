@@ -0,0 +1,198 @@
+package events_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry Manager", func() {
+
+	var (
+		cloudEvents []*cloudevents.Event
+	)
+
+	BeforeEach(func() {
+		cloudEvents = []*cloudevents.Event{}
+		for _, e := range testEvents {
+			event := cloudevents.NewEvent()
+			err := json.Unmarshal([]byte(e), &event)
+			Expect(err).NotTo(HaveOccurred())
+			cloudEvents = append(cloudEvents, &event)
+		}
+	})
+
+	It("classifies errors as retryable or permanent", func() {
+		Expect(events.DefaultErrorClassifier(errors.New("connection reset by peer"))).To(BeTrue())
+		Expect(events.DefaultErrorClassifier(errors.New("service unavailable"))).To(BeTrue())
+		Expect(events.DefaultErrorClassifier(events.ErrEventTooLarge)).To(BeFalse())
+		Expect(events.DefaultErrorClassifier(events.CloudEventError{Error: events.ErrEventTooLarge.Error()}.Err())).To(BeFalse())
+		Expect(events.DefaultErrorClassifier(&events.DecodeError{Err: events.ErrInvalidEvent})).To(BeFalse())
+
+		// errors that know whether they are retryable are
+		// not classified by their message. i.e. an expired
+		// session key while the client re-authenticates.
+		Expect(events.DefaultErrorClassifier(&retryableError{message: "invalid session key", retryable: true})).To(BeTrue())
+		Expect(events.DefaultErrorClassifier(fmt.Errorf("post failed: %w", &retryableError{message: "conflict"}))).To(BeFalse())
+		Expect(events.DefaultErrorClassifier(&events.StatusError{StatusCode: http.StatusUnauthorized, Message: "invalid token"})).To(BeTrue())
+		Expect(events.DefaultErrorClassifier(&events.StatusError{StatusCode: http.StatusServiceUnavailable})).To(BeTrue())
+		Expect(events.DefaultErrorClassifier(&events.StatusError{StatusCode: http.StatusBadRequest})).To(BeFalse())
+
+		// messages are only matched when opted in
+		Expect(events.DefaultErrorClassifier(errors.New("Invalid event payload"))).To(BeTrue())
+		classifier := events.NewMessageErrorClassifier()
+		Expect(classifier(errors.New("Invalid event payload"))).To(BeFalse())
+		Expect(classifier(errors.New("unable to unmarshal data"))).To(BeFalse())
+		Expect(classifier(errors.New("service unavailable"))).To(BeTrue())
+		Expect(classifier(&retryableError{message: "invalid session key", retryable: true})).To(BeTrue())
+		Expect(events.NewMessageErrorClassifier("busy")(errors.New("Service Busy"))).To(BeFalse())
+	})
+
+	It("clamps the backoff after many attempts", func() {
+
+		rm := events.NewRetryManager(
+			events.RetryPolicy{
+				InitialBackoff: time.Second,
+				Multiplier:     10,
+				Jitter:         0.2,
+			},
+			nil, nil,
+		)
+		event := cloudEvents[0]
+		for i := 0; i < 1000; i++ {
+			Expect(rm.Failed(event, errors.New("timeout"))).To(BeTrue())
+		}
+		Expect(rm.IsReady(event.ID())).To(BeFalse())
+
+		rm = events.NewRetryManager(
+			events.RetryPolicy{
+				InitialBackoff: 10 * time.Millisecond,
+				MaxBackoff:     50 * time.Millisecond,
+				Multiplier:     10,
+				Jitter:         0.5,
+			},
+			nil, nil,
+		)
+		for i := 0; i < 1000; i++ {
+			Expect(rm.Failed(event, errors.New("timeout"))).To(BeTrue())
+		}
+		Expect(rm.IsReady(event.ID())).To(BeFalse())
+		time.Sleep(60 * time.Millisecond)
+		Expect(rm.IsReady(event.ID())).To(BeTrue())
+	})
+
+	It("backs off retries and dead-letters events that exhaust their attempts", func() {
+
+		deadLetters := events.NewDeadLetterStore(0)
+		rm := events.NewRetryManager(
+			events.RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: 50 * time.Millisecond,
+				MaxBackoff:     80 * time.Millisecond,
+				Multiplier:     2,
+			},
+			nil,
+			deadLetters,
+		)
+
+		event := cloudEvents[0]
+		Expect(rm.IsReady(event.ID())).To(BeTrue())
+
+		Expect(rm.Failed(event, errors.New("timeout"))).To(BeTrue())
+		Expect(rm.Attempts(event.ID())).To(Equal(1))
+		Expect(rm.IsReady(event.ID())).To(BeFalse())
+		time.Sleep(60 * time.Millisecond)
+		Expect(rm.IsReady(event.ID())).To(BeTrue())
+
+		// backoff is capped at 80ms
+		Expect(rm.Failed(event, errors.New("timeout"))).To(BeTrue())
+		time.Sleep(60 * time.Millisecond)
+		Expect(rm.IsReady(event.ID())).To(BeFalse())
+		time.Sleep(30 * time.Millisecond)
+		Expect(rm.IsReady(event.ID())).To(BeTrue())
+
+		Expect(rm.Failed(event, errors.New("timeout"))).To(BeFalse())
+		Expect(rm.Attempts(event.ID())).To(Equal(0))
+		Expect(deadLetters.Len()).To(Equal(1))
+
+		letter := deadLetters.List()[0]
+		Expect(letter.Event).To(Equal(event))
+		Expect(letter.Attempts).To(Equal(3))
+		Expect(letter.Permanent).To(BeFalse())
+	})
+
+	It("backs off deferred events without counting them as attempts", func() {
+
+		deadLetters := events.NewDeadLetterStore(0)
+		rm := events.NewRetryManager(
+			events.RetryPolicy{
+				MaxAttempts:    2,
+				InitialBackoff: 50 * time.Millisecond,
+			},
+			nil,
+			deadLetters,
+		)
+
+		event := cloudEvents[0]
+		for i := 0; i < 3; i++ {
+			rm.Deferred(event.ID())
+			Expect(rm.IsReady(event.ID())).To(BeFalse())
+			Expect(rm.Attempts(event.ID())).To(Equal(0))
+		}
+		time.Sleep(60 * time.Millisecond)
+		Expect(rm.IsReady(event.ID())).To(BeTrue())
+
+		// only failed attempts exhaust the policy
+		Expect(rm.Failed(event, errors.New("timeout"))).To(BeTrue())
+		Expect(rm.Failed(event, errors.New("timeout"))).To(BeFalse())
+		Expect(deadLetters.Len()).To(Equal(1))
+		Expect(deadLetters.List()[0].Attempts).To(Equal(2))
+	})
+
+	It("dead-letters events with permanent errors immediately", func() {
+
+		deadLetters := events.NewDeadLetterStore(2)
+		rm := events.NewRetryManager(events.DefaultRetryPolicy, nil, deadLetters)
+
+		Expect(rm.Failed(cloudEvents[1], errors.New("timeout"))).To(BeTrue())
+		rm.Succeeded(cloudEvents[1].ID())
+		Expect(rm.IsReady(cloudEvents[1].ID())).To(BeTrue())
+
+		for _, event := range cloudEvents {
+			Expect(rm.Failed(event, &events.DecodeError{Err: events.ErrInvalidEvent})).To(BeFalse())
+		}
+		Expect(deadLetters.Len()).To(Equal(2))
+
+		letters := deadLetters.List()
+		Expect(letters[0].Event).To(Equal(cloudEvents[3]))
+		Expect(letters[0].Permanent).To(BeTrue())
+		Expect(letters[0].Attempts).To(Equal(1))
+
+		letter := deadLetters.Remove(cloudEvents[4].ID())
+		Expect(letter).NotTo(BeNil())
+		Expect(deadLetters.Remove(cloudEvents[4].ID())).To(BeNil())
+		Expect(len(deadLetters.Drain())).To(Equal(1))
+		Expect(deadLetters.Len()).To(Equal(0))
+	})
+})
+
+type retryableError struct {
+	message   string
+	retryable bool
+}
+
+func (e *retryableError) Error() string {
+	return e.message
+}
+
+func (e *retryableError) IsRetryable() bool {
+	return e.retryable
+}
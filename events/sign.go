@@ -0,0 +1,199 @@
+package events
+
+import (
+	gocrypto "crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/mevansam/goutils/crypto"
+)
+
+// PayloadSigner creates a detached signature
+// of an encoded event payload.
+type PayloadSigner interface {
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+}
+
+// PayloadVerifier verifies a detached
+// signature of an encoded event payload.
+type PayloadVerifier interface {
+	Algorithm() string
+	Verify(data, signature []byte) error
+}
+
+// RSASSA-PSS with SHA-256
+const SignatureAlgorithmPS256 = "PS256"
+
+var (
+	ErrMissingSignature = errors.New("publish data input is not signed")
+	ErrInvalidSignature = errors.New("publish data input signature is invalid")
+)
+
+// fields of a publish data input covered by its
+// signature. they are signed as the json encoding
+// of this struct so a receiver can reproduce the
+// signed bytes from the input's fields.
+type signedPublishData struct {
+	Type       string `json:"type"`
+	Compressed bool   `json:"compressed"`
+	Codec      string `json:"codec"`
+	Encrypted  bool   `json:"encrypted"`
+	Payload    string `json:"payload"`
+}
+
+type rsaSigner struct {
+	key *rsa.PrivateKey
+}
+
+type rsaVerifier struct {
+	key *rsa.PublicKey
+}
+
+// Returns a signer for the given PEM encoded RSA
+// private key. This should be the device's RSA
+// key, which is the same key the mycsnode API
+// client authenticates with, so that the receiver
+// can verify the event originated from a
+// registered device.
+func NewRSAPayloadSigner(privateKeyPEM string) (PayloadSigner, error) {
+
+	var (
+		err error
+
+		rsaKey *crypto.RSAKey
+	)
+
+	if rsaKey, err = crypto.NewRSAKeyFromPEM(privateKeyPEM, nil); err != nil {
+		return nil, err
+	}
+	return NewRSAKeyPayloadSigner(rsaKey)
+}
+
+// Returns a signer for the given RSA key such as
+// the key the mycsnode API client was created with.
+func NewRSAKeyPayloadSigner(rsaKey *crypto.RSAKey) (PayloadSigner, error) {
+	if rsaKey == nil || rsaKey.PrivateKey() == nil {
+		return nil, fmt.Errorf("rsa key does not have a private key")
+	}
+	return &rsaSigner{key: rsaKey.PrivateKey()}, nil
+}
+
+// Returns a verifier for the given PEM
+// encoded RSA public key.
+func NewRSAPayloadVerifier(publicKeyPEM string) (PayloadVerifier, error) {
+
+	var (
+		err error
+		ok  bool
+
+		key    interface{}
+		rsaKey *rsa.PublicKey
+	)
+
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("unable to decode PEM encoded public key")
+	}
+	if rsaKey, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+		if rsaKey, ok = key.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("public key is not an RSA key")
+		}
+	}
+	return &rsaVerifier{key: rsaKey}, nil
+}
+
+func (s *rsaSigner) Algorithm() string {
+	return SignatureAlgorithmPS256
+}
+
+func (s *rsaSigner) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return rsa.SignPSS(rand.Reader, s.key, gocrypto.SHA256, digest[:], nil)
+}
+
+func (v *rsaVerifier) Algorithm() string {
+	return SignatureAlgorithmPS256
+}
+
+func (v *rsaVerifier) Verify(data, signature []byte) error {
+	digest := sha256.Sum256(data)
+	return rsa.VerifyPSS(v.key, gocrypto.SHA256, digest[:], signature, nil)
+}
+
+// Signs the encoded payload of the given publish data
+// input along with the type, compression, codec and
+// encryption flags that determine how it is decoded
+// and adds the detached signature to it.
+func SignPublishDataInput(dataPayload *PublishDataInput, signer PayloadSigner) error {
+
+	var (
+		err error
+
+		data, signature []byte
+	)
+
+	if data, err = signedData(dataPayload); err != nil {
+		return err
+	}
+	if signature, err = signer.Sign(data); err != nil {
+		return err
+	}
+	dataPayload.Signature = base64.StdEncoding.EncodeToString(signature)
+	dataPayload.SignatureAlgorithm = signer.Algorithm()
+	return nil
+}
+
+// Verifies the detached signature of the given
+// publish data input's payload and the fields
+// that determine how it is decoded.
+func VerifyPublishDataInput(dataPayload *PublishDataInput, verifier PayloadVerifier) error {
+
+	var (
+		err error
+
+		data, signature []byte
+	)
+
+	if len(dataPayload.Signature) == 0 {
+		return ErrMissingSignature
+	}
+	if dataPayload.SignatureAlgorithm != verifier.Algorithm() {
+		return fmt.Errorf(
+			"%w: unsupported algorithm '%s'",
+			ErrInvalidSignature, dataPayload.SignatureAlgorithm,
+		)
+	}
+	if signature, err = base64.StdEncoding.DecodeString(dataPayload.Signature); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err.Error())
+	}
+	if data, err = signedData(dataPayload); err != nil {
+		return err
+	}
+	if err = verifier.Verify(data, signature); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err.Error())
+	}
+	return nil
+}
+
+// returns the bytes of the given publish
+// data input that are covered by its signature
+func signedData(dataPayload *PublishDataInput) ([]byte, error) {
+	return json.Marshal(&signedPublishData{
+		Type:       dataPayload.Type,
+		Compressed: dataPayload.Compressed,
+		Codec:      dataPayload.Codec,
+		Encrypted:  dataPayload.Encrypted,
+		Payload:    dataPayload.Payload,
+	})
+}
@@ -0,0 +1,131 @@
+package events_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mevansam/goutils/crypto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signing", func() {
+
+	var (
+		event cloudevents.Event
+
+		signer   events.PayloadSigner
+		verifier events.PayloadVerifier
+	)
+
+	BeforeEach(func() {
+		event = cloudevents.NewEvent()
+		err := json.Unmarshal([]byte(testEvents[0]), &event)
+		Expect(err).NotTo(HaveOccurred())
+
+		privateKeyPEM, publicKeyPEM := newRSAKeyPEM()
+		signer, err = events.NewRSAPayloadSigner(privateKeyPEM)
+		Expect(err).NotTo(HaveOccurred())
+		verifier, err = events.NewRSAPayloadVerifier(publicKeyPEM)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("signs encoded payloads and verifies them", func() {
+
+		encoder, err := events.NewPayloadEncoder(events.CodecZlib, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		dataPayload, err := encoder.WithSigner(signer).Encode(&event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataPayload.Signature).NotTo(BeEmpty())
+		Expect(dataPayload.SignatureAlgorithm).To(Equal(events.SignatureAlgorithmPS256))
+
+		err = events.VerifyPublishDataInput(dataPayload, verifier)
+		Expect(err).NotTo(HaveOccurred())
+
+		// encoder without signer does not sign
+		dataPayload, err = encoder.Encode(&event)
+		Expect(err).NotTo(HaveOccurred())
+		err = events.VerifyPublishDataInput(dataPayload, verifier)
+		Expect(errors.Is(err, events.ErrMissingSignature)).To(BeTrue())
+	})
+
+	It("rejects tampered payloads and signatures from other keys", func() {
+
+		dataPayload, err := events.NewPublishDataInput(&event)
+		Expect(err).NotTo(HaveOccurred())
+		err = events.SignPublishDataInput(dataPayload, signer)
+		Expect(err).NotTo(HaveOccurred())
+
+		tamperedPayload := *dataPayload
+		tamperedPayload.Payload = tamperedPayload.Payload[1:]
+		err = events.VerifyPublishDataInput(&tamperedPayload, verifier)
+		Expect(errors.Is(err, events.ErrInvalidSignature)).To(BeTrue())
+
+		// the fields that determine how the
+		// payload is decoded are also signed
+		for _, tamper := range []func(p *events.PublishDataInput){
+			func(p *events.PublishDataInput) { p.Type = "other" },
+			func(p *events.PublishDataInput) { p.Compressed = !p.Compressed },
+			func(p *events.PublishDataInput) { p.Codec = events.CodecGzip },
+			func(p *events.PublishDataInput) { p.Encrypted = !p.Encrypted },
+		} {
+			tamperedPayload = *dataPayload
+			tamper(&tamperedPayload)
+			err = events.VerifyPublishDataInput(&tamperedPayload, verifier)
+			Expect(errors.Is(err, events.ErrInvalidSignature)).To(BeTrue())
+		}
+		err = events.VerifyPublishDataInput(dataPayload, verifier)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, otherPublicKeyPEM := newRSAKeyPEM()
+		otherVerifier, err := events.NewRSAPayloadVerifier(otherPublicKeyPEM)
+		Expect(err).NotTo(HaveOccurred())
+		err = events.VerifyPublishDataInput(dataPayload, otherVerifier)
+		Expect(errors.Is(err, events.ErrInvalidSignature)).To(BeTrue())
+	})
+
+	It("signs payloads with the rsa key the api client authenticates with", func() {
+
+		privateKeyPEM, publicKeyPEM := newRSAKeyPEM()
+		rsaKey, err := crypto.NewRSAKeyFromPEM(privateKeyPEM, nil)
+		Expect(err).NotTo(HaveOccurred())
+		keySigner, err := events.NewRSAKeyPayloadSigner(rsaKey)
+		Expect(err).NotTo(HaveOccurred())
+		keyVerifier, err := events.NewRSAPayloadVerifier(publicKeyPEM)
+		Expect(err).NotTo(HaveOccurred())
+
+		dataPayload, err := events.NewPublishDataInput(&event)
+		Expect(err).NotTo(HaveOccurred())
+		err = events.SignPublishDataInput(dataPayload, keySigner)
+		Expect(err).NotTo(HaveOccurred())
+		err = events.VerifyPublishDataInput(dataPayload, keyVerifier)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = events.NewRSAKeyPayloadSigner(nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func newRSAKeyPEM() (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	return string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})),
+		string(pem.EncodeToMemory(&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: publicKey,
+		}))
+}
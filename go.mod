@@ -20,6 +20,7 @@ require (
 	github.com/go-multierror/multierror v1.0.2
 	github.com/google/uuid v1.3.0
 	github.com/huin/goupnp v1.1.0
+	github.com/klauspost/compress v1.15.4
 	github.com/mevansam/gocloud v0.0.2
 	github.com/mevansam/goutils v0.0.3
 	github.com/mitchellh/go-homedir v1.1.0
@@ -32,6 +33,7 @@ require (
 	golang.org/x/sys v0.10.0
 	golang.zx2c4.com/wireguard v0.0.0-20230704135630-469159ecf7d1
 	golang.zx2c4.com/wireguard/wgctrl v0.0.0-20230429144221-925a1e7659e6
+	google.golang.org/protobuf v1.30.0
 	tailscale.com v0.0.0-00010101000000-000000000000
 )
 
@@ -105,7 +107,6 @@ require (
 	github.com/jsimonetti/rtnetlink v1.1.2-0.20220408201609-d380b505068b // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/karrick/godirwalk v1.16.1 // indirect
-	github.com/klauspost/compress v1.15.4 // indirect
 	github.com/kortschak/wol v0.0.0-20200729010619-da482cc4850a // indirect
 	github.com/kr/pretty v0.3.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
@@ -175,7 +176,6 @@ require (
 	google.golang.org/genproto/googleapis/api v0.0.0-20230530153820-e85fd2cbaebc // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20230530153820-e85fd2cbaebc // indirect
 	google.golang.org/grpc v1.55.0 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/ini.v1 v1.66.4 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
@@ -0,0 +1,314 @@
+package monitors
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// AlertCondition is the condition of a metric
+// that causes an alert rule to fire
+type AlertCondition int
+
+const (
+	// the metric's value is above the threshold
+	AlertAbove AlertCondition = iota
+	// the metric's value is below the threshold
+	AlertBelow
+	// the metric's per second rate of change
+	// is above the threshold
+	AlertRateAbove
+	// the metric's change between collections
+	// is not more than the threshold
+	AlertStalled
+)
+
+func (c AlertCondition) String() string {
+	switch c {
+	case AlertAbove:
+		return "above"
+	case AlertBelow:
+		return "below"
+	case AlertRateAbove:
+		return "rateAbove"
+	case AlertStalled:
+		return "stalled"
+	}
+	return "unknown"
+}
+
+// Alert describes a transition of an alert
+// rule to the firing or resolved state
+type Alert struct {
+	Rule      string
+	Monitor   string
+	Metric    string
+	Condition AlertCondition
+
+	Firing    bool
+	Value     float64
+	Threshold float64
+
+	Timestamp time.Time
+}
+
+type AlertCallback func(alert Alert)
+
+// AlertRule is evaluated against a metric each time
+// the monitor service collects snapshots. The rule
+// fires once its condition has held for a number of
+// consecutive collections and is resolved once the
+// metric's value has moved back to the threshold or
+// past it by the rule's hysteresis.
+type AlertRule struct {
+	name      string
+	source    MetricSource
+	condition AlertCondition
+	threshold float64
+
+	hysteresis float64
+	intervals  int
+
+	callbacks []AlertCallback
+}
+
+// evaluation state of a rule added to a monitor
+type alertEvaluator struct {
+	rule *AlertRule
+
+	firing bool
+	// number of consecutive collections
+	// for which the condition held
+	matched int
+
+	// source total and time in milliseconds
+	// at the previous evaluation
+	hasTotal      bool
+	lastTotal     float64
+	lastTimestamp int64
+}
+
+// Returns a rule with the given name that fires when
+// the given condition of the source metric is met.
+func NewAlertRule(
+	name string,
+	source MetricSource,
+	condition AlertCondition,
+	threshold float64,
+) *AlertRule {
+
+	return &AlertRule{
+		name:      name,
+		source:    source,
+		condition: condition,
+		threshold: threshold,
+
+		intervals: 1,
+	}
+}
+
+// Returns a copy of the rule that is resolved only
+// once the metric has moved back past the threshold
+// by at least the given margin.
+func (r *AlertRule) WithHysteresis(hysteresis float64) *AlertRule {
+	rr := *r
+	rr.hysteresis = hysteresis
+	return &rr
+}
+
+// Returns a copy of the rule that fires only if the
+// condition holds for the given number of consecutive
+// collections.
+func (r *AlertRule) WithIntervals(intervals int) *AlertRule {
+	rr := *r
+	if intervals < 1 {
+		intervals = 1
+	}
+	rr.intervals = intervals
+	return &rr
+}
+
+// Returns a copy of the rule that calls the given
+// callback when the rule fires or is resolved.
+func (r *AlertRule) WithCallback(callback AlertCallback) *AlertRule {
+	rr := *r
+	rr.callbacks = append(append([]AlertCallback{}, r.callbacks...), callback)
+	return &rr
+}
+
+func (r *AlertRule) Name() string {
+	return r.name
+}
+
+// Adds a rule that is evaluated with every collection.
+// Transitions of the rule are posted as alert events
+// via the monitor service.
+func (m *Monitor) AddAlertRule(rule *AlertRule) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.alerts = append(m.alerts, &alertEvaluator{rule: rule})
+}
+
+func (m *Monitor) DeleteAlertRule(rule *AlertRule) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, a := range m.alerts {
+		if a.rule == rule {
+			m.alerts = append(m.alerts[:i], m.alerts[i+1:]...)
+			break
+		}
+	}
+}
+
+// evaluates all alert rules and queues events for the
+// rules that fired or were resolved. the transitions
+// are returned so their callbacks can be called once
+// the service lock has been released.
+func (ms *MonitorService) evaluateAlerts() []alertTransition {
+
+	var (
+		err error
+
+		event *cloudevents.Event
+	)
+
+	transitions := []alertTransition{}
+	for _, m := range ms.monitors {
+		// rules may be added and deleted concurrently
+		// so they are evaluated from a copy
+		m.lock.Lock()
+		alertEvaluators := append([]*alertEvaluator{}, m.alerts...)
+		m.lock.Unlock()
+
+		for _, a := range alertEvaluators {
+			alert, transitioned := a.evaluate(m.name)
+			if !transitioned {
+				continue
+			}
+			transitions = append(transitions, alertTransition{a.rule, alert})
+
+			eventType := events.AlertResolvedEventType
+			subject := fmt.Sprintf("Alert %s Resolved", alert.Rule)
+			if alert.Firing {
+				eventType = events.AlertFiringEventType
+				subject = fmt.Sprintf("Alert %s Firing", alert.Rule)
+			}
+			event, err = events.NewLifecycleEvent(eventType, subject, &events.AlertData{
+				Rule:      alert.Rule,
+				Monitor:   alert.Monitor,
+				Metric:    alert.Metric,
+				Condition: alert.Condition.String(),
+				Firing:    alert.Firing,
+				Value:     alert.Value,
+				Threshold: alert.Threshold,
+				Timestamp: alert.Timestamp,
+			})
+			if err != nil {
+				logger.ErrorMessage(
+					"monitorService.evaluateAlerts(): Unable to create event for alert %s: %s",
+					alert.Rule, err.Error(),
+				)
+				continue
+			}
+			ms.queueEvent(event)
+		}
+	}
+	return transitions
+}
+
+type alertTransition struct {
+	rule  *AlertRule
+	alert Alert
+}
+
+// calls the callbacks of the given transitions
+func notifyAlerts(transitions []alertTransition) {
+	for _, t := range transitions {
+		for _, callback := range t.rule.callbacks {
+			callback(t.alert)
+		}
+	}
+}
+
+// evaluates the rule against the current value of
+// its source and returns whether the rule fired or
+// was resolved
+func (a *alertEvaluator) evaluate(monitorName string) (Alert, bool) {
+
+	rule := a.rule
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	_, total := rule.source.sample(a.lastTotal)
+	hasTotal, lastTotal, lastTimestamp := a.hasTotal, a.lastTotal, a.lastTimestamp
+	a.hasTotal = true
+	a.lastTotal = total
+	a.lastTimestamp = timestamp
+
+	// value compared with the threshold and whether it
+	// matches the condition or is clear of the threshold
+	// by the hysteresis. a value at the threshold does
+	// not match so it clears a rule without hysteresis.
+	var (
+		value            float64
+		matches, cleared bool
+	)
+	switch rule.condition {
+	case AlertAbove:
+		value = total
+		matches = value > rule.threshold
+		cleared = value <= rule.threshold-rule.hysteresis
+	case AlertBelow:
+		value = total
+		matches = value < rule.threshold
+		cleared = value >= rule.threshold+rule.hysteresis
+	case AlertRateAbove:
+		if !hasTotal || timestamp <= lastTimestamp {
+			return Alert{}, false
+		}
+		value = (total - lastTotal) * 1000 / float64(timestamp-lastTimestamp)
+		matches = value > rule.threshold
+		cleared = value <= rule.threshold-rule.hysteresis
+	case AlertStalled:
+		if !hasTotal {
+			return Alert{}, false
+		}
+		value = total - lastTotal
+		if value < 0 {
+			value = -value
+		}
+		matches = value <= rule.threshold
+		cleared = value > rule.threshold+rule.hysteresis
+	}
+
+	transitioned := false
+	if matches {
+		a.matched++
+		if !a.firing && a.matched >= rule.intervals {
+			a.firing = true
+			transitioned = true
+		}
+	} else {
+		a.matched = 0
+		if a.firing && cleared {
+			a.firing = false
+			transitioned = true
+		}
+	}
+	return Alert{
+		Rule:      rule.name,
+		Monitor:   monitorName,
+		Metric:    rule.source.Name(),
+		Condition: rule.condition,
+
+		Firing:    a.firing,
+		Value:     value,
+		Threshold: rule.threshold,
+
+		Timestamp: time.UnixMilli(timestamp),
+	}, transitioned
+}
@@ -0,0 +1,178 @@
+package monitors_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	"github.com/appbricks/mycloudspace-common/monitors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Alerts", func() {
+
+	var (
+		err error
+
+		rs     *recordingSender
+		msvc   *monitors.MonitorService
+		alerts []monitors.Alert
+	)
+
+	BeforeEach(func() {
+		rs = &recordingSender{}
+		msvc = monitors.NewMonitorService(rs, 1, 100)
+		alerts = []monitors.Alert{}
+	})
+
+	callback := func(alert monitors.Alert) {
+		alerts = append(alerts, alert)
+		// callbacks are called without the
+		// monitor service's lock held
+		msvc.NewMonitor("callback")
+	}
+
+	It("fires and resolves a threshold alert with hysteresis", func() {
+
+		usage := monitors.NewCounter("usage", false, false)
+		monitor := msvc.NewMonitor("space-vpn")
+		monitor.AddCounter(usage)
+		monitor.AddAlertRule(
+			monitors.NewAlertRule("allowance", usage, monitors.AlertAbove, 90).
+				WithHysteresis(10).
+				WithCallback(callback),
+		)
+
+		// each stop collects and evaluates the rules
+		for _, value := range []int64{50, 95, 85, 75, 80} {
+			usage.Set(value)
+			msvc.Stop()
+		}
+
+		Expect(len(alerts)).To(Equal(2))
+		Expect(alerts[0].Rule).To(Equal("allowance"))
+		Expect(alerts[0].Monitor).To(Equal("space-vpn"))
+		Expect(alerts[0].Metric).To(Equal("usage"))
+		Expect(alerts[0].Firing).To(BeTrue())
+		Expect(alerts[0].Value).To(Equal(float64(95)))
+		Expect(alerts[1].Firing).To(BeFalse())
+		Expect(alerts[1].Value).To(Equal(float64(75)))
+
+		alertEvents := []events.AlertData{}
+		for _, e := range rs.events {
+			if e.Type() == events.AlertFiringEventType || e.Type() == events.AlertResolvedEventType {
+				data := events.AlertData{}
+				err = json.Unmarshal(e.Data(), &data)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(data.Firing).To(Equal(e.Type() == events.AlertFiringEventType))
+				alertEvents = append(alertEvents, data)
+			}
+		}
+		Expect(len(alertEvents)).To(Equal(2))
+		Expect(alertEvents[0].Condition).To(Equal("above"))
+		Expect(alertEvents[0].Threshold).To(Equal(float64(90)))
+		Expect(alertEvents[0].Firing).To(BeTrue())
+		Expect(alertEvents[1].Firing).To(BeFalse())
+	})
+
+	It("resolves an alert without hysteresis once the value is at the threshold", func() {
+
+		bus := events.NewBus(0)
+		defer bus.Close()
+		sub := bus.Subscribe("io.appbricks.mycs.monitor.alert-*", 10, events.DropNewest)
+		msvc.SetEventBus(bus)
+
+		usage := monitors.NewGauge("usage")
+		level := monitors.NewGauge("level")
+		monitor := msvc.NewMonitor("space-vpn")
+		monitor.AddGauge(usage)
+		monitor.AddGauge(level)
+		monitor.AddAlertRule(
+			monitors.NewAlertRule("allowance", usage, monitors.AlertAbove, 90).
+				WithCallback(callback),
+		)
+		monitor.AddAlertRule(
+			monitors.NewAlertRule("reserve", level, monitors.AlertBelow, 10).
+				WithCallback(callback),
+		)
+
+		usage.Set(95)
+		level.Set(5)
+		msvc.Stop()
+		usage.Set(90)
+		level.Set(10)
+		msvc.Stop()
+
+		Expect(len(alerts)).To(Equal(4))
+		for i, alert := range alerts {
+			Expect(alert.Firing).To(Equal(i < 2))
+		}
+		Expect(alerts[2].Value).To(Equal(float64(90)))
+		Expect(alerts[3].Value).To(Equal(float64(10)))
+
+		// alert events are published to the bus
+		Expect(len(sub.Events())).To(Equal(4))
+	})
+
+	It("fires and resolves an alert on the rate of change of a counter", func() {
+
+		sent := monitors.NewCounter("sent", true, true)
+		monitor := msvc.NewMonitor("space-vpn")
+		monitor.AddCounter(sent)
+		monitor.AddAlertRule(
+			monitors.NewAlertRule("throughput", sent, monitors.AlertRateAbove, 1000).
+				WithCallback(callback),
+		)
+
+		// a rate requires two collections
+		sent.Set(100)
+		msvc.Stop()
+		Expect(len(alerts)).To(Equal(0))
+
+		time.Sleep(200 * time.Millisecond)
+		sent.Set(700)
+		msvc.Stop()
+		Expect(len(alerts)).To(Equal(1))
+		Expect(alerts[0].Rule).To(Equal("throughput"))
+		Expect(alerts[0].Metric).To(Equal("sent"))
+		Expect(alerts[0].Condition).To(Equal(monitors.AlertRateAbove))
+		Expect(alerts[0].Firing).To(BeTrue())
+		Expect(alerts[0].Value).To(BeNumerically("~", 3000, 1000))
+
+		time.Sleep(200 * time.Millisecond)
+		sent.Set(710)
+		msvc.Stop()
+		Expect(len(alerts)).To(Equal(2))
+		Expect(alerts[1].Firing).To(BeFalse())
+		Expect(alerts[1].Value).To(BeNumerically("<", 1000))
+	})
+
+	It("fires a stalled alert once the counter has not changed for the given intervals", func() {
+
+		recd := monitors.NewCounter("recd", true, true)
+		monitor := msvc.NewMonitor("space-vpn")
+		monitor.AddCounter(recd)
+		monitor.AddAlertRule(
+			monitors.NewAlertRule("stalled", recd, monitors.AlertStalled, 0).
+				WithIntervals(2).
+				WithCallback(callback),
+		)
+
+		for _, value := range []int64{100, 100} {
+			recd.Set(value)
+			msvc.Stop()
+			Expect(len(alerts)).To(Equal(0))
+		}
+		msvc.Stop()
+		Expect(len(alerts)).To(Equal(1))
+		Expect(alerts[0].Firing).To(BeTrue())
+
+		recd.Set(200)
+		msvc.Stop()
+		Expect(len(alerts)).To(Equal(2))
+		Expect(alerts[1].Firing).To(BeFalse())
+		Expect(alerts[1].Value).To(Equal(float64(100)))
+	})
+})
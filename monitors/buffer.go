@@ -0,0 +1,358 @@
+package monitors
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// BufferPolicy determines how the monitor service
+// reduces the snapshots buffered for posting once
+// the buffer's limits have been exceeded.
+type BufferPolicy int
+
+const (
+	// the oldest snapshots are dropped
+	DropOldestSnapshots BufferPolicy = iota
+	// the most recent snapshots are dropped
+	DropNewestSnapshots
+	// adjacent snapshots are merged starting with the
+	// oldest which reduces the resolution of older
+	// metrics. snapshots already published to the event
+	// bus are only merged with each other so their data
+	// is not published again. snapshots are dropped only
+	// if there are no such snapshots to merge or a single
+	// snapshot exceeds the buffer limits.
+	MergeSnapshots
+)
+
+// name of the monitor that reports
+// the buffer's overflow counts
+const bufferMonitorName = "monitor-service"
+
+type snapshotBuffer struct {
+	maxCount,
+	maxBytes int
+	policy BufferPolicy
+
+	// internal counters of snapshots
+	// dropped or merged due to overflow
+	dropped,
+	merged *Counter
+}
+
+// Limits the number of monitor snapshots buffered for
+// posting by each sender to 'maxCount' snapshots and
+// 'maxBytes' bytes of json encoded snapshots. A limit
+// of 0 means no limit. Snapshots are reduced per the
+// given policy once a limit is exceeded and the number
+// of dropped and merged snapshots are reported in the
+// service's "monitor-service" monitor.
+func (ms *MonitorService) SetBufferLimits(maxCount, maxBytes int, policy BufferPolicy) {
+	defer ms.writeOutboxes()
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.buffer == nil {
+		ms.buffer = &snapshotBuffer{
+			dropped: NewCounter("droppedSnapshots", true, true),
+			merged:  NewCounter("mergedSnapshots", true, true),
+		}
+		monitor := ms.newMonitor(bufferMonitorName)
+		monitor.AddCounter(ms.buffer.dropped)
+		monitor.AddCounter(ms.buffer.merged)
+	}
+	ms.buffer.maxCount = maxCount
+	ms.buffer.maxBytes = maxBytes
+	ms.buffer.policy = policy
+	for _, q := range ms.senders {
+		ms.enforceBufferLimits(q)
+	}
+}
+
+// reduces the payloads buffered for the given sender
+// until they are within the buffer limits. must be
+// called with the service lock held.
+func (ms *MonitorService) enforceBufferLimits(q *senderQueue) {
+
+	b := ms.buffer
+	if b == nil || (b.maxCount == 0 && b.maxBytes == 0) {
+		return
+	}
+
+	totalBytes := 0
+	if b.maxBytes > 0 {
+		for _, ep := range q.eventPayloads {
+			totalBytes += ep.encodedSize()
+		}
+	}
+	overLimit := func() bool {
+		return (b.maxCount > 0 && len(q.eventPayloads) > b.maxCount) ||
+			(b.maxBytes > 0 && totalBytes > b.maxBytes)
+	}
+	if !overLimit() {
+		return
+	}
+
+	// ids of spooled payloads that are no
+	// longer buffered as they were dropped
+	// or merged
+	discarded := []string{}
+	mergedPayloads := make(map[*eventPayload]bool)
+	numDropped, numMerged := 0, 0
+
+	i := 0
+	for overLimit() && len(q.eventPayloads) > 0 {
+
+		if b.policy == MergeSnapshots {
+			if j := mergeablePayloads(q.eventPayloads, i); j >= 0 {
+				i = j
+				older, newer := q.eventPayloads[i], q.eventPayloads[i+1]
+				merged := mergePayloads(older, newer)
+				merged.id = uuid.NewString()
+				merged.published = older.published
+				mergedPayloads[merged] = true
+				delete(mergedPayloads, older)
+				delete(mergedPayloads, newer)
+
+				totalBytes += merged.encodedSize() - older.encodedSize() - newer.encodedSize()
+				q.eventPayloads[i] = merged
+				q.eventPayloads = append(q.eventPayloads[:i+1], q.eventPayloads[i+2:]...)
+				discarded = appendPayloadID(discarded, older, newer)
+				numMerged++
+				i++
+				continue
+			}
+		}
+
+		var drop *eventPayload
+		if b.policy == DropNewestSnapshots {
+			drop = q.eventPayloads[len(q.eventPayloads)-1]
+			q.eventPayloads = q.eventPayloads[:len(q.eventPayloads)-1]
+		} else {
+			drop = q.eventPayloads[0]
+			q.eventPayloads = q.eventPayloads[1:]
+		}
+		totalBytes -= drop.encodedSize()
+		discarded = appendPayloadID(discarded, drop)
+		delete(mergedPayloads, drop)
+		numDropped++
+	}
+
+	if numDropped > 0 {
+		logger.WarnMessage(
+			"monitorService.enforceBufferLimits(): Dropped %d snapshots for sender '%s' as the buffer limits were exceeded.",
+			numDropped, q.name,
+		)
+		b.dropped.Add(int64(numDropped))
+	}
+	if numMerged > 0 {
+		logger.DebugMessage(
+			"monitorService.enforceBufferLimits(): Merged %d snapshots for sender '%s' as the buffer limits were exceeded.",
+			numMerged, q.name,
+		)
+		b.merged.Add(int64(numMerged))
+	}
+	if q.outbox != nil && len(mergedPayloads) > 0 {
+		// merged payloads are spooled before the
+		// payloads they replace are removed
+		spooled := make([]*cloudevents.Event, 0, len(mergedPayloads))
+		for _, ep := range q.eventPayloads {
+			if mergedPayloads[ep] {
+				spooled = append(spooled, newPayloadEvent(ep))
+			}
+		}
+		ms.spoolEvents(q.outbox, spooled...)
+	}
+	if len(discarded) > 0 {
+		if q.outbox != nil {
+			ms.unspoolEvents(q.outbox, discarded...)
+		}
+		if q.retryManager != nil {
+			q.retryManager.Succeeded(discarded...)
+		}
+	}
+}
+
+// returns the index of the first payload from 'start'
+// onwards that can be merged with the payload after it
+// starting another pass from the oldest if necessary.
+// payloads are merged only if both or neither have been
+// published to the event bus as the merged payload is
+// published under a new id. returns -1 if no payloads
+// can be merged.
+func mergeablePayloads(payloads []*eventPayload, start int) int {
+	numPairs := len(payloads) - 1
+	for k := 0; k < numPairs; k++ {
+		i := (start + k) % numPairs
+		if payloads[i].published == payloads[i+1].published {
+			return i
+		}
+	}
+	return -1
+}
+
+func appendPayloadID(ids []string, payloads ...*eventPayload) []string {
+	for _, ep := range payloads {
+		if len(ep.id) > 0 {
+			ids = append(ids, ep.id)
+		}
+	}
+	return ids
+}
+
+// returns the size of the payload when encoded as json
+func (ep *eventPayload) encodedSize() int {
+	if ep.size == 0 {
+		if data, err := json.Marshal(ep); err == nil {
+			ep.size = len(data)
+		}
+	}
+	return ep.size
+}
+
+// merges two adjacent payloads into a new payload. the
+// deltas of cumalative counters and histograms are
+// summed whereas counters holding current values,
+// gauges and derived metrics other than peaks take
+// the value of the newer payload.
+func mergePayloads(older, newer *eventPayload) *eventPayload {
+
+	merged := &eventPayload{}
+	monitors := make(map[string]*monitorSnapshot)
+
+	for _, ep := range []*eventPayload{older, newer} {
+		for _, ms := range ep.Monitors {
+			m, exists := monitors[ms.Name]
+			if !exists {
+				m = &monitorSnapshot{Name: ms.Name}
+				monitors[ms.Name] = m
+				merged.Monitors = append(merged.Monitors, m)
+			}
+			for _, cs := range ms.Counters {
+				m.Counters = mergeCounterSnapshot(m.Counters, cs)
+			}
+			for _, gs := range ms.Gauges {
+				m.Gauges = mergeGaugeSnapshot(m.Gauges, gs)
+			}
+			for _, hs := range ms.Histograms {
+				m.Histograms = mergeHistogramSnapshot(m.Histograms, hs)
+			}
+			for _, ds := range ms.Derived {
+				m.Derived = mergeDerivedSnapshot(m.Derived, ds)
+			}
+		}
+	}
+	return merged
+}
+
+func mergeCounterSnapshot(snapshots []*counterSnapshot, cs *counterSnapshot) []*counterSnapshot {
+	key := snapshotKey(cs.Name, cs.Attribs)
+	for i, s := range snapshots {
+		if snapshotKey(s.Name, s.Attribs) == key && s.Cumalative == cs.Cumalative {
+			m := *cs
+			if cs.Cumalative {
+				m.Value = s.Value + cs.Value
+				m.StartTimestamp = s.StartTimestamp
+				m.Reset = s.Reset || cs.Reset
+			}
+			snapshots[i] = &m
+			return snapshots
+		}
+	}
+	m := *cs
+	return append(snapshots, &m)
+}
+
+func mergeGaugeSnapshot(snapshots []*gaugeSnapshot, gs *gaugeSnapshot) []*gaugeSnapshot {
+	key := snapshotKey(gs.Name, gs.Attribs)
+	for i, s := range snapshots {
+		if snapshotKey(s.Name, s.Attribs) == key {
+			m := *gs
+			snapshots[i] = &m
+			return snapshots
+		}
+	}
+	m := *gs
+	return append(snapshots, &m)
+}
+
+func mergeHistogramSnapshot(snapshots []*histogramSnapshot, hs *histogramSnapshot) []*histogramSnapshot {
+	key := snapshotKey(hs.Name, hs.Attribs)
+	for i, s := range snapshots {
+		if snapshotKey(s.Name, s.Attribs) == key && sameBounds(s.Bounds, hs.Bounds) {
+			m := *hs
+			m.StartTimestamp = s.StartTimestamp
+			m.Count = s.Count + hs.Count
+			m.Sum = s.Sum + hs.Sum
+			if s.Min < m.Min {
+				m.Min = s.Min
+			}
+			if s.Max > m.Max {
+				m.Max = s.Max
+			}
+			m.Counts = make([]uint64, len(hs.Counts))
+			for j := range m.Counts {
+				m.Counts[j] = s.Counts[j] + hs.Counts[j]
+			}
+			snapshots[i] = &m
+			return snapshots
+		}
+	}
+	m := *hs
+	return append(snapshots, &m)
+}
+
+func mergeDerivedSnapshot(snapshots []*derivedSnapshot, ds *derivedSnapshot) []*derivedSnapshot {
+	key := snapshotKey(ds.Name, ds.Attribs)
+	for i, s := range snapshots {
+		if snapshotKey(s.Name, s.Attribs) == key {
+			m := *ds
+			if ds.Function == PeakInWindow.String() && s.Value > m.Value {
+				// the peak of the merged windows
+				m.Value = s.Value
+			}
+			snapshots[i] = &m
+			return snapshots
+		}
+	}
+	m := *ds
+	return append(snapshots, &m)
+}
+
+// returns a key that identifies a metric
+// by its name and attributes
+func snapshotKey(name *string, attribs *map[string]string) string {
+	var key strings.Builder
+	if name != nil {
+		key.WriteString(*name)
+	}
+	if attribs != nil {
+		names := make([]string, 0, len(*attribs))
+		for n := range *attribs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			key.WriteString("|" + n + "=" + (*attribs)[n])
+		}
+	}
+	return key.String()
+}
+
+func sameBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -16,6 +16,21 @@ type Counter struct {
 	value,
 	cumalativeValue int64
 
+	// start of the period measured by the next
+	// snapshot in milliseconds. for cumalative
+	// counters this is the time of the previous
+	// snapshot as snapshot values are deltas.
+	startTimestamp int64
+
+	// reset detection of cumalative counters. a
+	// raw value that is less than the last raw
+	// value set starts a new epoch and the total
+	// of all previous epochs is kept as an offset.
+	lastRawValue,
+	epochOffset int64
+	epoch int
+	reset bool
+
 	counterLock sync.RWMutex
 }
 
@@ -24,6 +39,18 @@ type counterSnapshot struct {
 	Timestamp int64   `json:"timestamp"`
 	Value     int64   `json:"value"`
 
+	// snapshots of cumalative counters hold the change
+	// in value since the start timestamp whereas other
+	// counters hold the counter's current value
+	Cumalative     bool  `json:"cumulative,omitempty"`
+	StartTimestamp int64 `json:"startTimestamp,omitempty"`
+
+	// the source of a cumalative counter was reset
+	// since the previous snapshot. the epoch is the
+	// number of resets since the counter was created.
+	Reset bool `json:"reset,omitempty"`
+	Epoch int  `json:"epoch,omitempty"`
+
 	Attribs *map[string]string `json:"attribs,omitempty"`
 }
 
@@ -44,6 +71,8 @@ func NewCounter(
 		incBy: 1,
 		value: 0,
 		cumalativeValue: 0,
+
+		startTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
 	}
 }
 
@@ -63,6 +92,8 @@ func NewCounterWithAttribs(
 		incBy: 1,
 		value: 0,
 		cumalativeValue: 0,
+
+		startTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
 	}
 }
 
@@ -80,10 +111,18 @@ func (c *Counter) collect() *counterSnapshot {
 			Attribs:   &c.attribs,
 			Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
 			Value:     c.value,
+
+			Cumalative:     c.cumalative,
+			StartTimestamp: c.startTimestamp,
+
+			Reset: c.reset,
+			Epoch: c.epoch,
 		}
 		if c.cumalative {
 			c.cumalativeValue += c.value
 			c.value = 0	
+			c.startTimestamp = cs.Timestamp
+			c.reset = false
 		}
 		return cs	
 	}
@@ -94,6 +133,16 @@ func (c *Counter) Name() string {
 	return c.name
 }
 
+// Returns the number of times the source of a
+// cumalative counter was detected to have been
+// reset.
+func (c *Counter) Epoch() int {
+	c.counterLock.RLock()
+	defer c.counterLock.RUnlock()
+
+	return c.epoch
+}
+
 func (c *Counter) Get() int64 {
 	c.counterLock.RLock()
 	defer c.counterLock.RUnlock()
@@ -113,7 +162,15 @@ func (c *Counter) Set(value int64) {
 	defer c.counterLock.Unlock()
 
 	if c.cumalative {
-		c.value = value - c.cumalativeValue
+		if value < c.lastRawValue {
+			// the source was reset so start a new epoch
+			// that continues from the previous total
+			c.epochOffset += c.lastRawValue
+			c.epoch++
+			c.reset = true
+		}
+		c.lastRawValue = value
+		c.value = c.epochOffset + value - c.cumalativeValue
 	} else {
 	  c.value = value
 	}
@@ -0,0 +1,63 @@
+package monitors_test
+
+import (
+	"encoding/json"
+
+	"github.com/appbricks/mycloudspace-common/monitors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Counter", func() {
+
+	It("detects resets of the source of a cumalative counter", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		counter := monitors.NewCounter("bytesSent", true, true)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		// each stop collects and posts a snapshot
+		counter.Set(100)
+		msvc.Stop()
+		counter.Set(30)
+		Expect(counter.Epoch()).To(Equal(1))
+		Expect(counter.Get()).To(Equal(int64(130)))
+		msvc.Stop()
+		counter.Set(50)
+		msvc.Stop()
+		Expect(counter.Get()).To(Equal(int64(150)))
+		Expect(len(rs.events)).To(Equal(3))
+
+		type snapshot struct {
+			Monitors []struct {
+				Counters []struct {
+					Value int64 `json:"value"`
+					Reset bool  `json:"reset"`
+					Epoch int   `json:"epoch"`
+				} `json:"counters"`
+			} `json:"monitors"`
+		}
+		expected := []struct {
+			value int64
+			reset bool
+			epoch int
+		}{
+			{100, false, 0},
+			{30, true, 1},
+			{20, false, 1},
+		}
+		for i, e := range rs.events {
+			data := snapshot{}
+			err := json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+
+			cs := data.Monitors[0].Counters[0]
+			Expect(cs.Value).To(Equal(expected[i].value))
+			Expect(cs.Reset).To(Equal(expected[i].reset))
+			Expect(cs.Epoch).To(Equal(expected[i].epoch))
+		}
+	})
+})
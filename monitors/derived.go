@@ -0,0 +1,250 @@
+package monitors
+
+import (
+	"sync"
+	"time"
+)
+
+// DerivedFunction determines how a derived
+// metric is computed from its source
+type DerivedFunction int
+
+const (
+	// change in the source's value per second
+	// between consecutive collections
+	RatePerSecond DerivedFunction = iota
+	// average of the source's samples over the
+	// last N collections
+	MovingAverage
+	// largest of the source's samples since the
+	// monitor service last posted its snapshots
+	PeakInWindow
+)
+
+func (f DerivedFunction) String() string {
+	switch f {
+	case RatePerSecond:
+		return "rate"
+	case MovingAverage:
+		return "movingAverage"
+	case PeakInWindow:
+		return "peak"
+	}
+	return "unknown"
+}
+
+// MetricSource is a metric from which derived
+// metrics can be computed. Counters, gauges and
+// other derived metrics are metric sources.
+type MetricSource interface {
+	Name() string
+
+	// returns the value sampled from the source
+	// at each collection. cumalative counters
+	// are sampled as their change in value since
+	// the previous sample.
+	sample(prevTotal float64) (value, total float64)
+	// whether snapshots of the source are
+	// skipped while its value is zero
+	ignoresZeroSnapshots() bool
+}
+
+// DerivedMetric is a metric that is computed from
+// the value of another metric each time monitor
+// snapshots are collected and is included in the
+// snapshot along with its source.
+type DerivedMetric struct {
+	name     string
+	attribs  map[string]string
+	source   MetricSource
+	function DerivedFunction
+
+	// number of samples in a moving average
+	window  int
+	samples []float64
+
+	value float64
+	// whether a peak has been sampled
+	// in the current send window
+	isSet bool
+	// whether the last snapshot collected
+	// was of a non-zero value
+	nonZeroCollected bool
+
+	// source total and time in milliseconds
+	// at the previous collection
+	hasTotal      bool
+	lastTotal     float64
+	lastTimestamp int64
+
+	derivedLock sync.RWMutex
+}
+
+type derivedSnapshot struct {
+	Name      *string `json:"name"`
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+
+	Source   string `json:"source"`
+	Function string `json:"function"`
+
+	Attribs *map[string]string `json:"attribs,omitempty"`
+}
+
+// Returns a metric with the per second rate of
+// change of the given source. i.e. bytes/sec of a
+// cumalative counter of bytes sent.
+func NewRateMetric(name string, source MetricSource) *DerivedMetric {
+	return newDerivedMetric(name, source, RatePerSecond, 0)
+}
+
+// Returns a metric with the average of the samples
+// of the given source over the last 'window'
+// collections.
+func NewMovingAverageMetric(name string, source MetricSource, window int) *DerivedMetric {
+	if window < 1 {
+		window = 1
+	}
+	return newDerivedMetric(name, source, MovingAverage, window)
+}
+
+// Returns a metric with the peak sample of the
+// given source within each send window of the
+// monitor service.
+func NewPeakMetric(name string, source MetricSource) *DerivedMetric {
+	return newDerivedMetric(name, source, PeakInWindow, 0)
+}
+
+func newDerivedMetric(
+	name string,
+	source MetricSource,
+	function DerivedFunction,
+	window int,
+) *DerivedMetric {
+
+	return &DerivedMetric{
+		name:     name,
+		attribs:  map[string]string{},
+		source:   source,
+		function: function,
+
+		window:  window,
+		samples: make([]float64, 0, window),
+	}
+}
+
+func (d *DerivedMetric) AddAttribute(name, value string) {
+	d.attribs[name] = value
+}
+
+func (d *DerivedMetric) Name() string {
+	return d.name
+}
+
+func (d *DerivedMetric) Get() float64 {
+	d.derivedLock.RLock()
+	defer d.derivedLock.RUnlock()
+
+	return d.value
+}
+
+// computes the metric from a new sample of its
+// source and returns a snapshot of its value
+func (d *DerivedMetric) collect() *derivedSnapshot {
+	d.derivedLock.Lock()
+	defer d.derivedLock.Unlock()
+
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	value, total := d.source.sample(d.lastTotal)
+	hasTotal, lastTotal, lastTimestamp := d.hasTotal, d.lastTotal, d.lastTimestamp
+	d.hasTotal = true
+	d.lastTotal = total
+	d.lastTimestamp = timestamp
+
+	switch d.function {
+	case RatePerSecond:
+		// a rate requires two samples of the total
+		if !hasTotal || timestamp <= lastTimestamp {
+			return nil
+		}
+		d.value = (total - lastTotal) * 1000 / float64(timestamp-lastTimestamp)
+
+	case MovingAverage:
+		if len(d.samples) == d.window {
+			d.samples = d.samples[1:]
+		}
+		d.samples = append(d.samples, value)
+		sum := float64(0)
+		for _, s := range d.samples {
+			sum += s
+		}
+		d.value = sum / float64(len(d.samples))
+
+	case PeakInWindow:
+		if !d.isSet || value > d.value {
+			d.value = value
+		}
+	}
+	d.isSet = true
+
+	// a zero value of a source that is only
+	// collected while active, such as the rate
+	// of an idle connection's byte counter, does
+	// not result in a snapshot on its own. only
+	// the drop to zero is collected so consumers
+	// do not keep the last non-zero value.
+	if d.value == 0 && d.source.ignoresZeroSnapshots() && !d.nonZeroCollected {
+		return nil
+	}
+	d.nonZeroCollected = d.value != 0
+	return &derivedSnapshot{
+		Name:      &d.name,
+		Attribs:   &d.attribs,
+		Timestamp: timestamp,
+		Value:     d.value,
+
+		Source:   d.source.Name(),
+		Function: d.function.String(),
+	}
+}
+
+// starts a new send window
+func (d *DerivedMetric) resetWindow() {
+	d.derivedLock.Lock()
+	defer d.derivedLock.Unlock()
+
+	if d.function == PeakInWindow {
+		d.isSet = false
+		d.value = 0
+	}
+}
+
+func (d *DerivedMetric) sample(prevTotal float64) (float64, float64) {
+	value := d.Get()
+	return value, value
+}
+
+func (d *DerivedMetric) ignoresZeroSnapshots() bool {
+	return d.source.ignoresZeroSnapshots()
+}
+
+func (c *Counter) sample(prevTotal float64) (float64, float64) {
+	total := float64(c.Get())
+	if c.cumalative {
+		return total - prevTotal, total
+	}
+	return total, total
+}
+
+func (c *Counter) ignoresZeroSnapshots() bool {
+	return c.ignoreZeroSnapshots
+}
+
+func (g *Gauge) sample(prevTotal float64) (float64, float64) {
+	value := g.Get()
+	return value, value
+}
+
+func (g *Gauge) ignoresZeroSnapshots() bool {
+	return false
+}
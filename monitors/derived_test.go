@@ -0,0 +1,157 @@
+package monitors_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/monitors"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Derived Metrics", func() {
+
+	var (
+		err error
+	)
+
+	// returns the derived metric values of
+	// the first monitor of each event
+	derivedValues := func(cloudEvents []*cloudevents.Event) []map[string]float64 {
+		values := []map[string]float64{}
+		for _, e := range cloudEvents {
+			data := struct {
+				Monitors []struct {
+					Derived []struct {
+						Name     string  `json:"name"`
+						Value    float64 `json:"value"`
+						Source   string  `json:"source"`
+						Function string  `json:"function"`
+					} `json:"derived"`
+				} `json:"monitors"`
+			}{}
+			err = json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+
+			v := make(map[string]float64)
+			for _, ds := range data.Monitors[0].Derived {
+				v[ds.Name] = ds.Value
+			}
+			values = append(values, v)
+		}
+		return values
+	}
+
+	It("computes rates and moving averages of counters at each collection", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		sent := monitors.NewCounter("sent", true, true)
+		sentRate := monitors.NewRateMetric("sentRate", sent)
+		monitor := msvc.NewMonitor("space-vpn")
+		monitor.AddCounter(sent)
+		monitor.AddDerivedMetric(sentRate)
+		monitor.AddDerivedMetric(monitors.NewMovingAverageMetric("sentAvg", sent, 2))
+		monitor.AddDerivedMetric(monitors.NewMovingAverageMetric("sentRateAvg", sentRate, 2))
+
+		// each stop collects and posts a snapshot
+		sent.Set(100)
+		msvc.Stop()
+		time.Sleep(100 * time.Millisecond)
+		sent.Set(300)
+		msvc.Stop()
+		time.Sleep(100 * time.Millisecond)
+		sent.Set(900)
+		msvc.Stop()
+
+		values := derivedValues(rs.events)
+		Expect(len(values)).To(Equal(3))
+
+		// a rate requires two collections
+		_, hasRate := values[0]["sentRate"]
+		Expect(hasRate).To(BeFalse())
+		Expect(values[0]["sentAvg"]).To(Equal(float64(100)))
+		Expect(values[0]["sentRateAvg"]).To(Equal(float64(0)))
+
+		Expect(values[1]["sentRate"]).To(BeNumerically("~", 2000, 400))
+		Expect(values[1]["sentAvg"]).To(Equal(float64(150)))
+		Expect(values[2]["sentRate"]).To(BeNumerically("~", 6000, 1200))
+		Expect(values[2]["sentAvg"]).To(Equal(float64(400)))
+		Expect(values[2]["sentRateAvg"]).To(BeNumerically("~", 4000, 800))
+		Expect(sentRate.Get()).To(Equal(values[2]["sentRate"]))
+	})
+
+	It("does not snapshot a zero rate of a counter that ignores zero snapshots other than when it drops to zero", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		sent := monitors.NewCounter("sent", true, true)
+		monitor := msvc.NewMonitor("space-vpn")
+		monitor.AddCounter(sent)
+		monitor.AddDerivedMetric(monitors.NewRateMetric("sentRate", sent))
+
+		sent.Set(100)
+		msvc.Stop()
+		time.Sleep(100 * time.Millisecond)
+		sent.Set(300)
+		msvc.Stop()
+		Expect(len(rs.events)).To(Equal(2))
+
+		// the rate of a counter that has become idle
+		// is snapshot once when it drops to zero but
+		// not while the counter remains idle
+		time.Sleep(100 * time.Millisecond)
+		msvc.Stop()
+		Expect(len(rs.events)).To(Equal(3))
+		time.Sleep(100 * time.Millisecond)
+		msvc.Stop()
+		time.Sleep(100 * time.Millisecond)
+		msvc.Stop()
+		Expect(len(rs.events)).To(Equal(3))
+
+		time.Sleep(100 * time.Millisecond)
+		sent.Set(400)
+		msvc.Stop()
+		values := derivedValues(rs.events)
+		Expect(len(values)).To(Equal(4))
+		Expect(values[1]["sentRate"]).To(BeNumerically(">", 0))
+		Expect(values[2]).To(HaveKeyWithValue("sentRate", float64(0)))
+		Expect(values[3]["sentRate"]).To(BeNumerically(">", 0))
+	})
+
+	It("computes the peak of a gauge within each send window", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 100, 50)
+
+		peers := monitors.NewGauge("peers")
+		monitor := msvc.NewMonitor("mesh")
+		monitor.AddGauge(peers)
+		monitor.AddDerivedMetric(monitors.NewPeakMetric("peakPeers", peers))
+
+		peers.Set(5)
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(120 * time.Millisecond)
+		peers.Set(2)
+		time.Sleep(120 * time.Millisecond)
+		msvc.Stop()
+
+		// all snapshots were posted in a single window
+		values := derivedValues(rs.events)
+		Expect(len(values)).To(BeNumerically(">", 2))
+		for _, v := range values {
+			Expect(v["peakPeers"]).To(Equal(float64(5)))
+		}
+
+		// a new window starts after the post
+		peers.Set(3)
+		msvc.Stop()
+		values = derivedValues(rs.events)
+		Expect(values[len(values)-1]["peakPeers"]).To(Equal(float64(3)))
+	})
+})
@@ -0,0 +1,132 @@
+package monitors
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// Gauge is a metric whose value can go up and
+// down such as the number of active peers or
+// the current round trip time.
+type Gauge struct {
+	name    string
+	attribs map[string]string
+
+	value float64
+	// gauges are only collected once
+	// a value has been set
+	isSet bool
+
+	gaugeLock sync.RWMutex
+}
+
+type gaugeSnapshot struct {
+	Name      *string `json:"name"`
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+
+	Attribs *map[string]string `json:"attribs,omitempty"`
+}
+
+// Returns a gauge. The gauge's current value
+// is collected with every monitor snapshot.
+func NewGauge(name string) *Gauge {
+	return &Gauge{
+		name:    name,
+		attribs: map[string]string{},
+	}
+}
+
+func NewGaugeWithAttribs(
+	name string,
+	attribs map[string]string,
+) *Gauge {
+
+	return &Gauge{
+		name:    name,
+		attribs: attribs,
+	}
+}
+
+func (g *Gauge) AddAttribute(name, value string) {
+	g.attribs[name] = value
+}
+
+func (g *Gauge) collect() *gaugeSnapshot {
+	g.gaugeLock.RLock()
+	defer g.gaugeLock.RUnlock()
+
+	if !g.isSet {
+		return nil
+	}
+	return &gaugeSnapshot{
+		Name:      &g.name,
+		Attribs:   &g.attribs,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Value:     g.value,
+	}
+}
+
+func (g *Gauge) Name() string {
+	return g.name
+}
+
+func (g *Gauge) Get() float64 {
+	g.gaugeLock.RLock()
+	defer g.gaugeLock.RUnlock()
+
+	return g.value
+}
+
+// Sets the gauge's value. NaN and infinite
+// values are ignored as they cannot be encoded
+// in the monitor's snapshots.
+func (g *Gauge) Set(value float64) {
+	g.gaugeLock.Lock()
+	defer g.gaugeLock.Unlock()
+
+	if !isFinite(value) {
+		logger.DebugMessage(
+			"Gauge.Set(): Ignoring non-finite value %f of gauge '%s'.",
+			value, g.name,
+		)
+		return
+	}
+	g.value = value
+	g.isSet = true
+}
+
+// Adds to the gauge's value. Like Set the
+// value is ignored if the resulting value
+// is NaN or infinite.
+func (g *Gauge) Add(value float64) {
+	g.gaugeLock.Lock()
+	defer g.gaugeLock.Unlock()
+
+	if !isFinite(g.value + value) {
+		logger.DebugMessage(
+			"Gauge.Add(): Ignoring non-finite value %f of gauge '%s'.",
+			g.value+value, g.name,
+		)
+		return
+	}
+	g.value += value
+	g.isSet = true
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// returns whether the value is neither NaN nor
+// infinite which cannot be encoded as json
+func isFinite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
@@ -0,0 +1,97 @@
+package monitors_test
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/appbricks/mycloudspace-common/monitors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Gauge", func() {
+
+	It("collects the current value of gauges that have been set", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		monitor := msvc.NewMonitor("testMonitor")
+		peers := monitors.NewGauge("activePeers")
+		monitor.AddGauge(peers)
+		rtt := monitors.NewGaugeWithAttribs("rtt", map[string]string{"peer": "node-1"})
+		monitor.AddGauge(rtt)
+
+		peers.Inc()
+		peers.Inc()
+		peers.Dec()
+		peers.Add(2.5)
+		Expect(peers.Get()).To(Equal(3.5))
+		msvc.Stop()
+
+		// gauges are not reset when collected
+		rtt.Set(0)
+		msvc.Stop()
+		peers.Set(-1)
+		msvc.Stop()
+
+		type snapshot struct {
+			Monitors []struct {
+				Gauges []struct {
+					Name    string            `json:"name"`
+					Value   float64           `json:"value"`
+					Attribs map[string]string `json:"attribs"`
+				} `json:"gauges"`
+			} `json:"monitors"`
+		}
+		Expect(len(rs.events)).To(Equal(3))
+		gauges := []map[string]float64{}
+		for _, e := range rs.events {
+			data := snapshot{}
+			err := json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+
+			values := map[string]float64{}
+			for _, g := range data.Monitors[0].Gauges {
+				values[g.Name] = g.Value
+				if g.Name == "rtt" {
+					Expect(g.Attribs).To(Equal(map[string]string{"peer": "node-1"}))
+				}
+			}
+			gauges = append(gauges, values)
+		}
+
+		// a gauge that has not been set is not
+		// collected but one set to zero is
+		Expect(gauges).To(Equal([]map[string]float64{
+			{"activePeers": 3.5},
+			{"activePeers": 3.5, "rtt": 0},
+			{"activePeers": -1, "rtt": 0},
+		}))
+	})
+
+	It("ignores values that are not finite", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		rtt := monitors.NewGauge("rtt")
+		msvc.NewMonitor("testMonitor").AddGauge(rtt)
+
+		rtt.Set(math.NaN())
+		rtt.Set(math.Inf(1))
+		msvc.Stop()
+		Expect(len(rs.events)).To(Equal(0))
+
+		rtt.Set(math.MaxFloat64)
+		rtt.Add(math.MaxFloat64)
+		rtt.Set(12.5)
+		rtt.Add(math.Inf(-1))
+		Expect(rtt.Get()).To(Equal(12.5))
+		msvc.Stop()
+
+		Expect(len(rs.events)).To(Equal(1))
+		Expect(string(rs.events[0].Data())).To(ContainSubstring(`"value":12.5`))
+	})
+})
@@ -0,0 +1,221 @@
+package monitors
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// default buckets for latencies in milliseconds
+var DefaultLatencyBuckets = []float64{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// Histogram records the distribution of observed
+// values such as latencies or packet sizes over
+// configurable buckets. Like cumalative counters
+// each snapshot contains only the observations
+// made since the previous snapshot.
+type Histogram struct {
+	name    string
+	attribs map[string]string
+
+	// upper bounds of each bucket in ascending
+	// order. values greater than the last bound
+	// are counted in an overflow bucket.
+	bounds []float64
+	counts []uint64
+
+	count uint64
+	sum,
+	min,
+	max float64
+
+	// totals of all observations which are
+	// not reset when a snapshot is collected
+	totalCounts []uint64
+	totalCount  uint64
+	totalSum    float64
+
+	// time of the previous snapshot in milliseconds
+	startTimestamp int64
+
+	histogramLock sync.Mutex
+}
+
+type histogramSnapshot struct {
+	Name           *string `json:"name"`
+	Timestamp      int64   `json:"timestamp"`
+	StartTimestamp int64   `json:"startTimestamp"`
+
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+
+	// counts has one more entry than bounds
+	// which is the count of the overflow bucket
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+
+	Attribs *map[string]string `json:"attribs,omitempty"`
+}
+
+// Returns a histogram with buckets having the given
+// upper bounds. If no bounds are given then
+// DefaultLatencyBuckets are used.
+func NewHistogram(name string, bounds []float64) *Histogram {
+	return NewHistogramWithAttribs(name, bounds, map[string]string{})
+}
+
+func NewHistogramWithAttribs(
+	name string,
+	bounds []float64,
+	attribs map[string]string,
+) *Histogram {
+
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+	sortedBounds := make([]float64, len(bounds))
+	copy(sortedBounds, bounds)
+	sort.Float64s(sortedBounds)
+
+	h := &Histogram{
+		name:    name,
+		attribs: attribs,
+
+		bounds: sortedBounds,
+		counts: make([]uint64, len(sortedBounds)+1),
+
+		totalCounts: make([]uint64, len(sortedBounds)+1),
+
+		startTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	h.reset()
+	return h
+}
+
+// Returns 'count' bucket bounds each 'width' apart
+// with the first bucket's upper bound at 'start'.
+func LinearBuckets(start, width float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// Returns 'count' bucket bounds with the first
+// bucket's upper bound at 'start' and each
+// subsequent bound 'factor' times the previous.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+func (h *Histogram) AddAttribute(name, value string) {
+	h.attribs[name] = value
+}
+
+func (h *Histogram) collect() *histogramSnapshot {
+	h.histogramLock.Lock()
+	defer h.histogramLock.Unlock()
+
+	if h.count == 0 {
+		return nil
+	}
+	hs := &histogramSnapshot{
+		Name:      &h.name,
+		Attribs:   &h.attribs,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+
+		StartTimestamp: h.startTimestamp,
+
+		Count: h.count,
+		Sum:   h.sum,
+		Min:   h.min,
+		Max:   h.max,
+
+		Bounds: h.bounds,
+		Counts: h.counts,
+	}
+	h.counts = make([]uint64, len(h.bounds)+1)
+	h.startTimestamp = hs.Timestamp
+	h.reset()
+	return hs
+}
+
+func (h *Histogram) reset() {
+	h.count = 0
+	h.sum = 0
+	h.min = math.MaxFloat64
+	h.max = -math.MaxFloat64
+}
+
+func (h *Histogram) Name() string {
+	return h.name
+}
+
+// Returns the number of observations
+// since the last snapshot
+func (h *Histogram) Count() uint64 {
+	h.histogramLock.Lock()
+	defer h.histogramLock.Unlock()
+
+	return h.count
+}
+
+// Records an observation. NaN and infinite
+// values are ignored as they cannot be encoded
+// in the monitor's snapshots.
+func (h *Histogram) Observe(value float64) {
+	h.histogramLock.Lock()
+	defer h.histogramLock.Unlock()
+
+	if !isFinite(value) {
+		logger.DebugMessage(
+			"Histogram.Observe(): Ignoring non-finite observation %f of histogram '%s'.",
+			value, h.name,
+		)
+		return
+	}
+
+	// index of first bucket whose upper bound is >= value
+	i := sort.SearchFloat64s(h.bounds, value)
+	h.counts[i]++
+	h.totalCounts[i]++
+	h.totalCount++
+	h.totalSum += value
+
+	h.count++
+	h.sum += value
+	if value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+}
+
+// Returns the bucket bounds along with the counts,
+// number and sum of all observations made since the
+// histogram was created.
+func (h *Histogram) totals() ([]float64, []uint64, uint64, float64) {
+	h.histogramLock.Lock()
+	defer h.histogramLock.Unlock()
+
+	counts := make([]uint64, len(h.totalCounts))
+	copy(counts, h.totalCounts)
+	return h.bounds, counts, h.totalCount, h.totalSum
+}
+
+// Observes the given duration in milliseconds
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(float64(d) / float64(time.Millisecond))
+}
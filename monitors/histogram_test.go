@@ -0,0 +1,155 @@
+package monitors_test
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/monitors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Histogram", func() {
+
+	type histogramSnapshot struct {
+		Name           string    `json:"name"`
+		Timestamp      int64     `json:"timestamp"`
+		StartTimestamp int64     `json:"startTimestamp"`
+		Count          uint64    `json:"count"`
+		Sum            float64   `json:"sum"`
+		Min            float64   `json:"min"`
+		Max            float64   `json:"max"`
+		Bounds         []float64 `json:"bounds"`
+		Counts         []uint64  `json:"counts"`
+	}
+	type snapshot struct {
+		Monitors []struct {
+			Histograms []histogramSnapshot `json:"histograms"`
+		} `json:"monitors"`
+	}
+
+	// returns the histograms of each posted snapshot
+	histograms := func(rs *recordingSender) [][]histogramSnapshot {
+		hs := [][]histogramSnapshot{}
+		for _, e := range rs.events {
+			data := snapshot{}
+			err := json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(data.Monitors)).To(Equal(1))
+			hs = append(hs, data.Monitors[0].Histograms)
+		}
+		return hs
+	}
+
+	It("creates linear and exponential bucket bounds", func() {
+		Expect(monitors.LinearBuckets(10, 5, 4)).To(Equal([]float64{10, 15, 20, 25}))
+		Expect(monitors.ExponentialBuckets(1, 2, 5)).To(Equal([]float64{1, 2, 4, 8, 16}))
+	})
+
+	It("counts observations and durations", func() {
+
+		histogram := monitors.NewHistogram("latency", nil)
+		Expect(histogram.Name()).To(Equal("latency"))
+		Expect(histogram.Count()).To(Equal(uint64(0)))
+
+		histogram.Observe(0.5)
+		histogram.ObserveDuration(250 * time.Millisecond)
+		histogram.ObserveDuration(10 * time.Second)
+		Expect(histogram.Count()).To(Equal(uint64(3)))
+	})
+
+	It("counts values equal to a bucket's upper bound in that bucket", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		// bounds are sorted
+		bounds := []float64{100, 10, 50}
+		histogram := monitors.NewHistogram("latency", bounds)
+		msvc.NewMonitor("testMonitor").AddHistogram(histogram)
+		Expect(bounds).To(Equal([]float64{100, 10, 50}))
+
+		for _, v := range []float64{-5, 0, 10, 10.001, 50, 100, 100.001} {
+			histogram.Observe(v)
+		}
+		msvc.Stop()
+
+		hs := histograms(rs)
+		Expect(len(hs)).To(Equal(1))
+		Expect(len(hs[0])).To(Equal(1))
+		Expect(hs[0][0].Bounds).To(Equal([]float64{10, 50, 100}))
+		Expect(hs[0][0].Counts).To(Equal([]uint64{3, 2, 1, 1}))
+		Expect(hs[0][0].Count).To(Equal(uint64(7)))
+		Expect(hs[0][0].Min).To(Equal(float64(-5)))
+		Expect(hs[0][0].Max).To(Equal(100.001))
+	})
+
+	It("ignores observations that are not finite", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		histogram := monitors.NewHistogram("latency", []float64{10, 50})
+		msvc.NewMonitor("testMonitor").AddHistogram(histogram)
+
+		histogram.Observe(math.NaN())
+		histogram.Observe(math.Inf(1))
+		histogram.Observe(math.Inf(-1))
+		histogram.Observe(20)
+		Expect(histogram.Count()).To(Equal(uint64(1)))
+		msvc.Stop()
+
+		hs := histograms(rs)
+		Expect(len(hs)).To(Equal(1))
+		Expect(hs[0][0].Counts).To(Equal([]uint64{0, 1, 0}))
+		Expect(hs[0][0].Sum).To(Equal(float64(20)))
+		Expect(hs[0][0].Min).To(Equal(float64(20)))
+		Expect(hs[0][0].Max).To(Equal(float64(20)))
+	})
+
+	It("only includes observations made since the previous snapshot", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		histogram := monitors.NewHistogram("latency", []float64{10, 100})
+		gauge := monitors.NewGauge("activePeers")
+		monitor := msvc.NewMonitor("testMonitor")
+		monitor.AddHistogram(histogram)
+		monitor.AddGauge(gauge)
+		gauge.Set(1)
+
+		histogram.Observe(5)
+		histogram.Observe(500)
+		msvc.Stop()
+		Expect(histogram.Count()).To(Equal(uint64(0)))
+
+		// a histogram without observations
+		// is not included in the snapshot
+		msvc.Stop()
+
+		histogram.Observe(50)
+		histogram.Observe(20)
+		msvc.Stop()
+
+		hs := histograms(rs)
+		Expect(len(hs)).To(Equal(3))
+		Expect(len(hs[0])).To(Equal(1))
+		Expect(hs[0][0].Counts).To(Equal([]uint64{1, 0, 1}))
+		Expect(hs[0][0].Sum).To(Equal(float64(505)))
+		Expect(hs[1]).To(BeEmpty())
+		Expect(len(hs[2])).To(Equal(1))
+		Expect(hs[2][0].Counts).To(Equal([]uint64{0, 2, 0}))
+		Expect(hs[2][0].Count).To(Equal(uint64(2)))
+		Expect(hs[2][0].Sum).To(Equal(float64(70)))
+		Expect(hs[2][0].Min).To(Equal(float64(20)))
+		Expect(hs[2][0].Max).To(Equal(float64(50)))
+
+		// each snapshot starts where the previous
+		// snapshot of the histogram ended
+		Expect(hs[2][0].StartTimestamp).To(Equal(hs[0][0].Timestamp))
+		Expect(hs[0][0].StartTimestamp).To(BeNumerically("<=", hs[0][0].Timestamp))
+	})
+})
@@ -0,0 +1,488 @@
+package monitors
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// HistoryAggregation determines how the points of a
+// metric's history within each step of a query are
+// combined into a single point
+type HistoryAggregation int
+
+const (
+	AggregateLast HistoryAggregation = iota
+	AggregateSum
+	AggregateAverage
+	AggregateMin
+	AggregateMax
+)
+
+// HistoryQuery selects the points of a metric's
+// history. A zero 'Start' selects all retained
+// points and a zero 'End' selects points up to
+// now. If 'Step' is non-zero the points are
+// aggregated into one point per step starting at
+// 'Start' and steps without points are omitted.
+type HistoryQuery struct {
+	Start, End  time.Time
+	Step        time.Duration
+	Aggregation HistoryAggregation
+
+	// selects the series of a metric
+	// with the given attributes
+	Attribs map[string]string
+}
+
+// HistoryPoint is a value of a metric at the time
+// it was collected. The values of cumalative
+// counters are the change since the previous point.
+type HistoryPoint struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// retains the values of all metrics collected
+// within the retention period
+type history struct {
+	retention time.Duration
+	series    map[string]*historySeries
+
+	// file to which the history is persisted
+	// and when it was last written
+	path      string
+	lastSaved time.Time
+
+	historyLock sync.RWMutex
+	// serializes writes to the file which
+	// are made without the history locked
+	saveLock sync.Mutex
+}
+
+// ring buffer of the points of a single metric
+type historySeries struct {
+	monitor string
+	metric  string
+	attribs map[string]string
+
+	// oldest point is at index 'head'
+	points []historyPoint
+	head,
+	count int
+}
+
+type historyPoint struct {
+	timestamp int64
+	value     float64
+}
+
+// persisted form of a series
+type historyRecord struct {
+	Monitor string            `json:"monitor"`
+	Metric  string            `json:"metric"`
+	Attribs map[string]string `json:"attribs,omitempty"`
+	Points  [][2]float64      `json:"points"`
+}
+
+// initial capacity of a series' ring buffer
+const historyInitialCapacity = 64
+
+// minimum time between writes of the history
+// to its file while the service is running
+const historySaveInterval = time.Minute
+
+// Enables retaining the values of all metrics collected
+// within the given retention period. The history is
+// queried with QueryHistory.
+func (ms *MonitorService) EnableHistory(retention time.Duration) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.history == nil {
+		ms.history = &history{
+			series: make(map[string]*historySeries),
+		}
+	}
+	ms.history.retention = retention
+}
+
+// Persists the history to the file at the given path
+// when snapshots are posted at most once a minute and
+// when the service is stopped. Any history in the file
+// that is within the retention period is restored and
+// merged with the history recorded so far. History
+// must be enabled before it can be persisted.
+func (ms *MonitorService) SetHistoryFile(path string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.history == nil {
+		return fmt.Errorf("monitor history has not been enabled")
+	}
+	return ms.history.load(path)
+}
+
+// Returns the points of the given metric of a monitor
+// selected by the given query in order of time.
+func (ms *MonitorService) QueryHistory(monitorName, metricName string, query HistoryQuery) ([]HistoryPoint, error) {
+	ms.lock.Lock()
+	h := ms.history
+	ms.lock.Unlock()
+
+	if h == nil {
+		return nil, fmt.Errorf("monitor history has not been enabled")
+	}
+	return h.query(historyKey(monitorName, metricName, query.Attribs), query), nil
+}
+
+// persists the history if it has been enabled. the
+// history is written without the service lock held
+// so it must not be called with the lock held.
+func (ms *MonitorService) saveHistory(force bool) {
+	ms.lock.Lock()
+	h := ms.history
+	ms.lock.Unlock()
+
+	if h != nil {
+		h.save(force)
+	}
+}
+
+// adds the values of the metrics in the given payload
+func (h *history) record(ep *eventPayload) {
+	h.historyLock.Lock()
+	defer h.historyLock.Unlock()
+
+	add := func(monitorName string, name *string, attribs *map[string]string, timestamp int64, value float64) {
+		key := historyKey(monitorName, *name, derefAttribs(attribs))
+		s, exists := h.series[key]
+		if !exists {
+			s = &historySeries{
+				monitor: monitorName,
+				metric:  *name,
+				points:  make([]historyPoint, historyInitialCapacity),
+			}
+			if attribs != nil && len(*attribs) > 0 {
+				s.attribs = make(map[string]string)
+				for n, v := range *attribs {
+					s.attribs[n] = v
+				}
+			}
+			h.series[key] = s
+		}
+		s.add(historyPoint{timestamp, value}, timestamp-h.retention.Milliseconds())
+	}
+	for _, m := range ep.Monitors {
+		for _, cs := range m.Counters {
+			add(m.Name, cs.Name, cs.Attribs, cs.Timestamp, float64(cs.Value))
+		}
+		for _, gs := range m.Gauges {
+			add(m.Name, gs.Name, gs.Attribs, gs.Timestamp, gs.Value)
+		}
+		for _, ds := range m.Derived {
+			add(m.Name, ds.Name, ds.Attribs, ds.Timestamp, ds.Value)
+		}
+	}
+	// series that were not part of the payload,
+	// such as those of deleted peers, also age out
+	h.prune()
+}
+
+// removes the points older than the retention period
+// from all series and drops series left without any
+// points. must be called with the write lock held.
+func (h *history) prune() {
+	cutoff := h.cutoff()
+	for key, s := range h.series {
+		s.prune(cutoff)
+		if s.count == 0 {
+			delete(h.series, key)
+		}
+	}
+}
+
+// returns the time in milliseconds before
+// which points are no longer retained
+func (h *history) cutoff() int64 {
+	return time.Now().Add(-h.retention).UnixNano() / int64(time.Millisecond)
+}
+
+func (h *history) query(key string, query HistoryQuery) []HistoryPoint {
+	h.historyLock.RLock()
+	defer h.historyLock.RUnlock()
+
+	s, exists := h.series[key]
+	if !exists {
+		return []HistoryPoint{}
+	}
+
+	// points older than the retention period
+	// may not have been pruned yet
+	start := query.Start.UnixNano() / int64(time.Millisecond)
+	if cutoff := h.cutoff(); query.Start.IsZero() || start < cutoff {
+		start = cutoff
+	}
+	end := query.End.UnixNano() / int64(time.Millisecond)
+	if query.End.IsZero() {
+		end = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	selected := []historyPoint{}
+	s.each(func(p historyPoint) {
+		if p.timestamp >= start && p.timestamp <= end {
+			selected = append(selected, p)
+		}
+	})
+
+	points := make([]HistoryPoint, 0, len(selected))
+	if query.Step <= 0 {
+		for _, p := range selected {
+			points = append(points, HistoryPoint{time.UnixMilli(p.timestamp), p.value})
+		}
+		return points
+	}
+
+	step := query.Step.Milliseconds()
+	if step == 0 {
+		step = 1
+	}
+	if query.Start.IsZero() && len(selected) > 0 {
+		start = selected[0].timestamp
+	}
+	for i := 0; i < len(selected); {
+		// points within the step that
+		// includes the next point
+		stepStart := start + (selected[i].timestamp-start)/step*step
+		j := i
+		for j < len(selected) && selected[j].timestamp < stepStart+step {
+			j++
+		}
+		points = append(points, HistoryPoint{
+			Timestamp: time.UnixMilli(stepStart),
+			Value:     aggregate(selected[i:j], query.Aggregation),
+		})
+		i = j
+	}
+	return points
+}
+
+func aggregate(points []historyPoint, aggregation HistoryAggregation) float64 {
+	value := points[0].value
+	switch aggregation {
+	case AggregateSum, AggregateAverage:
+		for _, p := range points[1:] {
+			value += p.value
+		}
+		if aggregation == AggregateAverage {
+			value /= float64(len(points))
+		}
+	case AggregateMin:
+		for _, p := range points[1:] {
+			value = math.Min(value, p.value)
+		}
+	case AggregateMax:
+		for _, p := range points[1:] {
+			value = math.Max(value, p.value)
+		}
+	default:
+		value = points[len(points)-1].value
+	}
+	return value
+}
+
+// adds a point overwriting the oldest point if
+// it is older than the given cutoff. otherwise
+// the buffer is grown to retain all points.
+func (s *historySeries) add(p historyPoint, cutoff int64) {
+	s.prune(cutoff)
+	if s.count == len(s.points) {
+		points := make([]historyPoint, 2*len(s.points))
+		n := 0
+		s.each(func(p historyPoint) {
+			points[n] = p
+			n++
+		})
+		s.points = points
+		s.head = 0
+	}
+	s.points[(s.head+s.count)%len(s.points)] = p
+	s.count++
+}
+
+// removes the points older than the given cutoff
+func (s *historySeries) prune(cutoff int64) {
+	for s.count > 0 && s.points[s.head].timestamp < cutoff {
+		s.head = (s.head + 1) % len(s.points)
+		s.count--
+	}
+}
+
+func (s *historySeries) each(fn func(p historyPoint)) {
+	for i := 0; i < s.count; i++ {
+		fn(s.points[(s.head+i)%len(s.points)])
+	}
+}
+
+// loads the history persisted at the
+// given path and persists to it
+func (h *history) load(path string) error {
+	h.historyLock.Lock()
+	defer h.historyLock.Unlock()
+
+	var (
+		err error
+
+		data    []byte
+		records []*historyRecord
+	)
+
+	h.path = path
+	if data, err = os.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err = json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+
+	cutoff := h.cutoff()
+	for _, r := range records {
+		key := historyKey(r.Monitor, r.Metric, r.Attribs)
+		s, exists := h.series[key]
+		if !exists {
+			s = &historySeries{
+				monitor: r.Monitor,
+				metric:  r.Metric,
+				attribs: r.Attribs,
+				points:  make([]historyPoint, historyInitialCapacity),
+			}
+			h.series[key] = s
+		}
+		restored := make([]historyPoint, 0, len(r.Points))
+		for _, p := range r.Points {
+			if int64(p[0]) >= cutoff {
+				restored = append(restored, historyPoint{int64(p[0]), p[1]})
+			}
+		}
+		s.merge(restored, cutoff)
+	}
+	h.prune()
+	return nil
+}
+
+// merges the given points with the points of the
+// series in order of time. given points that the
+// series already has are skipped so restoring the
+// same history again does not duplicate them.
+// distinct points may share a timestamp as they
+// are recorded in milliseconds.
+func (s *historySeries) merge(points []historyPoint, cutoff int64) {
+
+	merged := make([]historyPoint, 0, s.count+len(points))
+	existing := make(map[historyPoint]bool)
+	s.each(func(p historyPoint) {
+		merged = append(merged, p)
+		existing[p] = true
+	})
+	for _, p := range points {
+		if !existing[p] {
+			merged = append(merged, p)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].timestamp < merged[j].timestamp
+	})
+
+	s.head, s.count = 0, 0
+	for _, p := range merged {
+		s.add(p, cutoff)
+	}
+}
+
+// writes the history to its file if one has been set
+// and it was not written within historySaveInterval
+// unless 'force' is true. the history is locked only
+// while it is copied.
+func (h *history) save(force bool) {
+	h.saveLock.Lock()
+	defer h.saveLock.Unlock()
+
+	var (
+		err error
+
+		data []byte
+	)
+
+	path, records := h.records(force)
+	if records == nil {
+		return
+	}
+	if data, err = json.Marshal(records); err != nil {
+		logger.ErrorMessage("history.save(): Unable to encode monitor history: %s", err.Error())
+		return
+	}
+
+	// write to a temporary file and
+	// atomically swap it with the current one
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		logger.ErrorMessage(
+			"history.save(): Unable to write monitor history to '%s': %s",
+			path, err.Error(),
+		)
+	}
+}
+
+// returns the path of the history's file and a copy
+// of all series to be written to it. returns no records
+// if the history is not persisted or is not due to be
+// written.
+func (h *history) records(force bool) (string, []*historyRecord) {
+	h.historyLock.Lock()
+	defer h.historyLock.Unlock()
+
+	if len(h.path) == 0 || (!force && time.Since(h.lastSaved) < historySaveInterval) {
+		return "", nil
+	}
+	h.lastSaved = time.Now()
+	h.prune()
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	records := make([]*historyRecord, 0, len(keys))
+	for _, key := range keys {
+		s := h.series[key]
+		r := &historyRecord{
+			Monitor: s.monitor,
+			Metric:  s.metric,
+			Attribs: s.attribs,
+			Points:  make([][2]float64, 0, s.count),
+		}
+		s.each(func(p historyPoint) {
+			r.Points = append(r.Points, [2]float64{float64(p.timestamp), p.value})
+		})
+		records = append(records, r)
+	}
+	return h.path, records
+}
+
+// returns a key that identifies the series of
+// a monitor's metric with the given attributes
+func historyKey(monitorName, metricName string, attribs map[string]string) string {
+	return monitorName + "/" + snapshotKey(&metricName, &attribs)
+}
@@ -0,0 +1,277 @@
+package monitors_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/monitors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("History", func() {
+
+	var (
+		err error
+
+		msvc *monitors.MonitorService
+
+		sent  *monitors.Counter
+		peers *monitors.Gauge
+	)
+
+	newMonitorService := func(retention time.Duration) {
+		msvc = monitors.NewMonitorService(&recordingSender{}, 1, 100)
+		msvc.EnableHistory(retention)
+
+		monitor := msvc.NewMonitor("space-vpn")
+		sent = monitors.NewCounterWithAttribs("sent", true, true, map[string]string{"peer": "node-1"})
+		monitor.AddCounter(sent)
+		peers = monitors.NewGauge("peers")
+		monitor.AddGauge(peers)
+	}
+
+	It("queries the history of a metric by range, step and aggregation", func() {
+
+		_, err = monitors.NewMonitorService(&recordingSender{}, 1, 100).
+			QueryHistory("space-vpn", "sent", monitors.HistoryQuery{})
+		Expect(err).To(HaveOccurred())
+
+		newMonitorService(time.Hour)
+		start := time.Now()
+
+		// each stop collects a snapshot
+		for i := 1; i <= 100; i++ {
+			sent.Set(int64(i * 10))
+			peers.Set(float64(i % 7))
+			msvc.Stop()
+		}
+
+		points, err := msvc.QueryHistory("space-vpn", "sent", monitors.HistoryQuery{
+			Attribs: map[string]string{"peer": "node-1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(100))
+		Expect(points[0].Value).To(Equal(float64(10)))
+		Expect(points[99].Value).To(Equal(float64(10)))
+		Expect(points[99].Timestamp).NotTo(BeTemporally("<", points[0].Timestamp))
+
+		// the series is selected by its attributes
+		points, err = msvc.QueryHistory("space-vpn", "sent", monitors.HistoryQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(0))
+
+		points, err = msvc.QueryHistory("space-vpn", "sent", monitors.HistoryQuery{
+			Start:       start.Add(-time.Second),
+			Step:        time.Hour,
+			Aggregation: monitors.AggregateSum,
+			Attribs:     map[string]string{"peer": "node-1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(1))
+		Expect(points[0].Value).To(Equal(float64(1000)))
+		Expect(points[0].Timestamp.Unix()).To(Equal(start.Add(-time.Second).Unix()))
+
+		points, err = msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{
+			Step:        time.Hour,
+			Aggregation: monitors.AggregateMax,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(1))
+		Expect(points[0].Value).To(Equal(float64(6)))
+
+		points, err = msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{
+			End: start.Add(-time.Second),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(0))
+	})
+
+	It("retains only the history within the retention period", func() {
+
+		newMonitorService(200 * time.Millisecond)
+
+		peers.Set(1)
+		msvc.Stop()
+		peers.Set(2)
+		msvc.Stop()
+		time.Sleep(300 * time.Millisecond)
+		peers.Set(3)
+		msvc.Stop()
+
+		points, err := msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(1))
+		Expect(points[0].Value).To(Equal(float64(3)))
+	})
+
+	It("ages out the history of metrics that are no longer collected", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		historyPath := filepath.Join(tmpDir, "history.json")
+
+		newMonitorService(200 * time.Millisecond)
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		sent.Set(100)
+		peers.Set(1)
+		msvc.Stop()
+
+		// the counter has not changed so it
+		// is not collected with the gauge
+		time.Sleep(300 * time.Millisecond)
+		peers.Set(2)
+		msvc.Stop()
+
+		points, err := msvc.QueryHistory("space-vpn", "sent", monitors.HistoryQuery{
+			Attribs: map[string]string{"peer": "node-1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(0))
+
+		// queries do not return points older
+		// than the retention period
+		points, err = msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{
+			Start: time.Now().Add(-time.Hour),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(1))
+		Expect(points[0].Value).To(Equal(float64(2)))
+
+		// the aged out series was not persisted
+		newMonitorService(time.Hour)
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		points, err = msvc.QueryHistory("space-vpn", "sent", monitors.HistoryQuery{
+			Attribs: map[string]string{"peer": "node-1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(0))
+		points, err = msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(1))
+	})
+
+	It("persists the history to a local file", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		historyPath := filepath.Join(tmpDir, "history.json")
+
+		newMonitorService(time.Hour)
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		sent.Set(100)
+		peers.Set(2)
+		msvc.Stop()
+		sent.Set(250)
+		msvc.Stop()
+
+		// restore the history in a new service
+		newMonitorService(time.Hour)
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		points, err := msvc.QueryHistory("space-vpn", "sent", monitors.HistoryQuery{
+			Attribs: map[string]string{"peer": "node-1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(2))
+		Expect(points[0].Value).To(Equal(float64(100)))
+		Expect(points[1].Value).To(Equal(float64(150)))
+
+		points, err = msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(2))
+	})
+
+	It("merges the restored history with the history recorded before it was restored", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		historyPath := filepath.Join(tmpDir, "history.json")
+
+		newMonitorService(time.Hour)
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		peers.Set(1)
+		msvc.Stop()
+		time.Sleep(10 * time.Millisecond)
+		peers.Set(2)
+		msvc.Stop()
+		time.Sleep(10 * time.Millisecond)
+
+		// the new service records history before the
+		// older history in the file is restored
+		newMonitorService(time.Hour)
+		peers.Set(3)
+		msvc.Stop()
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		// restoring the same history again
+		// does not duplicate its points
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		points, err := msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(3))
+		Expect(points[0].Value).To(Equal(float64(1)))
+		Expect(points[1].Value).To(Equal(float64(2)))
+		Expect(points[2].Value).To(Equal(float64(3)))
+		Expect(points[1].Timestamp).To(BeTemporally(">", points[0].Timestamp))
+		Expect(points[2].Timestamp).To(BeTemporally(">", points[1].Timestamp))
+
+		// the merged history is persisted along
+		// with the snapshot collected when stopped
+		msvc.Stop()
+		newMonitorService(time.Hour)
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+		points, err = msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(4))
+		for i, value := range []float64{1, 2, 3, 3} {
+			Expect(points[i].Value).To(Equal(value))
+		}
+	})
+
+	It("restores distinct points recorded within the same millisecond", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		historyPath := filepath.Join(tmpDir, "history.json")
+
+		timestamp := time.Now().UnixMilli()
+		err = os.WriteFile(historyPath, []byte(fmt.Sprintf(
+			`[{"monitor":"space-vpn","metric":"peers","points":[[%[1]d,1],[%[1]d,2]]}]`,
+			timestamp,
+		)), 0600)
+		Expect(err).NotTo(HaveOccurred())
+
+		newMonitorService(time.Hour)
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+		err = msvc.SetHistoryFile(historyPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		points, err := msvc.QueryHistory("space-vpn", "peers", monitors.HistoryQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(points)).To(Equal(2))
+		Expect(points[0].Value).To(Equal(float64(1)))
+		Expect(points[1].Value).To(Equal(float64(2)))
+	})
+})
@@ -0,0 +1,304 @@
+package monitors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// HTTPSenderMode determines how events
+// are encoded when posted to the endpoint.
+type HTTPSenderMode int
+
+const (
+	// events are posted as a json list of
+	// events.PublishDataInput and the endpoint
+	// responds with a json list of
+	// events.PublishEventResult
+	PublishDataMode HTTPSenderMode = iota
+	// each event is posted using the cloud events
+	// http binary content mode
+	BinaryMode
+	// each event is posted using the cloud events
+	// http structured content mode
+	StructuredMode
+)
+
+// HTTPSender is a Sender that posts
+// monitor events to an http endpoint.
+type HTTPSender struct {
+	endpoint    string
+	eventSource string
+	mode        HTTPSenderMode
+
+	headers    map[string]string
+	httpClient *http.Client
+	batcher    *events.Batcher
+
+	ceClient cloudevents.Client
+}
+
+// Returns a sender that posts events to the given
+// endpoint url. The source of all posted events is
+// set to 'eventSource' if it is not empty.
+func NewHTTPSender(endpoint, eventSource string, mode HTTPSenderMode) (*HTTPSender, error) {
+
+	s := &HTTPSender{
+		endpoint:    endpoint,
+		eventSource: eventSource,
+		mode:        mode,
+
+		headers:    make(map[string]string),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		batcher:    events.NewBatcher(0, 0),
+	}
+	if err := s.initClient(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Returns a copy of the sender that adds the
+// given header to all requests. i.e. to set an
+// authorization token.
+func (s *HTTPSender) WithHeader(name, value string) (*HTTPSender, error) {
+	ss := *s
+	ss.headers = make(map[string]string)
+	for n, v := range s.headers {
+		ss.headers[n] = v
+	}
+	ss.headers[name] = value
+	if err := ss.initClient(); err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+// Returns a copy of the sender that uses
+// the given client to send requests. If the
+// client is nil http.DefaultClient is used.
+func (s *HTTPSender) WithHTTPClient(httpClient *http.Client) (*HTTPSender, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	ss := *s
+	ss.httpClient = httpClient
+	if err := ss.initClient(); err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+// Returns a copy of the sender that uses the given
+// batcher to encode and split events posted in
+// PublishDataMode.
+func (s *HTTPSender) WithBatcher(batcher *events.Batcher) *HTTPSender {
+	ss := *s
+	ss.batcher = batcher
+	return &ss
+}
+
+func (s *HTTPSender) initClient() error {
+
+	var (
+		err error
+	)
+
+	if s.mode == PublishDataMode {
+		s.ceClient = nil
+		return nil
+	}
+	opts := []cehttp.Option{
+		cloudevents.WithTarget(s.endpoint),
+		cehttp.WithClient(*s.httpClient),
+	}
+	for name, value := range s.headers {
+		opts = append(opts, cehttp.WithHeader(name, value))
+	}
+	if s.ceClient, err = cloudevents.NewClientHTTP(opts...); err != nil {
+		logger.ErrorMessage(
+			"HTTPSender.initClient(): Failed to create cloud events client for endpoint '%s': %s",
+			s.endpoint, err.Error(),
+		)
+		return err
+	}
+	return nil
+}
+
+func (s *HTTPSender) PostMeasurementEvents(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+
+	if len(s.eventSource) > 0 {
+		for _, event := range cloudEvents {
+			event.SetSource(s.eventSource)
+		}
+	}
+	if s.mode == PublishDataMode {
+		return s.postPublishDataList(cloudEvents)
+	}
+	return s.postCloudEvents(cloudEvents)
+}
+
+func (s *HTTPSender) postPublishDataList(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+
+	var (
+		err error
+
+		results []events.PublishEventResult
+	)
+
+	// the post only fails as a whole if no
+	// batch reached the endpoint
+	delivered := false
+
+	results, err = s.batcher.Publish(cloudEvents,
+		func(batch []*cloudevents.Event, dataPayloads []events.PublishDataInput) ([]events.PublishEventResult, error) {
+
+			var (
+				err error
+
+				body         []byte
+				request      *http.Request
+				response     *http.Response
+				batchResults []events.PublishEventResult
+			)
+
+			if body, err = json.Marshal(dataPayloads); err != nil {
+				return nil, err
+			}
+			if request, err = http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body)); err != nil {
+				return nil, err
+			}
+			request.Header.Set("Content-Type", "application/json")
+			for name, value := range s.headers {
+				request.Header.Set(name, value)
+			}
+			if response, err = s.httpClient.Do(request); err != nil {
+				return nil, err
+			}
+			defer response.Body.Close()
+
+			if body, err = io.ReadAll(response.Body); err != nil {
+				return nil, err
+			}
+			if response.StatusCode < 200 || response.StatusCode >= 300 {
+				return nil, &events.StatusError{
+					StatusCode: response.StatusCode,
+					Message: fmt.Sprintf(
+						"post to '%s' failed: %s",
+						s.endpoint, string(bytes.TrimSpace(body)),
+					),
+				}
+			}
+
+			// an accepted post without a body such as
+			// a 204 response succeeds for all events
+			if len(bytes.TrimSpace(body)) == 0 {
+				delivered = true
+				batchResults = make([]events.PublishEventResult, len(batch))
+				for i := range batchResults {
+					batchResults[i].Success = true
+				}
+				return batchResults, nil
+			}
+			if err = json.Unmarshal(body, &batchResults); err != nil {
+				// the error is not reported per event as the
+				// events may have been accepted and should
+				// not be classified as malformed
+				logger.DebugMessage(
+					"HTTPSender.postPublishDataList(): Unable to parse response from '%s': %s",
+					s.endpoint, err.Error(),
+				)
+				return nil, fmt.Errorf("response from '%s' did not contain publish event results", s.endpoint)
+			}
+			delivered = true
+			return batchResults, nil
+		},
+	)
+	if err != nil {
+		logger.ErrorMessage(
+			"HTTPSender.postPublishDataList(): Failed to post events to '%s': %s",
+			s.endpoint, err.Error(),
+		)
+		if !delivered {
+			return nil, err
+		}
+	}
+	return events.CreateCloudEventErrorList(results, cloudEvents), nil
+}
+
+func (s *HTTPSender) postCloudEvents(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+
+	var (
+		ctx context.Context
+
+		lastErr error
+	)
+
+	if s.mode == BinaryMode {
+		ctx = cloudevents.WithEncodingBinary(context.Background())
+	} else {
+		ctx = cloudevents.WithEncodingStructured(context.Background())
+	}
+
+	errors := []events.CloudEventError{}
+	delivered := 0
+
+	for _, event := range cloudEvents {
+		if err := event.Validate(); err != nil {
+			errors = append(errors, events.CloudEventError{
+				Event: event,
+				Error: fmt.Sprintf("invalid event: %s", err.Error()),
+				Cause: &events.DecodeError{Index: -1, Err: events.ErrInvalidEvent, Cause: err},
+			})
+			continue
+		}
+
+		result := s.ceClient.Send(ctx, *event)
+		if cloudevents.IsACK(result) {
+			delivered++
+			continue
+		}
+
+		var (
+			httpResult *cehttp.Result
+			cause      error
+		)
+		if cloudevents.ResultAs(result, &httpResult) {
+			// endpoint responded with a non-2xx status
+			delivered++
+			logger.DebugMessage(
+				"HTTPSender.postCloudEvents(): Event with id %s was rejected by '%s': %s",
+				event.Context.GetID(), s.endpoint, result.Error(),
+			)
+			cause = &events.StatusError{
+				StatusCode: httpResult.StatusCode,
+				Message:    result.Error(),
+			}
+		} else {
+			logger.ErrorMessage(
+				"HTTPSender.postCloudEvents(): Failed to deliver event with id %s to '%s': %s",
+				event.Context.GetID(), s.endpoint, result.Error(),
+			)
+			lastErr = result
+		}
+		errors = append(errors, events.CloudEventError{
+			Event: event,
+			Error: result.Error(),
+			Cause: cause,
+		})
+	}
+	if delivered == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return errors, nil
+}
@@ -0,0 +1,226 @@
+package monitors_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	"github.com/appbricks/mycloudspace-common/monitors"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP Sender", func() {
+
+	var (
+		server *httptest.Server
+
+		received   []*cloudevents.Event
+		receivedMx sync.Mutex
+
+		contentTypes []string
+		authHeaders  []string
+
+		cloudEvents []*cloudevents.Event
+	)
+
+	BeforeEach(func() {
+		received = []*cloudevents.Event{}
+		contentTypes = []string{}
+		authHeaders = []string{}
+
+		cloudEvents = []*cloudevents.Event{}
+		for i := 1; i <= 3; i++ {
+			event := cloudevents.NewEvent()
+			event.SetID(fmt.Sprintf("event-%d", i))
+			event.SetType("io.appbricks.mycs.network.metric")
+			event.SetSource("urn:mycs:test")
+			err := event.SetData(cloudevents.ApplicationJSON, map[string]int{"value": i})
+			Expect(err).NotTo(HaveOccurred())
+			cloudEvents = append(cloudEvents, &event)
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	record := func(r *http.Request, event *cloudevents.Event) {
+		receivedMx.Lock()
+		defer receivedMx.Unlock()
+
+		received = append(received, event)
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+	}
+
+	It("posts a list of publish data inputs and parses the results", func() {
+
+		batchSizes := []int{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			body, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			dataPayloads := []events.PublishDataInput{}
+			err = json.Unmarshal(body, &dataPayloads)
+			Expect(err).NotTo(HaveOccurred())
+			batchSizes = append(batchSizes, len(dataPayloads))
+
+			decodedEvents, err := events.DecodePublishDataInputs(dataPayloads)
+			Expect(err).NotTo(HaveOccurred())
+
+			results := []events.PublishEventResult{}
+			for _, event := range decodedEvents {
+				record(r, event)
+				if event.ID() == "event-2" {
+					results = append(results, events.PublishEventResult{Error: "invalid counter value"})
+				} else {
+					results = append(results, events.PublishEventResult{Success: true})
+				}
+			}
+			body, err = json.Marshal(results)
+			Expect(err).NotTo(HaveOccurred())
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(body)
+		}))
+
+		sender, err := monitors.NewHTTPSender(server.URL, "urn:mycs:device", monitors.PublishDataMode)
+		Expect(err).NotTo(HaveOccurred())
+		sender, err = sender.WithHeader("Authorization", "Bearer token")
+		Expect(err).NotTo(HaveOccurred())
+		sender = sender.WithBatcher(events.NewBatcher(2, 0))
+
+		errors, err := sender.PostMeasurementEvents(cloudEvents)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batchSizes).To(Equal([]int{2, 1}))
+		Expect(len(errors)).To(Equal(1))
+		Expect(errors[0].Event).To(Equal(cloudEvents[1]))
+		Expect(errors[0].Error).To(Equal("invalid counter value"))
+
+		Expect(len(received)).To(Equal(3))
+		for i, event := range received {
+			Expect(event.ID()).To(Equal(cloudEvents[i].ID()))
+			Expect(event.Source()).To(Equal("urn:mycs:device"))
+			Expect(authHeaders[i]).To(Equal("Bearer token"))
+		}
+	})
+
+	It("treats a post accepted without a response body as successful for all events", func() {
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		sender, err := monitors.NewHTTPSender(server.URL, "", monitors.PublishDataMode)
+		Expect(err).NotTo(HaveOccurred())
+		errors, err := sender.PostMeasurementEvents(cloudEvents)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(errors)).To(Equal(0))
+	})
+
+	It("fails the post if the response of an accepted post cannot be parsed", func() {
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("OK"))
+		}))
+
+		sender, err := monitors.NewHTTPSender(server.URL, "", monitors.PublishDataMode)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sender.PostMeasurementEvents(cloudEvents)
+		Expect(err).To(HaveOccurred())
+		Expect(events.DefaultErrorClassifier(err)).To(BeTrue())
+	})
+
+	It("fails the post if the endpoint cannot be reached or rejects the request", func() {
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		}))
+
+		sender, err := monitors.NewHTTPSender(server.URL, "", monitors.PublishDataMode)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sender.PostMeasurementEvents(cloudEvents)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("503"))
+
+		sender, err = monitors.NewHTTPSender("http://127.0.0.1:1", "", monitors.BinaryMode)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sender.PostMeasurementEvents(cloudEvents)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("falls back to the default http client if no client is given", func() {
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		for _, mode := range []monitors.HTTPSenderMode{monitors.PublishDataMode, monitors.BinaryMode} {
+			sender, err := monitors.NewHTTPSender(server.URL, "", mode)
+			Expect(err).NotTo(HaveOccurred())
+			sender, err = sender.WithHTTPClient(nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			errors, err := sender.PostMeasurementEvents(cloudEvents)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors).To(BeEmpty())
+		}
+	})
+
+	postWithContentMode := func(mode monitors.HTTPSenderMode, contentType string) {
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			event, err := binding.ToEvent(context.Background(), cehttp.NewMessageFromHttpRequest(r))
+			Expect(err).NotTo(HaveOccurred())
+			record(r, event)
+
+			if event.ID() == "event-3" {
+				http.Error(w, "invalid counter value", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		sender, err := monitors.NewHTTPSender(server.URL, "urn:mycs:device", mode)
+		Expect(err).NotTo(HaveOccurred())
+		sender, err = sender.WithHeader("Authorization", "Bearer token")
+		Expect(err).NotTo(HaveOccurred())
+
+		errors, err := sender.PostMeasurementEvents(cloudEvents)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(errors)).To(Equal(1))
+		Expect(errors[0].Event).To(Equal(cloudEvents[2]))
+		Expect(errors[0].Error).To(ContainSubstring("400"))
+		Expect(errors[0].Error).To(ContainSubstring("invalid counter value"))
+
+		Expect(len(received)).To(Equal(3))
+		for i, event := range received {
+			Expect(event.ID()).To(Equal(cloudEvents[i].ID()))
+			Expect(event.Source()).To(Equal("urn:mycs:device"))
+			Expect(string(event.Data())).To(Equal(string(cloudEvents[i].Data())))
+			Expect(strings.HasPrefix(contentTypes[i], contentType)).To(BeTrue())
+			Expect(authHeaders[i]).To(Equal("Bearer token"))
+		}
+	}
+
+	It("posts cloud events using the http binary content mode", func() {
+		postWithContentMode(monitors.BinaryMode, "application/json")
+	})
+
+	It("posts cloud events using the http structured content mode", func() {
+		postWithContentMode(monitors.StructuredMode, "application/cloudevents+json")
+	})
+})
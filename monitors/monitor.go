@@ -3,6 +3,7 @@ package monitors
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
@@ -17,13 +18,34 @@ import (
 
 const networkMetricEventType = `io.appbricks.mycs.network.metric`
 
+// encoder used to spool events to an outbox. spooled
+// payloads are never encrypted or signed as the session
+// key they would be encrypted with does not survive a
+// restart. events are encrypted and signed by the
+// default encoder when they are posted by a sender.
+var outboxEncoder, _ = events.NewPayloadEncoder(events.CodecZlib, 0)
+
 type Sender interface {
 	PostMeasurementEvents(events []*cloudevents.Event) ([]events.CloudEventError, error)
 }
 
 type Monitor struct {
-	name     string
-	counters []*Counter
+	name       string
+	counters   []*Counter
+	gauges     []*Gauge
+	histograms []*Histogram
+	derived    []*DerivedMetric
+	alerts     []*alertEvaluator
+
+	// minimum milliseconds between collections
+	// of the monitor which overrides the service's
+	// collect interval if greater
+	collectInterval int64
+	lastCollected   int64
+
+	// called before each collection of the
+	// monitor to refresh its metrics
+	collectHooks []func()
 
 	lock *sync.Mutex
 }
@@ -32,8 +54,10 @@ type MonitorService struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	sender Sender
-	sendWG sync.WaitGroup
+	// senders with the backlog of events
+	// each has yet to post
+	senders []*senderQueue
+	sendWG  sync.WaitGroup
 
 	collectInterval time.Duration
 
@@ -43,41 +67,232 @@ type MonitorService struct {
 	monitors []*Monitor
 	lock     sync.Mutex
 
-	eventPayloads []*eventPayload
+	// local bus to which new events are published
+	eventBus *events.Bus
+	// events queued while the lock is held to be
+	// published to the bus once it has been released
+	// so a slow subscriber does not stall collection
+	// or any calls to the service
+	busEvents []*cloudevents.Event
+	// serializes publishing of the queued events
+	busLock sync.Mutex
+	// limits on the payloads buffered for posting
+	buffer *snapshotBuffer
+	// local history of collected metrics
+	history *history
+
+	// changes to the outboxes queued while the lock
+	// is held. these are written once the lock has
+	// been released so a slow disk does not stall
+	// collection or any calls to the service.
+	outboxWrites map[*events.Outbox]*outboxWrites
+	// serializes writes to the outboxes
+	outboxLock sync.Mutex
 
 	snapshotTimer *utils.ExecTimer
 }
 
+type outboxWrites struct {
+	add    []*cloudevents.Event
+	remove []string
+}
+
 type eventPayload struct {
 	Monitors []*monitorSnapshot `json:"monitors"`
+
+	// id of the event the payload is spooled
+	// to the outbox and posted with so reposts
+	// can be correlated with the outbox entry
+	// of the payload. the id is assigned when
+	// the payload is collected and is the same
+	// for all senders.
+	id string
+	// whether the payload has been
+	// published to the event bus
+	published bool
+	// cached size of the json encoded payload
+	size int
 }
 type monitorSnapshot struct {
-	Name     string             `json:"name"`
-	Counters []*counterSnapshot `json:"counters"`
+	Name       string               `json:"name"`
+	Counters   []*counterSnapshot   `json:"counters"`
+	Gauges     []*gaugeSnapshot     `json:"gauges,omitempty"`
+	Histograms []*histogramSnapshot `json:"histograms,omitempty"`
+	Derived    []*derivedSnapshot   `json:"derived,omitempty"`
 }
 
 // Creates a new monitor services with a 'sender' that
 // will post monitor events to an upstream service. The 
 // monitor collects metrics from all counters every
 // 'collectInterval' milliseconds and publishes these
-// metrics after 'collectCount' collections.
+// metrics after 'collectCount' collections. The sender
+// is added with the name DefaultSender and additional
+// senders can be added with AddSender.
 func NewMonitorService(sender Sender, collectCount, collectInterval int) *MonitorService {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &MonitorService{
+	ms := &MonitorService{
 		ctx:    ctx,
 		cancel: cancel,
 
-		sender:          sender,
+		senders:         []*senderQueue{},
 		collectInterval: time.Duration(collectInterval),
 		collectCount:    collectCount-1,
 		sendCountdown:   collectCount-1,
 
 		monitors: []*Monitor{},
+	}
+	if sender != nil {
+		ms.senders = append(ms.senders, newSenderQueue(DefaultSender, sender, collectCount))
+	}
+	return ms
+}
+
+// Sets an outbox to which all payloads are written
+// before they are posted via the default sender. Any
+// entries left over in the outbox from a previous run
+// are queued so they are posted with the next
+// collection cycle.
+func (ms *MonitorService) SetOutbox(outbox *events.Outbox) error {
+	return ms.SetSenderOutbox(DefaultSender, outbox)
+}
+
+// Sets an outbox to which all payloads are written
+// before they are posted via the named sender. Any
+// entries left over in the outbox from a previous run
+// are queued for the sender so they are posted with
+// the next collection cycle. Entries that cannot be
+// decoded are moved to the outbox's quarantine.
+func (ms *MonitorService) SetSenderOutbox(name string, outbox *events.Outbox) error {
+
+	var (
+		err error
+
+		event *cloudevents.Event
+	)
+
+	ms.lock.Lock()
+	q := ms.senderQueue(name)
+	ms.lock.Unlock()
+	if q == nil {
+		return fmt.Errorf("sender '%s' has not been added", name)
+	}
+
+	// the outbox is drained without the lock held.
+	// entries that cannot be decoded are moved to
+	// the outbox's quarantine so they are not lost.
+	quarantined := []string{}
+
+	pending := outbox.Pending()
+	drained := make([]*eventPayload, 0, len(pending))
+	queuedEvents := []*cloudevents.Event{}
+	for i := range pending {
+		entry := &pending[i]
+		if event, err = entry.Event(); err != nil {
+			logger.ErrorMessage(
+				"monitorService.SetOutbox(): Quarantining outbox entry with id %s as it could not be decoded: %s",
+				entry.ID, err.Error(),
+			)
+			quarantined = append(quarantined, entry.ID)
+			continue
+		}
+		if event.Type() != networkMetricEventType {
+			queuedEvents = append(queuedEvents, event)
+			continue
+		}
+		ep := &eventPayload{
+			id:        entry.ID,
+			published: true,
+		}
+		if err = json.Unmarshal(event.Data(), ep); err != nil {
+			logger.ErrorMessage(
+				"monitorService.SetOutbox(): Quarantining outbox entry with id %s as its data could not be unmarshalled: %s",
+				entry.ID, err.Error(),
+			)
+			quarantined = append(quarantined, entry.ID)
+			continue
+		}
+		drained = append(drained, ep)
+	}
+	if len(quarantined) > 0 {
+		if err = outbox.Quarantine(quarantined...); err != nil {
+			return err
+		}
+	}
+	logger.DebugMessage(
+		"monitorService.SetOutbox(): Queued %d payloads and %d events from outbox for posting.",
+		len(drained), len(queuedEvents),
+	)
 
-		// payload for each snapshot collected
-		eventPayloads: make([]*eventPayload, 0, collectCount),
+	defer ms.writeOutboxes()
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	// spool the backlog collected before
+	// the outbox was set
+	backlog := make([]*cloudevents.Event, 0, len(q.eventPayloads)+len(q.queuedEvents))
+	for _, data := range q.eventPayloads {
+		backlog = append(backlog, newPayloadEvent(data))
+	}
+	backlog = append(backlog, q.queuedEvents...)
+	if len(backlog) > 0 {
+		ms.spoolEvents(outbox, backlog...)
+	}
+
+	q.outbox = outbox
+	q.eventPayloads = append(drained, q.eventPayloads...)
+	q.queuedEvents = append(queuedEvents, q.queuedEvents...)
+	ms.enforceBufferLimits(q)
+	return nil
+}
+
+// Sets a retry manager that determines when events
+// that were rejected by the default sender are
+// reposted and when they are given up on. Without a
+// retry manager rejected events are reposted every
+// send cycle.
+func (ms *MonitorService) SetRetryManager(retryManager *events.RetryManager) {
+	_ = ms.SetSenderRetryManager(DefaultSender, retryManager)
+}
+
+// Sets a bus to which all new monitor snapshot
+// events are published for local subscribers.
+func (ms *MonitorService) SetEventBus(eventBus *events.Bus) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.eventBus = eventBus
+}
+
+// Queues an event that is not a monitor snapshot, such
+// as a vpn or mesh lifecycle event, to be posted via the
+// service's sender with the next send cycle. The event
+// is published to the event bus immediately.
+func (ms *MonitorService) PostEvent(event *cloudevents.Event) {
+	defer ms.writeOutboxes()
+	defer ms.publishEvents()
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.queueEvent(event)
+}
+
+// queues the event to be posted by each sender and to
+// be published to the event bus. must be called with
+// the service lock held.
+func (ms *MonitorService) queueEvent(event *cloudevents.Event) {
+	if ms.eventBus != nil {
+		ms.busEvents = append(ms.busEvents, event)
+	}
+	for _, q := range ms.senders {
+		// each sender posts its own copy as
+		// senders may modify the event
+		e := event.Clone()
+		q.queuedEvents = append(q.queuedEvents, &e)
+		if q.outbox != nil {
+			ms.spoolEvents(q.outbox, &e)
+		}
 	}
 }
 
@@ -85,11 +300,22 @@ func (ms *MonitorService) NewMonitor(name string) *Monitor {
 	ms.lock.Lock()
 	defer ms.lock.Unlock()
 
-	monitor := &Monitor{
-		name:     name,
-		counters: []*Counter{},
+	return ms.newMonitor(name)
+}
+
+func (ms *MonitorService) newMonitor(name string) *Monitor {
 
-		lock: &ms.lock,
+	monitor := &Monitor{
+		name:       name,
+		counters:   []*Counter{},
+		gauges:     []*Gauge{},
+		histograms: []*Histogram{},
+		derived:    []*DerivedMetric{},
+
+		// metrics are added and deleted under the
+		// monitor's own lock so doing so does not
+		// wait for the service to post events
+		lock: &sync.Mutex{},
 	}
 	ms.monitors = append(ms.monitors, monitor)
 
@@ -103,26 +329,57 @@ func (ms *MonitorService) Start() error {
 
 func (ms *MonitorService) collect() (time.Duration, error) {
 	ms.lock.Lock()
-	defer ms.lock.Unlock()
 
-	ms.collectEvents()
-	if ms.sendCountdown == 0 {
-		ms.postEvents()
+	ms.collectEvents(false)
+	alerts := ms.evaluateAlerts()
+	posted := ms.sendCountdown == 0
+	if posted {
+		ms.postEvents(false)
+		ms.resetWindows()
 		ms.sendCountdown = ms.collectCount
 	} else {
 		ms.sendCountdown--
 	}
+	collectInterval := ms.collectInterval
+	ms.lock.Unlock()
+
+	ms.publishEvents()
+	ms.writeOutboxes()
+	if posted {
+		ms.saveHistory(false)
+	}
+
+	// alert callbacks are called without the lock
+	// held so they can use the monitor service
+	notifyAlerts(alerts)
 
 	// metrics collected every second
-	return ms.collectInterval, nil
+	return collectInterval, nil
 }
 
-func (ms *MonitorService) collectEvents() {
+// collects snapshots of all monitors that are due
+// to be collected or of all monitors if forced
+func (ms *MonitorService) collectEvents(force bool) {
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
 
 	addPayload := false
 	eventPayload := eventPayload{}
 	for _, m := range ms.monitors {
-		if len(m.counters) > 0 {
+		// hooks are called without the monitor's lock
+		// held so they can add and delete metrics
+		hooks, due := m.due(now, force)
+		if !due {
+			continue
+		}
+		for _, hook := range hooks {
+			hook()
+		}
+
+		// metrics may be added or deleted concurrently
+		// so the monitor is locked while it is collected
+		m.lock.Lock()
+		if len(m.counters) > 0 || len(m.gauges) > 0 || len(m.histograms) > 0 || len(m.derived) > 0 {
 			monitorSnapshot := monitorSnapshot{
 				Name: m.name,
 			}
@@ -135,25 +392,151 @@ func (ms *MonitorService) collectEvents() {
 					addPayload = true	
 				}
 			}	
+			for _, g := range m.gauges {
+				gaugeSnapshot := g.collect()
+				if gaugeSnapshot != nil {
+					monitorSnapshot.Gauges = append(monitorSnapshot.Gauges, gaugeSnapshot)
+					addPayload = true
+				}
+			}
+			for _, h := range m.histograms {
+				histogramSnapshot := h.collect()
+				if histogramSnapshot != nil {
+					monitorSnapshot.Histograms = append(monitorSnapshot.Histograms, histogramSnapshot)
+					addPayload = true
+				}
+			}
+			// derived metrics are computed in the order
+			// added so they may be derived from each other
+			for _, d := range m.derived {
+				derivedSnapshot := d.collect()
+				if derivedSnapshot != nil {
+					monitorSnapshot.Derived = append(monitorSnapshot.Derived, derivedSnapshot)
+					addPayload = true
+				}
+			}
 		}
+		m.lock.Unlock()
 	}
 	if addPayload {
-		ms.eventPayloads = append(ms.eventPayloads, &eventPayload)
+		eventPayload.id = uuid.NewString()
+		if ms.history != nil {
+			ms.history.record(&eventPayload)
+		}
+		// the payload is shared by all senders
+		// as it is not modified once collected.
+		// it is spooled to each sender's outbox
+		// so it is not lost if the process exits
+		// before the next send cycle.
+		var event *cloudevents.Event
+		for _, q := range ms.senders {
+			if q.outbox != nil {
+				if event == nil {
+					event = newPayloadEvent(&eventPayload)
+				}
+				ms.spoolEvents(q.outbox, event)
+			}
+			q.eventPayloads = append(q.eventPayloads, &eventPayload)
+			ms.enforceBufferLimits(q)
+		}
+	}
+}
+
+// starts a new send window for
+// all window based derived metrics
+func (ms *MonitorService) resetWindows() {
+	for _, m := range ms.monitors {
+		m.lock.Lock()
+		for _, d := range m.derived {
+			d.resetWindow()
+		}
+		m.lock.Unlock()
+	}
+}
+
+// returns whether the monitor is due to be collected
+// and if so the hooks to call before collecting it
+func (m *Monitor) due(now int64, force bool) ([]func(), bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !force && m.collectInterval > 0 && now-m.lastCollected < m.collectInterval {
+		return nil, false
+	}
+	m.lastCollected = now
+	return m.collectHooks, true
+}
+
+// posts the backlog of each sender. payloads posted
+// for the first time are published to the event bus.
+// events backing off from a failed post are posted
+// only if 'ignoreBackoff' is true.
+func (ms *MonitorService) postEvents(ignoreBackoff bool) {
+
+	newEvents := []*cloudevents.Event{}
+	for _, q := range ms.senders {
+		for _, data := range q.eventPayloads {
+			if !data.published {
+				data.published = true
+				newEvents = append(newEvents, newPayloadEvent(data))
+			}
+		}
+	}
+	if eventBus := ms.eventBus; eventBus != nil && len(newEvents) > 0 {
+		ms.sendWG.Add(1)
+		go func() {
+			defer ms.sendWG.Done()
+			eventBus.Publish(newEvents...)
+		}()
+	}
+
+	for _, q := range ms.senders {
+		ms.postSenderEvents(q, ignoreBackoff)
 	}
 }
 
-func (ms *MonitorService) postEvents() {
-	numEvents := len(ms.eventPayloads)
+func (ms *MonitorService) postSenderEvents(q *senderQueue, ignoreBackoff bool) {
+
+	outbox := q.outbox
+	retryManager := q.retryManager
+	isReady := func(id string) bool {
+		return ignoreBackoff || retryManager == nil || retryManager.IsReady(id)
+	}
 
 	// make a copy of all the payloads that will
-	// be pushed to the cloud asynchronously
-	eventPayloads := make([]*eventPayload, numEvents)
-	copy(eventPayloads, ms.eventPayloads)
-	ms.eventPayloads = ms.eventPayloads[:0]
+	// be pushed to the cloud asynchronously. any
+	// payloads that are backing off from a failed
+	// post remain queued.
+	eventPayloads := make([]*eventPayload, 0, len(q.eventPayloads))
+	backingOff := []*eventPayload{}
+	for _, data := range q.eventPayloads {
+		if !isReady(data.id) {
+			backingOff = append(backingOff, data)
+		} else {
+			eventPayloads = append(eventPayloads, data)
+		}
+	}
+	q.eventPayloads = append(q.eventPayloads[:0], backingOff...)
+
+	queuedEvents := make([]*cloudevents.Event, 0, len(q.queuedEvents))
+	queuedBackingOff := []*cloudevents.Event{}
+	for _, event := range q.queuedEvents {
+		if !isReady(event.Context.GetID()) {
+			queuedBackingOff = append(queuedBackingOff, event)
+		} else {
+			queuedEvents = append(queuedEvents, event)
+		}
+	}
+	q.queuedEvents = append(q.queuedEvents[:0], queuedBackingOff...)
+	numEvents := len(eventPayloads) + len(queuedEvents)
 
 	ms.sendWG.Add(1)
 	go func() {
 		defer ms.sendWG.Done()
+		// changes to the outbox are written after
+		// the lock is released and re-queued events
+		// may have caused payloads to be merged
+		defer ms.writeOutboxes()
 
 		var (
 			err error
@@ -161,62 +544,231 @@ func (ms *MonitorService) postEvents() {
 			postEventErrors []events.CloudEventError
 		)
 
+		// ensure the events being posted have been
+		// spooled before they are removed from the
+		// outbox once posted
+		ms.writeOutboxes()
+
 		events := make([]*event.Event, 0, numEvents)
 		for _, data := range eventPayloads {
-			eventUUID := uuid.NewString()
-
-			event := cloudevents.NewEvent()
-			event.SetID(eventUUID)
-			event.SetType(networkMetricEventType)
-			event.SetSource("urn:mycs")
-			event.SetSubject("Application Monitor Snapshot")
-			event.SetDataContentType("application/json")
-			event.SetTime(time.Now())
-			if err = event.SetData(cloudevents.ApplicationJSON, data); err != nil {
-				logger.ErrorMessage(
-					"monitorService.postEvents(): Unable to add monitor payload to cloud event instance with id \"%s\": %s",
-					eventUUID, err.Error(),
-				)
-			}
-			events = append(events, &event)
+			events = append(events, newPayloadEvent(data))
 		}
+		events = append(events, queuedEvents...)
 		if len(events) > 0 {
-			if postEventErrors, err = ms.sender.PostMeasurementEvents(events); err != nil {
+			if postEventErrors, err = q.sender.PostMeasurementEvents(events); err != nil {
 				logger.ErrorMessage(
-					"monitorService.postEvents(): Unable to post measurement events. Will attempt to re-post in next cycle: %s",
-					err.Error(),
+					"monitorService.postEvents(): Unable to post measurement events via sender '%s'. Will attempt to re-post in next cycle: %s",
+					q.name, err.Error(),
 				)
+				if retryManager != nil {
+					// the post failing as a whole is not the fault
+					// of any one event, such as when the network is
+					// down, so the events back off without the
+					// failure counting as an attempt. they remain in
+					// the outbox and are only dead-lettered if the
+					// backend rejects them.
+					for _, event := range events {
+						retryManager.Deferred(event.Context.GetID())
+					}
+				}
 				// put back the counters
 				ms.lock.Lock()
-				ms.eventPayloads = append(eventPayloads, ms.eventPayloads...)
+				q.eventPayloads = append(eventPayloads, q.eventPayloads...)
+				q.queuedEvents = append(queuedEvents, q.queuedEvents...)
+				ms.enforceBufferLimits(q)
 				ms.lock.Unlock()
 
-			} else if len(postEventErrors) > 0 {
+			} else {
 				repostList := []*eventPayload{}
+				repostEvents := []*cloudevents.Event{}
+				reposted := make(map[string]bool)
 				for _, e := range postEventErrors {
+					eventID := e.Event.Context.GetID()
 					logger.ErrorMessage(
-						"monitorService.postEvents(): Event with id %s failed to post with error: %s",
-						e.Event.Context.GetID(), e.Error,
+						"monitorService.postEvents(): Event with id %s failed to post via sender '%s' with error: %s",
+						eventID, q.name, e.Error,
 					)
-					ep := new(eventPayload)
-					if err = json.Unmarshal(e.Event.Data(), &ep); err != nil {
+					if retryManager != nil && !retryManager.Failed(e.Event, e.Err()) {
+						// event has been moved to the dead-letter store
+						continue
+					}
+					if e.Event.Type() != networkMetricEventType {
+						repostEvents = append(repostEvents, e.Event)
+						reposted[eventID] = true
+						continue
+					}
+					ep := &eventPayload{
+						id:        eventID,
+						published: true,
+					}
+					if err = json.Unmarshal(e.Event.Data(), ep); err != nil {
 						logger.ErrorMessage(
 							"monitorService.postEvents(): Unable to unmarshal data for event with id %s to queue for reposting: %s",
-							e.Event.Context.GetID(), err.Error(),
+							eventID, err.Error(),
 						)
 					} else {
 						repostList = append(repostList, ep)
+						reposted[eventID] = true
 					}
 				}
-				// put back counters that were not pushed to the event bus
-				ms.lock.Lock()
-				ms.eventPayloads = append(repostList, ms.eventPayloads...)
-				ms.lock.Unlock()
+
+				done := make([]string, 0, len(events))
+				for _, event := range events {
+					if eventID := event.Context.GetID(); !reposted[eventID] {
+						done = append(done, eventID)
+					}
+				}
+				if outbox != nil {
+					removeFromOutbox(outbox, done)
+				}
+				if retryManager != nil {
+					retryManager.Succeeded(done...)
+				}
+
+				if len(repostList) > 0 || len(repostEvents) > 0 {
+					// put back counters that were not pushed to the event bus
+					ms.lock.Lock()
+					q.eventPayloads = append(repostList, q.eventPayloads...)
+					q.queuedEvents = append(repostEvents, q.queuedEvents...)
+					ms.enforceBufferLimits(q)
+					ms.lock.Unlock()
+				}
 			}
 		}
 	}()
 }
 
+// returns a cloud event with the given payload
+func newPayloadEvent(data *eventPayload) *cloudevents.Event {
+
+	event := cloudevents.NewEvent()
+	event.SetID(data.id)
+	event.SetType(networkMetricEventType)
+	event.SetSource("urn:mycs")
+	event.SetSubject("Application Monitor Snapshot")
+	event.SetDataContentType("application/json")
+	event.SetTime(time.Now())
+	if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		logger.ErrorMessage(
+			"monitorService.postEvents(): Unable to add monitor payload to cloud event instance with id \"%s\": %s",
+			data.id, err.Error(),
+		)
+	}
+	return &event
+}
+
+// publishes the events queued for the event bus in the
+// order they were queued. must be called without the
+// service lock held.
+func (ms *MonitorService) publishEvents() {
+	ms.busLock.Lock()
+	defer ms.busLock.Unlock()
+
+	ms.lock.Lock()
+	eventBus := ms.eventBus
+	pending := ms.busEvents
+	ms.busEvents = nil
+	ms.lock.Unlock()
+
+	if eventBus != nil && len(pending) > 0 {
+		eventBus.Publish(pending...)
+	}
+}
+
+// queues the given events to be written to the
+// outbox. must be called with the service lock held.
+func (ms *MonitorService) spoolEvents(outbox *events.Outbox, cloudEvents ...*cloudevents.Event) {
+	w := ms.pendingOutboxWrites(outbox)
+	w.add = append(w.add, cloudEvents...)
+}
+
+// queues the ids of events to be removed from the
+// outbox. must be called with the service lock held.
+func (ms *MonitorService) unspoolEvents(outbox *events.Outbox, ids ...string) {
+	w := ms.pendingOutboxWrites(outbox)
+	w.remove = append(w.remove, ids...)
+}
+
+func (ms *MonitorService) pendingOutboxWrites(outbox *events.Outbox) *outboxWrites {
+	if ms.outboxWrites == nil {
+		ms.outboxWrites = make(map[*events.Outbox]*outboxWrites)
+	}
+	w, exists := ms.outboxWrites[outbox]
+	if !exists {
+		w = &outboxWrites{}
+		ms.outboxWrites[outbox] = w
+	}
+	return w
+}
+
+// writes all queued changes to the outboxes with a
+// single append and removal per outbox. events are
+// appended before any are removed so payloads that
+// replace others are spooled first. must be called
+// without the service lock held.
+func (ms *MonitorService) writeOutboxes() {
+	ms.outboxLock.Lock()
+	defer ms.outboxLock.Unlock()
+
+	ms.lock.Lock()
+	pending := ms.outboxWrites
+	ms.outboxWrites = nil
+	ms.lock.Unlock()
+
+	for outbox, w := range pending {
+		if len(w.add) > 0 {
+			addToOutbox(outbox, w.add)
+		}
+		if len(w.remove) > 0 {
+			removeFromOutbox(outbox, w.remove)
+		}
+	}
+}
+
+// writes the given events to the outbox so they
+// are not lost if the process exits before they
+// have been posted
+func addToOutbox(outbox *events.Outbox, cloudEvents []*cloudevents.Event) {
+
+	var (
+		err error
+
+		dataPayload *events.PublishDataInput
+	)
+
+	entries := make([]events.OutboxEntry, 0, len(cloudEvents))
+	for _, event := range cloudEvents {
+		if dataPayload, err = outboxEncoder.Encode(event); err != nil {
+			logger.ErrorMessage(
+				"monitorService.addToOutbox(): Unable to encode event with id %s for outbox: %s",
+				event.Context.GetID(), err.Error(),
+			)
+			continue
+		}
+		entries = append(entries, events.OutboxEntry{
+			ID:    event.Context.GetID(),
+			Input: *dataPayload,
+		})
+	}
+	if err = outbox.Append(entries...); err != nil {
+		logger.ErrorMessage(
+			"monitorService.addToOutbox(): Unable to write events to outbox: %s",
+			err.Error(),
+		)
+	}
+}
+
+// removes all events that have been posted
+// or given up on from the outbox
+func removeFromOutbox(outbox *events.Outbox, ids []string) {
+	if err := outbox.Remove(ids...); err != nil {
+		logger.ErrorMessage(
+			"monitorService.removeFromOutbox(): Unable to remove posted events from outbox: %s",
+			err.Error(),
+		)
+	}
+}
+
 func (ms *MonitorService) Stop() {
 
 	if ms.snapshotTimer != nil {
@@ -228,15 +780,89 @@ func (ms *MonitorService) Stop() {
 	}
 	ms.sendWG.Wait()
 
-	// ensure all data that is waiting to
-	// be collected or posted are processed
+	// ensure all data that is waiting to be
+	// collected or posted are processed. events
+	// that are backing off from a failed post are
+	// posted as well as there is no later cycle.
+	ms.flush(true)
+	ms.saveHistory(true)
+}
+
+// Collects snapshots of all monitors and posts all
+// pending events immediately without waiting for
+// the next send cycle. The send cycle restarts
+// after the flush.
+func (ms *MonitorService) Flush() {
+	ms.flush(false)
+}
+
+func (ms *MonitorService) flush(ignoreBackoff bool) {
 	ms.lock.Lock()
-	ms.collectEvents()
-	ms.postEvents()
+	ms.collectEvents(true)
+	alerts := ms.evaluateAlerts()
+	ms.postEvents(ignoreBackoff)
+	ms.resetWindows()
+	ms.sendCountdown = ms.collectCount
 	ms.lock.Unlock()
+
+	ms.publishEvents()
+	ms.writeOutboxes()
+	ms.saveHistory(false)
+	notifyAlerts(alerts)
 	ms.sendWG.Wait()
 }
 
+// Sets the milliseconds between collections. The
+// new interval takes effect after the next
+// collection.
+func (ms *MonitorService) SetCollectInterval(collectInterval int) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.collectInterval = time.Duration(collectInterval)
+}
+
+// Sets the number of collections after which the
+// collected snapshots are posted.
+func (ms *MonitorService) SetCollectCount(collectCount int) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if collectCount < 1 {
+		collectCount = 1
+	}
+	ms.collectCount = collectCount - 1
+	if ms.sendCountdown > ms.collectCount {
+		ms.sendCountdown = ms.collectCount
+	}
+}
+
+// Sets the minimum milliseconds between collections
+// of the monitor. The monitor is collected with the
+// first collection of the service after the interval
+// has elapsed so an interval less than the service's
+// collect interval has no effect. An interval of 0
+// collects the monitor with every collection.
+func (m *Monitor) SetCollectInterval(collectInterval int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.collectInterval = int64(collectInterval)
+}
+
+// Adds a function that is called before each
+// collection of the monitor so it can update the
+// monitor's metrics. The function is called on the
+// collector's goroutine with the monitor service's
+// lock held so it may add and delete the monitor's
+// metrics but must not call the service.
+func (m *Monitor) OnCollect(hook func()) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.collectHooks = append(m.collectHooks, hook)
+}
+
 func (m *Monitor) AddCounter(counter *Counter) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -253,8 +879,69 @@ func (m *Monitor) DeleteCounter(counter *Counter) {
 	for i := j; i >= 0; i-- {
 		if m.counters[i] == counter {
 			copy(m.counters[i:], m.counters[i+1:])
+			m.counters = m.counters[:j]
+			break
+		}
+	}
+}
+
+func (m *Monitor) AddGauge(gauge *Gauge) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.gauges = append(m.gauges, gauge)
+}
+
+func (m *Monitor) DeleteGauge(gauge *Gauge) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, g := range m.gauges {
+		if g == gauge {
+			m.gauges = append(m.gauges[:i], m.gauges[i+1:]...)
+			break
+		}
+	}
+}
+
+func (m *Monitor) AddHistogram(histogram *Histogram) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.histograms = append(m.histograms, histogram)
+}
+
+func (m *Monitor) DeleteHistogram(histogram *Histogram) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, h := range m.histograms {
+		if h == histogram {
+			m.histograms = append(m.histograms[:i], m.histograms[i+1:]...)
+			break
+		}
+	}
+}
+
+// Adds a metric derived from another metric. Derived
+// metrics are computed in the order they are added
+// so a metric's source must be added before it if
+// the source is also a derived metric.
+func (m *Monitor) AddDerivedMetric(derived *DerivedMetric) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.derived = append(m.derived, derived)
+}
+
+func (m *Monitor) DeleteDerivedMetric(derived *DerivedMetric) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, d := range m.derived {
+		if d == derived {
+			m.derived = append(m.derived[:i], m.derived[i+1:]...)
 			break
 		}
 	}
-	m.counters = m.counters[:j]
 }
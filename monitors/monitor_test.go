@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,6 +15,7 @@ import (
 	"github.com/appbricks/mycloudspace-common/events"
 	"github.com/appbricks/mycloudspace-common/monitors"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mevansam/goutils/crypto"
 	"github.com/mevansam/goutils/utils"
 
 	. "github.com/onsi/ginkgo"
@@ -104,8 +109,995 @@ var _ = Describe("Monitors", func() {
 		Expect(s.numEvents).To(Equal(16))
 		Expect(s.cumalativeValue).To(Equal(int(atomic.LoadInt64(&cumalativeValue))))
 	})
+
+	It("collects gauges and histograms along with counters", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		monitor := msvc.NewMonitor("testMonitor")
+		counter := monitors.NewCounter("testCounter", false, true)
+		monitor.AddCounter(counter)
+		gauge := monitors.NewGauge("activePeers")
+		monitor.AddGauge(gauge)
+		unsetGauge := monitors.NewGauge("rtt")
+		monitor.AddGauge(unsetGauge)
+		histogram := monitors.NewHistogram("latency", []float64{10, 50, 100})
+		monitor.AddHistogram(histogram)
+
+		gauge.Set(3)
+		gauge.Dec()
+		for _, v := range []float64{5, 10, 20, 75, 200} {
+			histogram.Observe(v)
+		}
+		msvc.Stop()
+
+		Expect(len(rs.events)).To(Equal(1))
+		data := make(map[string]interface{})
+		err = json.Unmarshal(rs.events[0].Data(), &data)
+		Expect(err).NotTo(HaveOccurred())
+
+		// counter has no value so it is not collected
+		Expect(utils.MustGetValueAtPath("monitors/0/counters", data)).To(BeNil())
+		Expect(len(utils.MustGetValueAtPath("monitors/0/gauges", data).([]interface{}))).To(Equal(1))
+		Expect(utils.MustGetValueAtPath("monitors/0/gauges/0/name", data)).To(Equal("activePeers"))
+		Expect(utils.MustGetValueAtPath("monitors/0/gauges/0/value", data)).To(Equal(float64(2)))
+		Expect(utils.MustGetValueAtPath("monitors/0/histograms/0/name", data)).To(Equal("latency"))
+		Expect(utils.MustGetValueAtPath("monitors/0/histograms/0/count", data)).To(Equal(float64(5)))
+		Expect(utils.MustGetValueAtPath("monitors/0/histograms/0/sum", data)).To(Equal(float64(310)))
+		Expect(utils.MustGetValueAtPath("monitors/0/histograms/0/min", data)).To(Equal(float64(5)))
+		Expect(utils.MustGetValueAtPath("monitors/0/histograms/0/max", data)).To(Equal(float64(200)))
+		Expect(utils.MustGetValueAtPath("monitors/0/histograms/0/counts", data)).To(Equal([]interface{}{
+			float64(2), float64(1), float64(1), float64(1),
+		}))
+
+		// histograms are reset with each snapshot
+		Expect(histogram.Count()).To(Equal(uint64(0)))
+		Expect(gauge.Get()).To(Equal(float64(2)))
+	})
+
+	It("persists unposted snapshots to an outbox and posts them after a restart", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		outboxPath := filepath.Join(tmpDir, "outbox.log")
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 2, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+
+		counter := monitors.NewCounter("testCounter", true, false)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		for i := 1; i <= 5; i++ {
+			counter.Set(int64(i * 10))
+			time.Sleep(100 * time.Millisecond)
+		}
+		msvc.Stop()
+		Expect(fs.posts).To(BeNumerically(">", 0))
+
+		pending := outbox.Pending()
+		Expect(len(pending)).To(BeNumerically(">", 0))
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		// restart with a sender that succeeds
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		rs := &recordingSender{}
+		msvc = monitors.NewMonitorService(rs, 2, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+		msvc.Stop()
+
+		Expect(len(rs.events)).To(Equal(len(pending)))
+		total := 0
+		for i, e := range rs.events {
+			Expect(e.Context.GetID()).To(Equal(pending[i].ID))
+
+			data := make(map[string]interface{})
+			err = json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+			total += int((utils.MustGetValueAtPath("monitors/0/counters/0/value", data)).(float64))
+		}
+		Expect(total).To(Equal(50))
+		Expect(outbox.Len()).To(Equal(0))
+	})
+
+	It("posts spooled snapshots after a restart with an encrypting default encoder", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		outboxPath := filepath.Join(tmpDir, "outbox.log")
+
+		encoder, err := events.NewPayloadEncoder(events.CodecZlib, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer events.SetDefaultEncoder(encoder)
+
+		sessionCrypt, err := crypto.NewCrypt([]byte("0123456789abcdef0123456789abcdef"))
+		Expect(err).NotTo(HaveOccurred())
+		events.SetDefaultEncoder(encoder.WithCrypt(&testCryptProvider{crypt: sessionCrypt}))
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+
+		counter := monitors.NewCounter("testCounter", true, false)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		counter.Set(10)
+		msvc.Flush()
+		counter.Set(30)
+		msvc.Stop()
+
+		// snapshots are spooled without encryption
+		pending := outbox.Pending()
+		Expect(len(pending)).To(Equal(2))
+		for _, entry := range pending {
+			Expect(entry.Input.Encrypted).To(BeFalse())
+		}
+
+		// an entry encrypted with the session key
+		// which cannot be decoded after a restart
+		event := cloudevents.NewEvent()
+		event.SetID("encrypted-entry")
+		event.SetType("io.appbricks.mycs.test")
+		event.SetSource("urn:mycs:test")
+		encryptedInput, err := events.NewPublishDataInput(&event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(encryptedInput.Encrypted).To(BeTrue())
+		err = outbox.Append(events.OutboxEntry{ID: event.ID(), Input: *encryptedInput})
+		Expect(err).NotTo(HaveOccurred())
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		// restart with a new session key
+		// and a sender that succeeds
+		renewedCrypt, err := crypto.NewCrypt([]byte("fedcba9876543210fedcba9876543210"))
+		Expect(err).NotTo(HaveOccurred())
+		events.SetDefaultEncoder(encoder.WithCrypt(&testCryptProvider{crypt: renewedCrypt}))
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		rs := &recordingSender{}
+		msvc = monitors.NewMonitorService(rs, 1, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+		msvc.Stop()
+
+		Expect(len(rs.events)).To(Equal(2))
+		total := 0
+		for i, e := range rs.events {
+			Expect(e.Context.GetID()).To(Equal(pending[i].ID))
+
+			data := make(map[string]interface{})
+			err = json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+			total += int((utils.MustGetValueAtPath("monitors/0/counters/0/value", data)).(float64))
+		}
+		Expect(total).To(Equal(30))
+		Expect(outbox.Len()).To(Equal(0))
+
+		// the entry that could not be decoded
+		// is retained in the quarantine
+		quarantine, err := events.NewOutbox(outbox.QuarantinePath(), 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer quarantine.Close()
+		quarantined := quarantine.Pending()
+		Expect(len(quarantined)).To(Equal(1))
+		Expect(quarantined[0].ID).To(Equal("encrypted-entry"))
+		Expect(quarantined[0].Input).To(Equal(*encryptedInput))
+	})
+
+	It("spools snapshots to the outbox when they are collected", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+
+		outbox, err := events.NewOutbox(filepath.Join(tmpDir, "outbox.log"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 100, 50)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+
+		counter := monitors.NewCounter("testCounter", true, false)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		for i := 1; i <= 3; i++ {
+			counter.Set(int64(i * 10))
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		// snapshots are spooled before the
+		// send cycle posts them
+		Expect(outbox.Len()).To(BeNumerically(">=", 3))
+		rs.mx.Lock()
+		Expect(len(rs.events)).To(Equal(0))
+		rs.mx.Unlock()
+
+		msvc.Stop()
+		Expect(len(rs.events)).To(BeNumerically(">=", 3))
+		Expect(outbox.Len()).To(Equal(0))
+	})
+
+	It("publishes new snapshot events to the event bus", func() {
+
+		bus := events.NewBus(0)
+		defer bus.Close()
+		sub := bus.Subscribe("io.appbricks.mycs.network.*", 10, events.DropNewest)
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		msvc.SetEventBus(bus)
+
+		counter := monitors.NewCounter("testCounter", true, true)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		counter.Set(10)
+		time.Sleep(150 * time.Millisecond)
+		counter.Set(30)
+		time.Sleep(150 * time.Millisecond)
+		msvc.Stop()
+
+		// reposts of failed events are not republished
+		Expect(fs.posts).To(BeNumerically(">", 2))
+		Expect(len(sub.Events())).To(Equal(2))
+	})
+
+	It("posts queued lifecycle events via the sender and retains them until posted", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		outboxPath := filepath.Join(tmpDir, "outbox.log")
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		bus := events.NewBus(0)
+		defer bus.Close()
+		sub := bus.Subscribe("io.appbricks.mycs.vpn.*", 10, events.DropNewest)
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+		msvc.SetEventBus(bus)
+
+		event, err := events.NewLifecycleEvent(
+			events.VPNConnectedEventType,
+			"VPN Session Connected",
+			&events.VPNSessionData{
+				SessionID: "test-session",
+				Interface: "wg0",
+				VPNType:   "wireguard",
+				StartTime: time.Now(),
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		msvc.PostEvent(event)
+		Expect(len(sub.Events())).To(Equal(1))
+
+		msvc.Stop()
+		Expect(fs.posts).To(Equal(1))
+		Expect(outbox.Len()).To(Equal(1))
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		// restart with a sender that succeeds
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		rs := &recordingSender{}
+		msvc = monitors.NewMonitorService(rs, 1, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+		msvc.Stop()
+
+		Expect(len(rs.events)).To(Equal(1))
+		Expect(rs.events[0].ID()).To(Equal(event.ID()))
+		Expect(rs.events[0].Type()).To(Equal(events.VPNConnectedEventType))
+
+		data := events.VPNSessionData{}
+		err = json.Unmarshal(rs.events[0].Data(), &data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data.SessionID).To(Equal("test-session"))
+		Expect(data.Interface).To(Equal("wg0"))
+		Expect(outbox.Len()).To(Equal(0))
+	})
+
+	It("publishes queued events without holding the service lock", func() {
+
+		bus := events.NewBus(time.Second)
+		defer bus.Close()
+		// a subscriber that never reads blocks
+		// each publish for the block timeout
+		sub := bus.Subscribe("io.appbricks.mycs.vpn.*", 0, events.Block)
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+		msvc.SetEventBus(bus)
+
+		event, err := events.NewLifecycleEvent(
+			events.VPNConnectedEventType,
+			"VPN Session Connected",
+			&events.VPNSessionData{
+				SessionID: "test-session",
+				Interface: "wg0",
+				VPNType:   "wireguard",
+				StartTime: time.Now(),
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		posted := make(chan struct{})
+		go func() {
+			defer close(posted)
+			msvc.PostEvent(event)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		// the service remains usable while
+		// the publisher is blocked
+		start := time.Now()
+		msvc.NewMonitor("testMonitor")
+		msvc.SetCollectInterval(100)
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+
+		<-posted
+		Expect(sub.Dropped()).To(Equal(uint64(1)))
+		msvc.Stop()
+		Expect(len(rs.events)).To(Equal(1))
+	})
+
+	It("deletes metrics from a monitor", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		sent := monitors.NewCounter("sent", false, false)
+		recd := monitors.NewCounter("recd", false, false)
+		age := monitors.NewGauge("age")
+		monitor := msvc.NewMonitor("testMonitor")
+		monitor.AddCounter(sent)
+		monitor.AddCounter(recd)
+		monitor.AddGauge(age)
+		age.Set(1)
+
+		metricNames := func() []string {
+			data := struct {
+				Monitors []struct {
+					Counters []struct {
+						Name string `json:"name"`
+					} `json:"counters"`
+					Gauges []struct {
+						Name string `json:"name"`
+					} `json:"gauges"`
+				} `json:"monitors"`
+			}{}
+			err = json.Unmarshal(rs.events[len(rs.events)-1].Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+
+			names := []string{}
+			for _, c := range data.Monitors[0].Counters {
+				names = append(names, c.Name)
+			}
+			for _, g := range data.Monitors[0].Gauges {
+				names = append(names, g.Name)
+			}
+			return names
+		}
+
+		// deleting a counter that was not added is a no-op
+		monitor.DeleteCounter(monitors.NewCounter("other", false, false))
+		msvc.Flush()
+		Expect(metricNames()).To(Equal([]string{"sent", "recd", "age"}))
+
+		monitor.DeleteCounter(sent)
+		monitor.DeleteGauge(age)
+		msvc.Flush()
+		Expect(metricNames()).To(Equal([]string{"recd"}))
+	})
+
+	It("adds and deletes metrics while the service is collecting", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 5)
+		monitor := msvc.NewMonitor("testMonitor")
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+
+		// add and remove per-peer metrics as the
+		// wireguard client does when peers churn
+		var wg sync.WaitGroup
+		for p := 0; p < 4; p++ {
+			wg.Add(1)
+			go func(p int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					attribs := map[string]string{"peer": fmt.Sprintf("peer-%d-%d", p, i)}
+					sent := monitors.NewCounterWithAttribs("peerSent", true, false, attribs)
+					age := monitors.NewGaugeWithAttribs("peerHandshakeAge", attribs)
+					monitor.AddCounter(sent)
+					monitor.AddGauge(age)
+					sent.Set(int64(i))
+					age.Set(float64(i))
+					time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+					monitor.DeleteCounter(sent)
+					monitor.DeleteGauge(age)
+				}
+			}(p)
+		}
+		wg.Wait()
+		msvc.Stop()
+
+		// no metric is reported more than once
+		// within a snapshot
+		Expect(len(rs.events)).To(BeNumerically(">", 0))
+		for _, e := range rs.events {
+			data := struct {
+				Monitors []struct {
+					Counters []struct {
+						Attribs map[string]string `json:"attribs"`
+					} `json:"counters"`
+				} `json:"monitors"`
+			}{}
+			err = json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, m := range data.Monitors {
+				peers := make(map[string]bool)
+				for _, c := range m.Counters {
+					Expect(peers[c.Attribs["peer"]]).To(BeFalse())
+					peers[c.Attribs["peer"]] = true
+				}
+			}
+		}
+	})
+
+	It("posts to multiple named senders that fail independently", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+
+		outbox, err := events.NewOutbox(filepath.Join(tmpDir, "outbox.log"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+
+		rs := &recordingSender{}
+		err = msvc.AddSender("local", rs)
+		Expect(err).NotTo(HaveOccurred())
+		err = msvc.AddSender("local", rs)
+		Expect(err).To(HaveOccurred())
+		err = msvc.SetSenderOutbox("unknown", outbox)
+		Expect(err).To(HaveOccurred())
+
+		counter := monitors.NewCounter("testCounter", true, true)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		counter.Set(10)
+		msvc.Flush()
+		counter.Set(30)
+		msvc.Flush()
+
+		// the failing sender reposts its backlog
+		// without duplicating data in the other
+		Expect(fs.posts).To(Equal(2))
+		Expect(len(rs.events)).To(Equal(2))
+		pending := outbox.Pending()
+		Expect(len(pending)).To(Equal(2))
+		for i, e := range rs.events {
+			Expect(e.ID()).To(Equal(pending[i].ID))
+		}
+
+		event, err := events.NewLifecycleEvent(
+			events.VPNConnectedEventType,
+			"VPN Session Connected",
+			&events.VPNSessionData{SessionID: "test-session"},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		msvc.PostEvent(event)
+		msvc.Flush()
+		Expect(len(rs.events)).To(Equal(3))
+		Expect(rs.events[2].ID()).To(Equal(event.ID()))
+		Expect(outbox.Len()).To(Equal(3))
+
+		msvc.RemoveSender("local")
+		counter.Set(60)
+		msvc.Stop()
+		Expect(len(rs.events)).To(Equal(3))
+		Expect(outbox.Len()).To(Equal(4))
+	})
+
+	It("flushes and changes the send cadence without stopping the service", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 100, 50)
+
+		gauge := monitors.NewGauge("testGauge")
+		msvc.NewMonitor("testMonitor").AddGauge(gauge)
+		gauge.Set(1)
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(200 * time.Millisecond)
+		Expect(len(rs.events)).To(Equal(0))
+
+		// all snapshots collected so far are posted
+		msvc.Flush()
+		flushed := len(rs.events)
+		Expect(flushed).To(BeNumerically(">", 2))
+
+		// post with every collection
+		msvc.SetCollectCount(1)
+		msvc.SetCollectInterval(25)
+		time.Sleep(200 * time.Millisecond)
+		msvc.Stop()
+		Expect(len(rs.events)).To(BeNumerically(">", flushed+2))
+	})
+
+	It("collects monitors with an overridden collect interval less often", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 50)
+
+		fast := monitors.NewGauge("fastGauge")
+		msvc.NewMonitor("fastMonitor").AddGauge(fast)
+		fast.Set(1)
+
+		slow := monitors.NewGauge("slowGauge")
+		slowMonitor := msvc.NewMonitor("slowMonitor")
+		slowMonitor.AddGauge(slow)
+		slowMonitor.SetCollectInterval(10000)
+		slow.Set(1)
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(300 * time.Millisecond)
+		msvc.Stop()
+
+		collections := make(map[string]int)
+		for _, e := range rs.events {
+			data := struct {
+				Monitors []struct {
+					Name string `json:"name"`
+				} `json:"monitors"`
+			}{}
+			err = json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+			for _, m := range data.Monitors {
+				collections[m.Name]++
+			}
+		}
+		Expect(collections["fastMonitor"]).To(BeNumerically(">", 3))
+		// collected once when due and once when stopped
+		Expect(collections["slowMonitor"]).To(Equal(2))
+	})
+
+	It("drops buffered snapshots that exceed the buffer limits", func() {
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		msvc.SetBufferLimits(2, 0, monitors.DropOldestSnapshots)
+
+		counter := monitors.NewCounter("testCounter", true, false)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		for i := 1; i <= 5; i++ {
+			counter.Set(int64(i * 10))
+			time.Sleep(150 * time.Millisecond)
+		}
+		msvc.Stop()
+		Expect(fs.posts).To(BeNumerically(">", 2))
+
+		recorder := httptest.NewRecorder()
+		monitors.NewPrometheusHandler(msvc, "").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		metrics := recorder.Body.String()
+		Expect(metrics).To(MatchRegexp(`(?m)^monitor_service_droppedSnapshots_total [1-9]`))
+		Expect(metrics).To(MatchRegexp(`(?m)^monitor_service_mergedSnapshots_total 0$`))
+	})
+
+	It("merges buffered snapshots that exceed the buffer limits preserving cumalative totals", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		outboxPath := filepath.Join(tmpDir, "outbox.log")
+
+		outbox, err := events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+		msvc.SetBufferLimits(2, 0, monitors.MergeSnapshots)
+
+		counter := monitors.NewCounter("testCounter", true, false)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		for i := 1; i <= 5; i++ {
+			counter.Set(int64(i * 10))
+			time.Sleep(150 * time.Millisecond)
+		}
+		msvc.Stop()
+
+		// only the merged snapshots remain in the outbox
+		pending := outbox.Pending()
+		Expect(len(pending)).To(BeNumerically("<=", 2))
+		err = outbox.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		outbox, err = events.NewOutbox(outboxPath, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		rs := &recordingSender{}
+		msvc = monitors.NewMonitorService(rs, 1, 100)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+		msvc.Stop()
+
+		Expect(len(rs.events)).To(Equal(len(pending)))
+		total, merged := 0, 0
+		for _, e := range rs.events {
+			data := struct {
+				Monitors []struct {
+					Name     string `json:"name"`
+					Counters []struct {
+						Name  string `json:"name"`
+						Value int    `json:"value"`
+					} `json:"counters"`
+				} `json:"monitors"`
+			}{}
+			err = json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, m := range data.Monitors {
+				for _, c := range m.Counters {
+					switch {
+					case m.Name == "testMonitor" && c.Name == "testCounter":
+						total += c.Value
+					case m.Name == "monitor-service" && c.Name == "mergedSnapshots":
+						merged += c.Value
+					}
+				}
+			}
+		}
+		Expect(total).To(Equal(50))
+		Expect(merged).To(BeNumerically(">", 0))
+	})
+
+	It("does not merge snapshots published to the event bus with unpublished snapshots", func() {
+
+		bus := events.NewBus(0)
+		defer bus.Close()
+		sub := bus.Subscribe("io.appbricks.mycs.network.metric", 20, events.DropNewest)
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		msvc.SetEventBus(bus)
+		msvc.SetBufferLimits(1, 0, monitors.MergeSnapshots)
+
+		counter := monitors.NewCounter("testCounter", true, false)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		// each stop collects a snapshot which is
+		// published before its post fails
+		for i := 1; i <= 4; i++ {
+			counter.Set(int64(i * 10))
+			msvc.Stop()
+		}
+		Expect(fs.posts).To(Equal(4))
+
+		// the data of each snapshot is published once
+		total, published := 0, 0
+		for len(sub.Events()) > 0 {
+			e := <-sub.Events()
+			data := struct {
+				Monitors []struct {
+					Name     string `json:"name"`
+					Counters []struct {
+						Value int `json:"value"`
+					} `json:"counters"`
+				} `json:"monitors"`
+			}{}
+			err = json.Unmarshal(e.Data(), &data)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, m := range data.Monitors {
+				if m.Name == "testMonitor" {
+					total += m.Counters[0].Value
+					published++
+				}
+			}
+		}
+		Expect(published).To(Equal(4))
+		Expect(total).To(Equal(40))
+	})
+
+	It("limits the buffered snapshots by their encoded size", func() {
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		msvc.SetBufferLimits(0, 1, monitors.DropNewestSnapshots)
+
+		counter := monitors.NewCounter("testCounter", true, false)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+		counter.Set(10)
+		msvc.Stop()
+
+		// every snapshot exceeds the limit so none are posted
+		Expect(fs.posts).To(Equal(0))
+	})
+
+	It("dead-letters events rejected with permanent errors and retries others", func() {
+
+		deadLetters := events.NewDeadLetterStore(0)
+		rm := events.NewRetryManager(
+			events.RetryPolicy{
+				MaxAttempts:    5,
+				InitialBackoff: 100 * time.Millisecond,
+			},
+			nil,
+			deadLetters,
+		)
+
+		rs := &rejectingSender{
+			posted: map[string]int{},
+		}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+		msvc.SetRetryManager(rm)
+
+		counter := monitors.NewCounter("testCounter", true, true)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		err = msvc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		for i := 1; i <= 6; i++ {
+			counter.Set(int64(i * 10))
+			time.Sleep(100 * time.Millisecond)
+		}
+		time.Sleep(300 * time.Millisecond)
+		msvc.Stop()
+
+		Expect(deadLetters.Len()).To(Equal(1))
+		letter := deadLetters.List()[0]
+		Expect(letter.Permanent).To(BeTrue())
+		Expect(letter.Error).To(HavePrefix("invalid counter value"))
+		Expect(rs.posted[letter.Event.ID()]).To(Equal(1))
+
+		// the busy event was retried with the same
+		// id until it was accepted
+		Expect(rs.posted[rs.busyID]).To(Equal(2))
+		Expect(rs.acceptedValue + rs.rejectedValue).To(Equal(60))
+	})
+
+	It("backs off events of posts that fail as a whole without giving up on them", func() {
+
+		tmpDir, err := os.MkdirTemp("", "monitors")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		outbox, err := events.NewOutbox(filepath.Join(tmpDir, "outbox.log"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer outbox.Close()
+
+		deadLetters := events.NewDeadLetterStore(0)
+		rm := events.NewRetryManager(
+			events.RetryPolicy{
+				MaxAttempts:    2,
+				InitialBackoff: 50 * time.Millisecond,
+			},
+			nil,
+			deadLetters,
+		)
+
+		fs := &failingSender{}
+		msvc := monitors.NewMonitorService(fs, 1, 100)
+		msvc.SetRetryManager(rm)
+		err = msvc.SetOutbox(outbox)
+		Expect(err).NotTo(HaveOccurred())
+
+		counter := monitors.NewCounter("testCounter", true, true)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		counter.Set(10)
+		msvc.Flush()
+		Expect(fs.posts).To(Equal(1))
+
+		// the snapshot is backing off
+		msvc.Flush()
+		Expect(fs.posts).To(Equal(1))
+
+		// failed posts do not count as attempts so the
+		// snapshot is not given up on once the policy's
+		// maximum attempts have failed
+		for i := 2; i <= 3; i++ {
+			time.Sleep(60 * time.Millisecond)
+			msvc.Flush()
+			Expect(fs.posts).To(Equal(i))
+		}
+		Expect(deadLetters.Len()).To(Equal(0))
+		msvc.Stop()
+		Expect(fs.posts).To(Equal(4))
+		Expect(deadLetters.Len()).To(Equal(0))
+
+		// the snapshot remains in the outbox
+		Expect(outbox.Len()).To(Equal(1))
+	})
+
+	It("posts events that are backing off from a failed post when stopped", func() {
+
+		rm := events.NewRetryManager(
+			events.RetryPolicy{
+				InitialBackoff: time.Hour,
+			},
+			nil, nil,
+		)
+
+		bs := &busySender{
+			posted: map[string]int{},
+		}
+		msvc := monitors.NewMonitorService(bs, 1, 100)
+		msvc.SetRetryManager(rm)
+
+		counter := monitors.NewCounter("testCounter", true, true)
+		msvc.NewMonitor("testMonitor").AddCounter(counter)
+
+		counter.Set(10)
+		msvc.Flush()
+		Expect(len(bs.posted)).To(Equal(1))
+		Expect(bs.accepted).To(Equal(0))
+
+		// the rejected snapshot is backing off
+		// so it is not reposted with a flush
+		counter.Set(20)
+		msvc.Flush()
+		Expect(len(bs.posted)).To(Equal(2))
+		Expect(bs.accepted).To(Equal(1))
+		for _, n := range bs.posted {
+			Expect(n).To(Equal(1))
+		}
+
+		// the final flush ignores the backoff
+		msvc.Stop()
+		Expect(len(bs.posted)).To(Equal(2))
+		Expect(bs.accepted).To(Equal(2))
+		for id, n := range bs.posted {
+			if id == bs.busyID {
+				Expect(n).To(Equal(2))
+			} else {
+				Expect(n).To(Equal(1))
+			}
+		}
+	})
 })
 
+type testCryptProvider struct {
+	crypt *crypto.Crypt
+	mx    sync.Mutex
+}
+func (p *testCryptProvider) Crypt() (*crypto.Crypt, *sync.Mutex) {
+	return p.crypt, &p.mx
+}
+
+type busySender struct {
+	posted map[string]int
+
+	busyID   string
+	accepted int
+}
+func (s *busySender) PostMeasurementEvents(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+	resp := []events.CloudEventError{}
+	for _, e := range cloudEvents {
+		s.posted[e.ID()]++
+		if len(s.busyID) == 0 {
+			// reject the first event posted
+			s.busyID = e.ID()
+			resp = append(resp, events.CloudEventError{Event: e, Error: "service busy"})
+			continue
+		}
+		s.accepted++
+	}
+	return resp, nil
+}
+
+type rejectingSender struct {
+	iteration int
+	posted    map[string]int
+
+	busyID string
+
+	acceptedValue,
+	rejectedValue int
+}
+func (s *rejectingSender) PostMeasurementEvents(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+	defer GinkgoRecover()
+
+	s.iteration++
+
+	resp := []events.CloudEventError{}
+	for i, e := range cloudEvents {
+		data := make(map[string]interface{})
+		err := json.Unmarshal(e.Data(), &data)
+		Expect(err).NotTo(HaveOccurred())
+		value := int((utils.MustGetValueAtPath("monitors/0/counters/0/value", data)).(float64))
+
+		s.posted[e.ID()]++
+		if i == 0 && s.iteration == 2 {
+			s.rejectedValue += value
+			resp = append(resp, events.CloudEventError{
+				Event: e,
+				Error: "invalid counter value",
+				Cause: &events.StatusError{StatusCode: http.StatusBadRequest, Message: "invalid counter value"},
+			})
+			continue
+		}
+		if i == 0 && s.iteration == 3 {
+			s.busyID = e.ID()
+			resp = append(resp, events.CloudEventError{Event: e, Error: "service busy"})
+			continue
+		}
+		s.acceptedValue += value
+	}
+	return resp, nil
+}
+
+type failingSender struct {
+	posts int
+}
+func (s *failingSender) PostMeasurementEvents(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+	s.posts++
+	return nil, fmt.Errorf("failing post")
+}
+
+type recordingSender struct {
+	events []*cloudevents.Event
+	mx     sync.Mutex
+}
+func (s *recordingSender) PostMeasurementEvents(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.events = append(s.events, cloudEvents...)
+	return []events.CloudEventError{}, nil
+}
+
 type testSender struct {
 	events []*cloudevents.Event
 
@@ -0,0 +1,361 @@
+package monitors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// OTLPEncoding is the content type with
+// which OTLP/HTTP requests are encoded
+type OTLPEncoding int
+
+const (
+	OTLPProtobuf OTLPEncoding = iota
+	OTLPJSON
+)
+
+// OTLPExporter converts monitor snapshot events to
+// OpenTelemetry metrics and exports them to an OTLP/HTTP
+// metrics endpoint. It can be used as the Sender of a
+// monitor service or as a parallel sink that receives
+// new snapshot events from the service's event bus.
+type OTLPExporter struct {
+	endpoint string
+	encoding OTLPEncoding
+
+	resourceAttribs map[string]string
+	headers         map[string]string
+	httpClient      *http.Client
+}
+
+// Returns an exporter that posts metrics to the given
+// OTLP/HTTP metrics url. i.e. http://localhost:4318/v1/metrics
+func NewOTLPExporter(endpoint string, encoding OTLPEncoding) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		encoding: encoding,
+
+		resourceAttribs: map[string]string{
+			"service.name": "mycs",
+		},
+		headers:    map[string]string{},
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Returns a copy of the exporter that adds the given
+// attributes to the resource of all exported metrics.
+// i.e. 'service.instance.id' to identify the device.
+func (e *OTLPExporter) WithResourceAttributes(attribs map[string]string) *OTLPExporter {
+	ee := *e
+	ee.resourceAttribs = make(map[string]string)
+	for n, v := range e.resourceAttribs {
+		ee.resourceAttribs[n] = v
+	}
+	for n, v := range attribs {
+		ee.resourceAttribs[n] = v
+	}
+	return &ee
+}
+
+// Returns a copy of the exporter that adds
+// the given header to all requests.
+func (e *OTLPExporter) WithHeader(name, value string) *OTLPExporter {
+	ee := *e
+	ee.headers = make(map[string]string)
+	for n, v := range e.headers {
+		ee.headers[n] = v
+	}
+	ee.headers[name] = value
+	return &ee
+}
+
+// Returns a copy of the exporter that uses
+// the given client to send requests.
+func (e *OTLPExporter) WithHTTPClient(httpClient *http.Client) *OTLPExporter {
+	ee := *e
+	ee.httpClient = httpClient
+	return &ee
+}
+
+// Subscribes the exporter to new monitor snapshot
+// events published to the given bus. Events are
+// exported on a best effort basis and failures are
+// only logged. Cancel the returned subscription to
+// stop exporting.
+func (e *OTLPExporter) ExportFrom(bus *events.Bus, bufferSize int) *events.Subscription {
+	return bus.SubscribeFunc(networkMetricEventType, bufferSize, events.DropOldest,
+		func(event *cloudevents.Event) {
+			if _, err := e.PostMeasurementEvents([]*cloudevents.Event{event}); err != nil {
+				logger.ErrorMessage(
+					"OTLPExporter.ExportFrom(): Failed to export event with id %s: %s",
+					event.Context.GetID(), err.Error(),
+				)
+			}
+		},
+	)
+}
+
+// Exports the monitor snapshots of the given events.
+// Events that are not monitor snapshots are ignored.
+func (e *OTLPExporter) PostMeasurementEvents(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+
+	var (
+		err error
+
+		body        []byte
+		contentType string
+		request     *http.Request
+		response    *http.Response
+	)
+
+	exportErrors := []events.CloudEventError{}
+	exported := make([]*cloudevents.Event, 0, len(cloudEvents))
+	payloads := make([]*eventPayload, 0, len(cloudEvents))
+	for _, event := range cloudEvents {
+		if event.Type() != networkMetricEventType {
+			logger.TraceMessage(
+				"OTLPExporter.PostMeasurementEvents(): Ignoring event with id %s of type '%s'.",
+				event.Context.GetID(), event.Type(),
+			)
+			continue
+		}
+		payload := &eventPayload{}
+		if err = json.Unmarshal(event.Data(), payload); err != nil {
+			exportErrors = append(exportErrors, events.CloudEventError{
+				Event: event,
+				Error: fmt.Sprintf("unable to unmarshal monitor snapshot: %s", err.Error()),
+				Cause: &events.DecodeError{Index: -1, Err: events.ErrInvalidEvent, Cause: err},
+			})
+			continue
+		}
+		exported = append(exported, event)
+		payloads = append(payloads, payload)
+	}
+	if len(payloads) == 0 {
+		return exportErrors, nil
+	}
+
+	exportRequest := e.newExportRequest(payloads)
+	if e.encoding == OTLPJSON {
+		contentType = "application/json"
+		if body, err = json.Marshal(exportRequest); err != nil {
+			return nil, err
+		}
+	} else {
+		contentType = "application/x-protobuf"
+		body = exportRequest.marshalProto()
+	}
+
+	if request, err = http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	for name, value := range e.headers {
+		request.Header.Set(name, value)
+	}
+	if response, err = e.httpClient.Do(request); err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return exportErrors, nil
+	}
+
+	body, _ = io.ReadAll(response.Body)
+	statusError := &events.StatusError{
+		StatusCode: response.StatusCode,
+		Message: fmt.Sprintf(
+			"otlp export to '%s' failed: %s",
+			e.endpoint, string(bytes.TrimSpace(body)),
+		),
+	}
+	if response.StatusCode == http.StatusBadRequest {
+		// the receiver will never accept the data
+		// so flag each event as a bad request
+		for _, event := range exported {
+			exportErrors = append(exportErrors, events.CloudEventError{
+				Event: event,
+				Error: fmt.Sprintf("bad request: %s", statusError.Error()),
+				Cause: statusError,
+			})
+		}
+		return exportErrors, nil
+	}
+	return nil, statusError
+}
+
+// converts monitor snapshots to OTLP metrics with one
+// instrumentation scope for each monitor
+func (e *OTLPExporter) newExportRequest(payloads []*eventPayload) *otlpExportMetricsRequest {
+
+	resourceMetrics := &otlpResourceMetrics{
+		Resource: otlpResource{
+			Attributes: otlpAttributes(e.resourceAttribs),
+		},
+	}
+	scopes := make(map[string]*otlpScopeMetrics)
+	metrics := make(map[string]*otlpMetric)
+
+	scopeMetrics := func(monitorName string) *otlpScopeMetrics {
+		sm, exists := scopes[monitorName]
+		if !exists {
+			sm = &otlpScopeMetrics{
+				Scope: otlpScope{Name: monitorName},
+			}
+			scopes[monitorName] = sm
+			resourceMetrics.ScopeMetrics = append(resourceMetrics.ScopeMetrics, sm)
+		}
+		return sm
+	}
+	metric := func(monitorName, kind, name string, newMetric func() *otlpMetric) *otlpMetric {
+		key := monitorName + "/" + kind + "/" + name
+		m, exists := metrics[key]
+		if !exists {
+			m = newMetric()
+			metrics[key] = m
+			sm := scopeMetrics(monitorName)
+			sm.Metrics = append(sm.Metrics, m)
+		}
+		return m
+	}
+
+	for _, payload := range payloads {
+		for _, ms := range payload.Monitors {
+			for _, cs := range ms.Counters {
+				value := cs.Value
+				dp := &otlpNumberDataPoint{
+					Attributes:        otlpAttributes(derefAttribs(cs.Attribs)),
+					StartTimeUnixNano: msToUnixNano(cs.StartTimestamp),
+					TimeUnixNano:      msToUnixNano(cs.Timestamp),
+					AsInt:             &value,
+				}
+				if cs.Cumalative {
+					// cumalative counter snapshots
+					// hold deltas of the total
+					m := metric(ms.Name, "delta", *cs.Name, func() *otlpMetric {
+						return &otlpMetric{
+							Name: *cs.Name,
+							Sum: &otlpSum{
+								AggregationTemporality: otlpTemporalityDelta,
+								IsMonotonic:            true,
+							},
+						}
+					})
+					m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+				} else {
+					m := metric(ms.Name, "cumulative", *cs.Name, func() *otlpMetric {
+						return &otlpMetric{
+							Name: *cs.Name,
+							Sum: &otlpSum{
+								AggregationTemporality: otlpTemporalityCumulative,
+							},
+						}
+					})
+					m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+				}
+			}
+			for _, gs := range ms.Gauges {
+				value := gs.Value
+				m := metric(ms.Name, "gauge", *gs.Name, func() *otlpMetric {
+					return &otlpMetric{
+						Name:  *gs.Name,
+						Gauge: &otlpGauge{},
+					}
+				})
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, &otlpNumberDataPoint{
+					Attributes:   otlpAttributes(derefAttribs(gs.Attribs)),
+					TimeUnixNano: msToUnixNano(gs.Timestamp),
+					AsDouble:     &value,
+				})
+			}
+			// derived metrics are exported as gauges
+			for _, ds := range ms.Derived {
+				value := ds.Value
+				m := metric(ms.Name, "gauge", *ds.Name, func() *otlpMetric {
+					return &otlpMetric{
+						Name:  *ds.Name,
+						Gauge: &otlpGauge{},
+					}
+				})
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, &otlpNumberDataPoint{
+					Attributes:   otlpAttributes(derefAttribs(ds.Attribs)),
+					TimeUnixNano: msToUnixNano(ds.Timestamp),
+					AsDouble:     &value,
+				})
+			}
+			for _, hs := range ms.Histograms {
+				m := metric(ms.Name, "histogram", *hs.Name, func() *otlpMetric {
+					return &otlpMetric{
+						Name: *hs.Name,
+						Histogram: &otlpHistogram{
+							AggregationTemporality: otlpTemporalityDelta,
+						},
+					}
+				})
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, &otlpHistogramDataPoint{
+					Attributes:        otlpAttributes(derefAttribs(hs.Attribs)),
+					StartTimeUnixNano: msToUnixNano(hs.StartTimestamp),
+					TimeUnixNano:      msToUnixNano(hs.Timestamp),
+
+					Count:          hs.Count,
+					Sum:            hs.Sum,
+					BucketCounts:   otlpUint64s(hs.Counts),
+					ExplicitBounds: hs.Bounds,
+					Min:            hs.Min,
+					Max:            hs.Max,
+				})
+			}
+		}
+	}
+
+	return &otlpExportMetricsRequest{
+		ResourceMetrics: []*otlpResourceMetrics{resourceMetrics},
+	}
+}
+
+// returns the given attributes as OTLP
+// key values sorted by key
+func otlpAttributes(attribs map[string]string) []otlpKeyValue {
+
+	keys := make([]string, 0, len(attribs))
+	for key := range attribs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	keyValues := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		keyValues = append(keyValues, otlpKeyValue{
+			Key:   key,
+			Value: otlpAnyValue{StringValue: attribs[key]},
+		})
+	}
+	return keyValues
+}
+
+func derefAttribs(attribs *map[string]string) map[string]string {
+	if attribs == nil {
+		return nil
+	}
+	return *attribs
+}
+
+func msToUnixNano(ms int64) uint64 {
+	if ms <= 0 {
+		return 0
+	}
+	return uint64(ms) * uint64(time.Millisecond)
+}
@@ -0,0 +1,261 @@
+package monitors
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// OTLP metrics data model which can be marshalled as
+// protobuf or as json per the OTLP/HTTP specification.
+// Field numbers are those of the opentelemetry-proto
+// definitions in opentelemetry/proto/metrics/v1.
+
+const (
+	otlpTemporalityDelta      = 1
+	otlpTemporalityCumulative = 2
+)
+
+type otlpExportMetricsRequest struct {
+	ResourceMetrics []*otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource        `json:"resource"`
+	ScopeMetrics []*otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope     `json:"scope"`
+	Metrics []*otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name string `json:"name"`
+
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []*otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []*otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                    `json:"aggregationTemporality"`
+	IsMonotonic            bool                   `json:"isMonotonic,omitempty"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []*otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                       `json:"aggregationTemporality"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,string,omitempty"`
+	TimeUnixNano      uint64         `json:"timeUnixNano,string"`
+
+	// only one of these is set
+	AsDouble *float64 `json:"asDouble,omitempty"`
+	AsInt    *int64   `json:"asInt,string,omitempty"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,string,omitempty"`
+	TimeUnixNano      uint64         `json:"timeUnixNano,string"`
+
+	Count          uint64      `json:"count,string"`
+	Sum            float64     `json:"sum"`
+	BucketCounts   otlpUint64s `json:"bucketCounts"`
+	ExplicitBounds []float64   `json:"explicitBounds"`
+	Min            float64     `json:"min"`
+	Max            float64     `json:"max"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// 64 bit integers are encoded as strings in OTLP json
+type otlpUint64s []uint64
+
+func (u otlpUint64s) MarshalJSON() ([]byte, error) {
+	values := make([]string, len(u))
+	for i, v := range u {
+		values[i] = strconv.FormatUint(v, 10)
+	}
+	return json.Marshal(values)
+}
+
+// appends a length delimited sub-message
+func appendMessage(b []byte, num protowire.Number, appendFields func(b []byte) []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, appendFields(nil))
+}
+
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if len(value) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendFixed64(b []byte, num protowire.Number, value uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, value)
+}
+
+func appendDouble(b []byte, num protowire.Number, value float64) []byte {
+	return appendFixed64(b, num, math.Float64bits(value))
+}
+
+func appendVarint(b []byte, num protowire.Number, value uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+func (r *otlpExportMetricsRequest) marshalProto() []byte {
+	var b []byte
+	for _, rm := range r.ResourceMetrics {
+		b = appendMessage(b, 1, rm.appendProto)
+	}
+	return b
+}
+
+func (rm *otlpResourceMetrics) appendProto(b []byte) []byte {
+	b = appendMessage(b, 1, rm.Resource.appendProto)
+	for _, sm := range rm.ScopeMetrics {
+		b = appendMessage(b, 2, sm.appendProto)
+	}
+	return b
+}
+
+func (r *otlpResource) appendProto(b []byte) []byte {
+	for _, kv := range r.Attributes {
+		b = appendMessage(b, 1, kv.appendProto)
+	}
+	return b
+}
+
+func (sm *otlpScopeMetrics) appendProto(b []byte) []byte {
+	b = appendMessage(b, 1, sm.Scope.appendProto)
+	for _, m := range sm.Metrics {
+		b = appendMessage(b, 2, m.appendProto)
+	}
+	return b
+}
+
+func (s *otlpScope) appendProto(b []byte) []byte {
+	return appendString(b, 1, s.Name)
+}
+
+func (m *otlpMetric) appendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Name)
+	switch {
+	case m.Gauge != nil:
+		b = appendMessage(b, 5, m.Gauge.appendProto)
+	case m.Sum != nil:
+		b = appendMessage(b, 7, m.Sum.appendProto)
+	case m.Histogram != nil:
+		b = appendMessage(b, 9, m.Histogram.appendProto)
+	}
+	return b
+}
+
+func (g *otlpGauge) appendProto(b []byte) []byte {
+	for _, dp := range g.DataPoints {
+		b = appendMessage(b, 1, dp.appendProto)
+	}
+	return b
+}
+
+func (s *otlpSum) appendProto(b []byte) []byte {
+	for _, dp := range s.DataPoints {
+		b = appendMessage(b, 1, dp.appendProto)
+	}
+	b = appendVarint(b, 2, uint64(s.AggregationTemporality))
+	if s.IsMonotonic {
+		b = appendVarint(b, 3, 1)
+	}
+	return b
+}
+
+func (h *otlpHistogram) appendProto(b []byte) []byte {
+	for _, dp := range h.DataPoints {
+		b = appendMessage(b, 1, dp.appendProto)
+	}
+	return appendVarint(b, 2, uint64(h.AggregationTemporality))
+}
+
+func (dp *otlpNumberDataPoint) appendProto(b []byte) []byte {
+	if dp.StartTimeUnixNano > 0 {
+		b = appendFixed64(b, 2, dp.StartTimeUnixNano)
+	}
+	b = appendFixed64(b, 3, dp.TimeUnixNano)
+	if dp.AsDouble != nil {
+		b = appendDouble(b, 4, *dp.AsDouble)
+	}
+	if dp.AsInt != nil {
+		b = appendFixed64(b, 6, uint64(*dp.AsInt))
+	}
+	for _, kv := range dp.Attributes {
+		b = appendMessage(b, 7, kv.appendProto)
+	}
+	return b
+}
+
+func (dp *otlpHistogramDataPoint) appendProto(b []byte) []byte {
+	if dp.StartTimeUnixNano > 0 {
+		b = appendFixed64(b, 2, dp.StartTimeUnixNano)
+	}
+	b = appendFixed64(b, 3, dp.TimeUnixNano)
+	b = appendFixed64(b, 4, dp.Count)
+	b = appendDouble(b, 5, dp.Sum)
+
+	// packed repeated fields
+	b = appendMessage(b, 6, func(b []byte) []byte {
+		for _, c := range dp.BucketCounts {
+			b = protowire.AppendFixed64(b, c)
+		}
+		return b
+	})
+	b = appendMessage(b, 7, func(b []byte) []byte {
+		for _, bound := range dp.ExplicitBounds {
+			b = protowire.AppendFixed64(b, math.Float64bits(bound))
+		}
+		return b
+	})
+	for _, kv := range dp.Attributes {
+		b = appendMessage(b, 9, kv.appendProto)
+	}
+	b = appendDouble(b, 11, dp.Min)
+	return appendDouble(b, 12, dp.Max)
+}
+
+func (kv *otlpKeyValue) appendProto(b []byte) []byte {
+	b = appendString(b, 1, kv.Key)
+	return appendMessage(b, 2, func(b []byte) []byte {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		return protowire.AppendString(b, kv.Value.StringValue)
+	})
+}
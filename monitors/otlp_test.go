@@ -0,0 +1,255 @@
+package monitors_test
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	"github.com/appbricks/mycloudspace-common/monitors"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/mevansam/goutils/utils"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OTLP Exporter", func() {
+
+	var (
+		receiver *httptest.Server
+
+		requests     [][]byte
+		contentTypes []string
+		status       int
+
+		msvc *monitors.MonitorService
+
+		sent, active *monitors.Counter
+		peers        *monitors.Gauge
+		latency      *monitors.Histogram
+	)
+
+	BeforeEach(func() {
+		requests = [][]byte{}
+		contentTypes = []string{}
+		status = http.StatusOK
+
+		// local OTLP/HTTP receiver stub
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			Expect(r.URL.Path).To(Equal("/v1/metrics"))
+			body, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			requests = append(requests, body)
+			contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+
+			if status != http.StatusOK {
+				http.Error(w, "rejected", status)
+				return
+			}
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+			w.WriteHeader(http.StatusOK)
+		}))
+	})
+
+	AfterEach(func() {
+		receiver.Close()
+	})
+
+	newMonitorService := func(sender monitors.Sender) {
+		msvc = monitors.NewMonitorService(sender, 1, 100)
+
+		monitor := msvc.NewMonitor("space-vpn")
+		sent = monitors.NewCounterWithAttribs("sent", true, true, map[string]string{"peer": "node-1"})
+		monitor.AddCounter(sent)
+		active = monitors.NewCounter("sessions", false, true)
+		monitor.AddCounter(active)
+		peers = monitors.NewGauge("peers")
+		monitor.AddGauge(peers)
+		latency = monitors.NewHistogram("latency", []float64{10, 100})
+		monitor.AddHistogram(latency)
+
+		sent.Set(100)
+		active.Inc()
+		peers.Set(2)
+		latency.Observe(5)
+		latency.Observe(500)
+	}
+
+	It("exports monitor snapshots as OTLP/HTTP json", func() {
+
+		exporter := monitors.NewOTLPExporter(receiver.URL+"/v1/metrics", monitors.OTLPJSON).
+			WithResourceAttributes(map[string]string{"service.instance.id": "device-1"})
+		newMonitorService(exporter)
+		msvc.Stop()
+
+		Expect(len(requests)).To(Equal(1))
+		Expect(contentTypes[0]).To(Equal("application/json"))
+
+		data := make(map[string]interface{})
+		err := json.Unmarshal(requests[0], &data)
+		Expect(err).NotTo(HaveOccurred())
+
+		rm := "resourceMetrics/0"
+		Expect(utils.MustGetValueAtPath(rm+"/resource/attributes/0/key", data)).To(Equal("service.instance.id"))
+		Expect(utils.MustGetValueAtPath(rm+"/resource/attributes/0/value/stringValue", data)).To(Equal("device-1"))
+		Expect(utils.MustGetValueAtPath(rm+"/resource/attributes/1/key", data)).To(Equal("service.name"))
+		Expect(utils.MustGetValueAtPath(rm+"/scopeMetrics/0/scope/name", data)).To(Equal("space-vpn"))
+
+		metrics := rm + "/scopeMetrics/0/metrics"
+		Expect(len(utils.MustGetValueAtPath(metrics, data).([]interface{}))).To(Equal(4))
+
+		// cumalative counters are exported as deltas
+		Expect(utils.MustGetValueAtPath(metrics+"/0/name", data)).To(Equal("sent"))
+		Expect(utils.MustGetValueAtPath(metrics+"/0/sum/aggregationTemporality", data)).To(Equal(float64(1)))
+		Expect(utils.MustGetValueAtPath(metrics+"/0/sum/isMonotonic", data)).To(BeTrue())
+		Expect(utils.MustGetValueAtPath(metrics+"/0/sum/dataPoints/0/asInt", data)).To(Equal("100"))
+		Expect(utils.MustGetValueAtPath(metrics+"/0/sum/dataPoints/0/attributes/0/key", data)).To(Equal("peer"))
+		Expect(utils.MustGetValueAtPath(metrics+"/0/sum/dataPoints/0/startTimeUnixNano", data)).NotTo(BeNil())
+
+		Expect(utils.MustGetValueAtPath(metrics+"/1/name", data)).To(Equal("sessions"))
+		Expect(utils.MustGetValueAtPath(metrics+"/1/sum/aggregationTemporality", data)).To(Equal(float64(2)))
+		Expect(utils.MustGetValueAtPath(metrics+"/1/sum/dataPoints/0/asInt", data)).To(Equal("1"))
+
+		Expect(utils.MustGetValueAtPath(metrics+"/2/name", data)).To(Equal("peers"))
+		Expect(utils.MustGetValueAtPath(metrics+"/2/gauge/dataPoints/0/asDouble", data)).To(Equal(float64(2)))
+
+		Expect(utils.MustGetValueAtPath(metrics+"/3/name", data)).To(Equal("latency"))
+		Expect(utils.MustGetValueAtPath(metrics+"/3/histogram/aggregationTemporality", data)).To(Equal(float64(1)))
+		Expect(utils.MustGetValueAtPath(metrics+"/3/histogram/dataPoints/0/count", data)).To(Equal("2"))
+		Expect(utils.MustGetValueAtPath(metrics+"/3/histogram/dataPoints/0/bucketCounts", data)).To(Equal([]interface{}{"1", "0", "1"}))
+		Expect(utils.MustGetValueAtPath(metrics+"/3/histogram/dataPoints/0/explicitBounds", data)).To(Equal([]interface{}{float64(10), float64(100)}))
+	})
+
+	It("exports monitor snapshots as OTLP/HTTP protobuf", func() {
+
+		exporter := monitors.NewOTLPExporter(receiver.URL+"/v1/metrics", monitors.OTLPProtobuf)
+		newMonitorService(exporter)
+		msvc.Stop()
+
+		Expect(len(requests)).To(Equal(1))
+		Expect(contentTypes[0]).To(Equal("application/x-protobuf"))
+
+		request := decodeProto(requests[0])
+		resourceMetrics := decodeProto(request[1][0].([]byte))
+		resource := decodeProto(resourceMetrics[1][0].([]byte))
+		attribute := decodeProto(resource[1][0].([]byte))
+		Expect(string(attribute[1][0].([]byte))).To(Equal("service.name"))
+
+		scopeMetrics := decodeProto(resourceMetrics[2][0].([]byte))
+		scope := decodeProto(scopeMetrics[1][0].([]byte))
+		Expect(string(scope[1][0].([]byte))).To(Equal("space-vpn"))
+		Expect(len(scopeMetrics[2])).To(Equal(4))
+
+		// delta sum of cumalative counter
+		metric := decodeProto(scopeMetrics[2][0].([]byte))
+		Expect(string(metric[1][0].([]byte))).To(Equal("sent"))
+		sum := decodeProto(metric[7][0].([]byte))
+		Expect(sum[2][0]).To(Equal(uint64(1)))
+		Expect(sum[3][0]).To(Equal(uint64(1)))
+		dataPoint := decodeProto(sum[1][0].([]byte))
+		Expect(dataPoint[6][0]).To(Equal(uint64(100)))
+		Expect(dataPoint[2][0].(uint64)).To(BeNumerically("<=", dataPoint[3][0].(uint64)))
+
+		// gauge
+		metric = decodeProto(scopeMetrics[2][2].([]byte))
+		gauge := decodeProto(metric[5][0].([]byte))
+		dataPoint = decodeProto(gauge[1][0].([]byte))
+		Expect(math.Float64frombits(dataPoint[4][0].(uint64))).To(Equal(float64(2)))
+
+		// histogram
+		metric = decodeProto(scopeMetrics[2][3].([]byte))
+		histogram := decodeProto(metric[9][0].([]byte))
+		dataPoint = decodeProto(histogram[1][0].([]byte))
+		Expect(dataPoint[4][0]).To(Equal(uint64(2)))
+		Expect(math.Float64frombits(dataPoint[5][0].(uint64))).To(Equal(float64(505)))
+		Expect(len(dataPoint[6][0].([]byte))).To(Equal(3 * 8))
+	})
+
+	It("flags events as bad requests or fails the post depending on the receiver's response", func() {
+
+		rs := &recordingSender{}
+		newMonitorService(rs)
+		msvc.Stop()
+		Expect(len(rs.events)).To(Equal(1))
+
+		lifecycleEvent, err := events.NewLifecycleEvent(events.VPNConnectedEventType, "VPN Session Connected", &events.VPNSessionData{})
+		Expect(err).NotTo(HaveOccurred())
+		exporter := monitors.NewOTLPExporter(receiver.URL+"/v1/metrics", monitors.OTLPJSON)
+
+		// non-metric events are not exported
+		errors, err := exporter.PostMeasurementEvents([]*cloudevents.Event{lifecycleEvent})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(errors)).To(Equal(0))
+		Expect(len(requests)).To(Equal(0))
+
+		status = http.StatusBadRequest
+		errors, err = exporter.PostMeasurementEvents([]*cloudevents.Event{rs.events[0], lifecycleEvent})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(errors)).To(Equal(1))
+		Expect(errors[0].Event).To(Equal(rs.events[0]))
+		Expect(events.DefaultErrorClassifier(errors[0].Err())).To(BeFalse())
+
+		status = http.StatusServiceUnavailable
+		_, err = exporter.PostMeasurementEvents(rs.events)
+		Expect(err).To(HaveOccurred())
+		Expect(len(requests)).To(Equal(2))
+	})
+
+	It("exports new snapshot events published to an event bus", func() {
+
+		bus := events.NewBus(0)
+		defer bus.Close()
+
+		exporter := monitors.NewOTLPExporter(receiver.URL+"/v1/metrics", monitors.OTLPProtobuf)
+		sub := exporter.ExportFrom(bus, 10)
+
+		newMonitorService(&failingSender{})
+		msvc.SetEventBus(bus)
+		msvc.Stop()
+		sub.Cancel()
+
+		// events are exported once even though
+		// they failed to post via the sender
+		Expect(len(requests)).To(Equal(1))
+	})
+})
+
+// decodes a protobuf message into a map of field
+// numbers to values which are either uint64 for
+// varint and fixed64 fields or []byte for length
+// delimited fields
+func decodeProto(b []byte) map[protowire.Number][]interface{} {
+	fields := make(map[protowire.Number][]interface{})
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		Expect(n).To(BeNumerically(">", 0))
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			Expect(n).To(BeNumerically(">", 0))
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			Expect(n).To(BeNumerically(">", 0))
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			Expect(n).To(BeNumerically(">", 0))
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		default:
+			Fail("unexpected wire type")
+		}
+	}
+	return fields
+}
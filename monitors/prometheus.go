@@ -0,0 +1,202 @@
+package monitors
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+const prometheusContentType = `text/plain; version=0.0.4; charset=utf-8`
+
+var invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+var invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// PrometheusHandler serves the current values of all
+// metrics of a monitor service in the prometheus text
+// exposition format. Metrics are read without
+// affecting the snapshots posted by the service.
+type PrometheusHandler struct {
+	monitorService *MonitorService
+	namespace      string
+}
+
+// a metric family groups all metrics with the same
+// name that differ only by their labels
+type metricFamily struct {
+	name       string
+	metricType string
+	help       string
+
+	samples []string
+}
+
+// Returns a handler that exposes the metrics of all
+// monitors of the given service. Metrics are named
+// '<namespace>_<monitor>_<metric>' with attributes
+// as labels.
+func NewPrometheusHandler(monitorService *MonitorService, namespace string) *PrometheusHandler {
+	return &PrometheusHandler{
+		monitorService: monitorService,
+		namespace:      namespace,
+	}
+}
+
+func (h *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		err error
+	)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := h.export()
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err = w.Write(body); err != nil {
+		logger.DebugMessage(
+			"PrometheusHandler.ServeHTTP(): Failed to write metrics response: %s",
+			err.Error(),
+		)
+	}
+}
+
+func (h *PrometheusHandler) export() []byte {
+
+	ms := h.monitorService
+	ms.lock.Lock()
+
+	families := make(map[string]*metricFamily)
+	family := func(name, metricType, help string) *metricFamily {
+		f, exists := families[name]
+		if !exists {
+			f = &metricFamily{
+				name:       name,
+				metricType: metricType,
+				help:       help,
+			}
+			families[name] = f
+		}
+		return f
+	}
+
+	for _, m := range ms.monitors {
+		m.lock.Lock()
+		for _, c := range m.counters {
+			name := h.metricName(m.name, c.name)
+			labels := prometheusLabels(c.attribs, "", "")
+			if c.cumalative {
+				f := family(name+"_total", "counter", fmt.Sprintf("Counter %s of monitor %s.", c.name, m.name))
+				f.samples = append(f.samples, prometheusSample(f.name, labels, float64(c.Get())))
+			} else {
+				f := family(name, "gauge", fmt.Sprintf("Counter %s of monitor %s.", c.name, m.name))
+				f.samples = append(f.samples, prometheusSample(f.name, labels, float64(c.Get())))
+			}
+		}
+		for _, g := range m.gauges {
+			name := h.metricName(m.name, g.name)
+			f := family(name, "gauge", fmt.Sprintf("Gauge %s of monitor %s.", g.name, m.name))
+			f.samples = append(f.samples, prometheusSample(f.name, prometheusLabels(g.attribs, "", ""), g.Get()))
+		}
+		for _, hg := range m.histograms {
+			name := h.metricName(m.name, hg.name)
+			f := family(name, "histogram", fmt.Sprintf("Histogram %s of monitor %s.", hg.name, m.name))
+
+			bounds, counts, count, sum := hg.totals()
+			cumulativeCount := uint64(0)
+			for i, bound := range bounds {
+				cumulativeCount += counts[i]
+				f.samples = append(f.samples, prometheusSample(
+					name+"_bucket",
+					prometheusLabels(hg.attribs, "le", strconv.FormatFloat(bound, 'g', -1, 64)),
+					float64(cumulativeCount),
+				))
+			}
+			f.samples = append(f.samples,
+				prometheusSample(name+"_bucket", prometheusLabels(hg.attribs, "le", "+Inf"), float64(count)),
+				prometheusSample(name+"_sum", prometheusLabels(hg.attribs, "", ""), sum),
+				prometheusSample(name+"_count", prometheusLabels(hg.attribs, "", ""), float64(count)),
+			)
+		}
+		for _, d := range m.derived {
+			name := h.metricName(m.name, d.name)
+			f := family(name, "gauge", fmt.Sprintf("Derived %s of %s of monitor %s.", d.function, d.source.Name(), m.name))
+			f.samples = append(f.samples, prometheusSample(f.name, prometheusLabels(d.attribs, "", ""), d.Get()))
+		}
+		m.lock.Unlock()
+	}
+	ms.lock.Unlock()
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out bytes.Buffer
+	for _, name := range names {
+		f := families[name]
+		out.WriteString(fmt.Sprintf("# HELP %s %s\n", f.name, f.help))
+		out.WriteString(fmt.Sprintf("# TYPE %s %s\n", f.name, f.metricType))
+		for _, sample := range f.samples {
+			out.WriteString(sample)
+		}
+	}
+	return out.Bytes()
+}
+
+func (h *PrometheusHandler) metricName(monitorName, name string) string {
+	metricName := invalidMetricNameChars.ReplaceAllString(monitorName+"_"+name, "_")
+	if len(h.namespace) > 0 {
+		metricName = invalidMetricNameChars.ReplaceAllString(h.namespace, "_") + "_" + metricName
+	}
+	if metricName[0] >= '0' && metricName[0] <= '9' {
+		metricName = "_" + metricName
+	}
+	return metricName
+}
+
+// returns the prometheus label set for the given
+// attributes sorted by name with an optional
+// additional label such as a histogram's 'le'
+func prometheusLabels(attribs map[string]string, extraName, extraValue string) string {
+
+	labels := make([]string, 0, len(attribs)+1)
+	for name, value := range attribs {
+		labelName := invalidLabelNameChars.ReplaceAllString(name, "_")
+		if len(labelName) == 0 || (labelName[0] >= '0' && labelName[0] <= '9') {
+			labelName = "_" + labelName
+		}
+		labels = append(labels, labelName+`="`+escapeLabelValue(value)+`"`)
+	}
+	sort.Strings(labels)
+	if len(extraName) > 0 {
+		labels = append(labels, extraName+`="`+escapeLabelValue(extraValue)+`"`)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+func prometheusSample(name, labels string, value float64) string {
+	return name + labels + " " + strconv.FormatFloat(value, 'g', -1, 64) + "\n"
+}
@@ -0,0 +1,123 @@
+package monitors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/appbricks/mycloudspace-common/monitors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prometheus Handler", func() {
+
+	It("exposes all monitor metrics in the prometheus text format", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		monitor := msvc.NewMonitor("space-vpn")
+		sent := monitors.NewCounterWithAttribs("sent", true, true, map[string]string{"peer": "node-1"})
+		monitor.AddCounter(sent)
+		recd := monitors.NewCounterWithAttribs("sent", true, true, map[string]string{"peer": `node "2"`})
+		monitor.AddCounter(recd)
+		peers := monitors.NewGauge("active-peers")
+		monitor.AddGauge(peers)
+		latency := monitors.NewHistogram("latency", []float64{10, 100})
+		monitor.AddHistogram(latency)
+
+		sent.Set(100)
+		recd.Set(50)
+		peers.Set(2)
+		latency.Observe(5)
+		latency.Observe(50)
+		latency.Observe(500)
+
+		handler := monitors.NewPrometheusHandler(msvc, "mycs")
+		scrape := func() string {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+			return recorder.Body.String()
+		}
+
+		Expect(scrape()).To(Equal(`# HELP mycs_space_vpn_active_peers Gauge active-peers of monitor space-vpn.
+# TYPE mycs_space_vpn_active_peers gauge
+mycs_space_vpn_active_peers 2
+# HELP mycs_space_vpn_latency Histogram latency of monitor space-vpn.
+# TYPE mycs_space_vpn_latency histogram
+mycs_space_vpn_latency_bucket{le="10"} 1
+mycs_space_vpn_latency_bucket{le="100"} 2
+mycs_space_vpn_latency_bucket{le="+Inf"} 3
+mycs_space_vpn_latency_sum 555
+mycs_space_vpn_latency_count 3
+# HELP mycs_space_vpn_sent_total Counter sent of monitor space-vpn.
+# TYPE mycs_space_vpn_sent_total counter
+mycs_space_vpn_sent_total{peer="node-1"} 100
+mycs_space_vpn_sent_total{peer="node \"2\""} 50
+`))
+
+		// values are cumulative across snapshots
+		msvc.Stop()
+		Expect(len(rs.events)).To(Equal(1))
+		sent.Set(150)
+		latency.Observe(1)
+		output := scrape()
+		Expect(output).To(ContainSubstring(`mycs_space_vpn_sent_total{peer="node-1"} 150`))
+		Expect(output).To(ContainSubstring(`mycs_space_vpn_latency_count 4`))
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("exposes cumulative histogram buckets with the sum and count of all observations", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		latency := monitors.NewHistogramWithAttribs("latency", []float64{1, 2.5, 10}, map[string]string{"peer": "node-1"})
+		msvc.NewMonitor("space-vpn").AddHistogram(latency)
+
+		handler := monitors.NewPrometheusHandler(msvc, "")
+		scrape := func() string {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			return recorder.Body.String()
+		}
+
+		// values equal to a bound are counted
+		// in that bound's bucket
+		for _, v := range []float64{0.5, 1, 2.5, 3} {
+			latency.Observe(v)
+		}
+		Expect(scrape()).To(Equal(`# HELP space_vpn_latency Histogram latency of monitor space-vpn.
+# TYPE space_vpn_latency histogram
+space_vpn_latency_bucket{peer="node-1",le="1"} 2
+space_vpn_latency_bucket{peer="node-1",le="2.5"} 3
+space_vpn_latency_bucket{peer="node-1",le="10"} 4
+space_vpn_latency_bucket{peer="node-1",le="+Inf"} 4
+space_vpn_latency_sum{peer="node-1"} 7
+space_vpn_latency_count{peer="node-1"} 4
+`))
+
+		// buckets, sum and count are not reset
+		// when a snapshot is collected
+		msvc.Stop()
+		Expect(latency.Count()).To(Equal(uint64(0)))
+		latency.Observe(2)
+		latency.Observe(20)
+		Expect(scrape()).To(Equal(`# HELP space_vpn_latency Histogram latency of monitor space-vpn.
+# TYPE space_vpn_latency histogram
+space_vpn_latency_bucket{peer="node-1",le="1"} 2
+space_vpn_latency_bucket{peer="node-1",le="2.5"} 4
+space_vpn_latency_bucket{peer="node-1",le="10"} 5
+space_vpn_latency_bucket{peer="node-1",le="+Inf"} 6
+space_vpn_latency_sum{peer="node-1"} 29
+space_vpn_latency_count{peer="node-1"} 6
+`))
+	})
+})
@@ -0,0 +1,257 @@
+package monitors
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"time"
+
+	"github.com/mevansam/goutils/logger"
+)
+
+// name of the monitor created by NewResourceMonitor
+const ResourceMonitorName = "resources"
+
+// buckets for gc pauses in milliseconds
+var gcPauseBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 50, 100}
+
+// runtime metrics of the gc which unlike the
+// stats returned by runtime.ReadMemStats can
+// be read without stopping the world
+const (
+	gcCyclesMetric = "/gc/cycles/total:gc-cycles"
+	gcPausesMetric = "/sched/pauses/total/gc:seconds"
+	// deprecated name of the gc pauses metric which
+	// is read on go releases prior to 1.22 as they
+	// do not support the current name
+	gcPausesLegacyMetric = "/gc/pauses:seconds"
+)
+
+// returned by the platform specific readers
+// of resources not available on the platform
+var errResourceUnsupported = errors.New("resource metric not supported on this platform")
+
+// ResourceMonitor records the resources used by the
+// process and the load of the host it runs on. The
+// metrics are refreshed each time the monitor is
+// collected. Metrics that are not available on the
+// platform are not added to the monitor.
+type ResourceMonitor struct {
+	monitor *Monitor
+
+	// cumalative cpu time in milliseconds
+	cpuTime *Counter
+	// resident set size in bytes
+	rss *Gauge
+	// largest resident set size of the process
+	// in bytes since it started which unlike
+	// 'rss' is available on darwin
+	peakRSS    *Gauge
+	goroutines *Gauge
+	openFiles  *Gauge
+
+	gcCount *Counter
+	// gc pauses in milliseconds
+	gcPause *Histogram
+	// samples of the gc runtime metrics and the
+	// counts of the runtime's gc pause histogram
+	// at the previous refresh whose pauses were
+	// observed
+	gcSamples     []metrics.Sample
+	gcPauseCounts []uint64
+
+	// host load averages over
+	// 1, 5 and 15 minutes
+	load1,
+	load5,
+	load15 *Gauge
+}
+
+// Creates a monitor named ResourceMonitorName with
+// the given monitor service that records the process'
+// cpu time, current and peak resident memory,
+// goroutines, open files and gc pauses as well as
+// the host load. The current resident memory is not
+// available on darwin and the host load is not
+// available on windows.
+func NewResourceMonitor(ms *MonitorService) *ResourceMonitor {
+
+	r := &ResourceMonitor{
+		monitor: ms.NewMonitor(ResourceMonitorName),
+
+		goroutines: NewGauge("goroutines"),
+
+		gcCount: NewCounter("gcCount", true, false),
+		gcPause: NewHistogram("gcPause", gcPauseBuckets),
+
+		gcSamples: []metrics.Sample{
+			{Name: gcCyclesMetric},
+			{Name: gcPausesMetric},
+		},
+	}
+	if !runtimeMetricSupported(gcPausesMetric) {
+		r.gcSamples[1].Name = gcPausesLegacyMetric
+	}
+
+	// metrics whose readers are not supported on the
+	// platform are left nil and not added so they are
+	// not reported as zero
+	if _, err := processCPUTime(); resourceSupported(err) {
+		r.cpuTime = NewCounter("cpuTime", true, false)
+		r.monitor.AddCounter(r.cpuTime)
+	}
+	if _, err := processRSS(); resourceSupported(err) {
+		r.rss = NewGauge("rss")
+		r.monitor.AddGauge(r.rss)
+	}
+	if _, err := processPeakRSS(); resourceSupported(err) {
+		r.peakRSS = NewGauge("peakRSS")
+		r.monitor.AddGauge(r.peakRSS)
+	}
+	r.monitor.AddGauge(r.goroutines)
+	if _, err := openFileCount(); resourceSupported(err) {
+		r.openFiles = NewGauge("openFiles")
+		r.monitor.AddGauge(r.openFiles)
+	}
+	r.monitor.AddCounter(r.gcCount)
+	r.monitor.AddHistogram(r.gcPause)
+	if _, err := hostLoadAverage(); resourceSupported(err) {
+		r.load1 = NewGauge("load1")
+		r.load5 = NewGauge("load5")
+		r.load15 = NewGauge("load15")
+		r.monitor.AddGauge(r.load1)
+		r.monitor.AddGauge(r.load5)
+		r.monitor.AddGauge(r.load15)
+	}
+
+	// pauses of gc cycles prior to the
+	// monitor's creation are not observed
+	metrics.Read(r.gcSamples)
+	if pauses := r.gcSamples[1].Value; pauses.Kind() == metrics.KindFloat64Histogram {
+		r.gcPauseCounts = append(r.gcPauseCounts, pauses.Float64Histogram().Counts...)
+	}
+
+	r.monitor.OnCollect(r.refresh)
+	return r
+}
+
+// Returns the monitor the resource metrics are
+// added to so additional metrics such as derived
+// metrics can be added to it.
+func (r *ResourceMonitor) Monitor() *Monitor {
+	return r.monitor
+}
+
+// reads the current resource usage
+func (r *ResourceMonitor) refresh() {
+
+	var (
+		err error
+
+		cpuTime time.Duration
+		rss,
+		peakRSS uint64
+
+		openFiles int
+		load      [3]float64
+	)
+
+	if r.cpuTime != nil {
+		if cpuTime, err = processCPUTime(); err == nil {
+			r.cpuTime.Set(cpuTime.Milliseconds())
+		} else {
+			logResourceError("cpu time", err)
+		}
+	}
+	if r.rss != nil {
+		if rss, err = processRSS(); err == nil {
+			r.rss.Set(float64(rss))
+		} else {
+			logResourceError("resident set size", err)
+		}
+	}
+	if r.peakRSS != nil {
+		if peakRSS, err = processPeakRSS(); err == nil {
+			r.peakRSS.Set(float64(peakRSS))
+		} else {
+			logResourceError("peak resident set size", err)
+		}
+	}
+	if r.openFiles != nil {
+		if openFiles, err = openFileCount(); err == nil {
+			r.openFiles.Set(float64(openFiles))
+		} else {
+			logResourceError("open files", err)
+		}
+	}
+	if r.load1 != nil {
+		if load, err = hostLoadAverage(); err == nil {
+			r.load1.Set(load[0])
+			r.load5.Set(load[1])
+			r.load15.Set(load[2])
+		} else {
+			logResourceError("host load", err)
+		}
+	}
+	r.goroutines.Set(float64(runtime.NumGoroutine()))
+
+	metrics.Read(r.gcSamples)
+	if cycles := r.gcSamples[0].Value; cycles.Kind() == metrics.KindUint64 {
+		r.gcCount.Set(int64(cycles.Uint64()))
+	}
+	if pauses := r.gcSamples[1].Value; pauses.Kind() == metrics.KindFloat64Histogram {
+		r.observeGCPauses(pauses.Float64Histogram())
+	}
+}
+
+// observes the pauses added to each bucket of the
+// runtime's gc pause histogram since the previous
+// refresh. the runtime's buckets are much finer than
+// the monitor's so each pause is observed at the
+// upper bound of its bucket.
+func (r *ResourceMonitor) observeGCPauses(pauses *metrics.Float64Histogram) {
+	for i, count := range pauses.Counts {
+		observed := uint64(0)
+		if i < len(r.gcPauseCounts) {
+			observed = r.gcPauseCounts[i]
+		}
+		if count <= observed {
+			continue
+		}
+		pause := pauses.Buckets[i+1]
+		if math.IsInf(pause, 1) {
+			pause = pauses.Buckets[i]
+		}
+		for ; observed < count; observed++ {
+			r.gcPause.Observe(pause * 1000)
+		}
+	}
+	// the histogram's counts may be reused
+	// by the next read so they are copied
+	r.gcPauseCounts = append(r.gcPauseCounts[:0], pauses.Counts...)
+}
+
+func logResourceError(resource string, err error) {
+	logger.DebugMessage(
+		"ResourceMonitor.refresh(): Unable to read %s: %s",
+		resource, err.Error(),
+	)
+}
+
+// returns whether the platform's reader of a
+// resource returned other than errResourceUnsupported
+func resourceSupported(err error) bool {
+	return err != errResourceUnsupported
+}
+
+// returns whether the go runtime supports
+// the runtime metric with the given name
+func runtimeMetricSupported(name string) bool {
+	for _, d := range metrics.All() {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package monitors
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// directory with an entry for each
+// file descriptor of the process
+const processFDDir = "/dev/fd"
+
+// bytes per unit of the max rss
+// reported by getrusage
+const maxRSSUnit = 1
+
+// the current resident set size is only
+// available via the mach task_info and
+// proc_pidinfo apis which are not exposed
+// by x/sys/unix and require cgo so the rss
+// metric is not added on darwin.
+func processRSS() (uint64, error) {
+	return 0, errResourceUnsupported
+}
+
+func hostLoadAverage() ([3]float64, error) {
+
+	var (
+		err error
+
+		data []byte
+		load [3]float64
+	)
+
+	// struct loadavg {
+	//   fixpt_t ldavg[3];  // uint32
+	//   long    fscale;    // int64 aligned at offset 16
+	// }
+	if data, err = unix.SysctlRaw("vm.loadavg"); err != nil {
+		return load, err
+	}
+	if len(data) < 24 {
+		return load, fmt.Errorf("unexpected size of vm.loadavg: %d", len(data))
+	}
+	scale := float64(binary.LittleEndian.Uint64(data[16:24]))
+	if scale == 0 {
+		return load, fmt.Errorf("vm.loadavg has a zero scale")
+	}
+	for i := range load {
+		load[i] = float64(binary.LittleEndian.Uint32(data[i*4:])) / scale
+	}
+	return load, nil
+}
@@ -0,0 +1,64 @@
+package monitors
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// directory with an entry for each
+// file descriptor of the process
+const processFDDir = "/proc/self/fd"
+
+// bytes per unit of the max rss
+// reported by getrusage
+const maxRSSUnit = 1024
+
+func processRSS() (uint64, error) {
+
+	var (
+		err error
+
+		data  []byte
+		pages uint64
+	)
+
+	// the second field of statm is the
+	// number of resident pages
+	if data, err = os.ReadFile("/proc/self/statm"); err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected format of /proc/self/statm: %s", string(data))
+	}
+	if pages, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
+
+func hostLoadAverage() ([3]float64, error) {
+
+	var (
+		err error
+
+		data []byte
+		load [3]float64
+	)
+
+	if data, err = os.ReadFile("/proc/loadavg"); err != nil {
+		return load, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("unexpected format of /proc/loadavg: %s", string(data))
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, err
+		}
+	}
+	return load, nil
+}
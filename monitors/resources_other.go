@@ -0,0 +1,32 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package monitors
+
+import (
+	"time"
+)
+
+// process and host resources are not read on
+// other platforms. only the go runtime's
+// resources are recorded.
+
+func processCPUTime() (time.Duration, error) {
+	return 0, errResourceUnsupported
+}
+
+func processRSS() (uint64, error) {
+	return 0, errResourceUnsupported
+}
+
+func processPeakRSS() (uint64, error) {
+	return 0, errResourceUnsupported
+}
+
+func openFileCount() (int, error) {
+	return 0, errResourceUnsupported
+}
+
+func hostLoadAverage() ([3]float64, error) {
+	return [3]float64{}, errResourceUnsupported
+}
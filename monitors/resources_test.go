@@ -0,0 +1,90 @@
+package monitors_test
+
+import (
+	"encoding/json"
+	"runtime"
+
+	"github.com/appbricks/mycloudspace-common/monitors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resource Monitor", func() {
+
+	var (
+		err error
+	)
+
+	It("records the resources used by the process and the host load", func() {
+
+		rs := &recordingSender{}
+		msvc := monitors.NewMonitorService(rs, 1, 100)
+
+		resourceMonitor := monitors.NewResourceMonitor(msvc)
+		Expect(resourceMonitor.Monitor()).NotTo(BeNil())
+
+		runtime.GC()
+		runtime.GC()
+		msvc.Stop()
+
+		Expect(len(rs.events)).To(Equal(1))
+		data := struct {
+			Monitors []struct {
+				Name     string `json:"name"`
+				Counters []struct {
+					Name  string `json:"name"`
+					Value int64  `json:"value"`
+				} `json:"counters"`
+				Gauges []struct {
+					Name  string  `json:"name"`
+					Value float64 `json:"value"`
+				} `json:"gauges"`
+				Histograms []struct {
+					Name  string `json:"name"`
+					Count uint64 `json:"count"`
+				} `json:"histograms"`
+			} `json:"monitors"`
+		}{}
+		err = json.Unmarshal(rs.events[0].Data(), &data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(data.Monitors)).To(Equal(1))
+		Expect(data.Monitors[0].Name).To(Equal(monitors.ResourceMonitorName))
+
+		counters := make(map[string]int64)
+		for _, c := range data.Monitors[0].Counters {
+			counters[c.Name] = c.Value
+		}
+		Expect(counters["cpuTime"]).To(BeNumerically(">", 0))
+		Expect(counters["gcCount"]).To(BeNumerically(">=", 2))
+
+		gauges := make(map[string]float64)
+		for _, g := range data.Monitors[0].Gauges {
+			gauges[g.Name] = g.Value
+		}
+		Expect(gauges["goroutines"]).To(BeNumerically(">", 0))
+		if runtime.GOOS != "darwin" {
+			Expect(gauges["rss"]).To(BeNumerically(">", 0))
+		} else {
+			// metrics not available on the
+			// platform are not reported
+			Expect(gauges).NotTo(HaveKey("rss"))
+		}
+		Expect(gauges["peakRSS"]).To(BeNumerically(">", 0))
+		Expect(gauges["peakRSS"]).To(BeNumerically(">=", gauges["rss"]))
+		Expect(gauges["openFiles"]).To(BeNumerically(">", 0))
+		if runtime.GOOS != "windows" {
+			Expect(gauges).To(HaveKey("load1"))
+			Expect(gauges).To(HaveKey("load5"))
+			Expect(gauges).To(HaveKey("load15"))
+		} else {
+			Expect(gauges).NotTo(HaveKey("load1"))
+		}
+
+		// only the gc cycles since the monitor
+		// was created are observed
+		Expect(len(data.Monitors[0].Histograms)).To(Equal(1))
+		Expect(data.Monitors[0].Histograms[0].Name).To(Equal("gcPause"))
+		Expect(data.Monitors[0].Histograms[0].Count).To(BeNumerically(">=", 2))
+	})
+})
@@ -0,0 +1,35 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package monitors
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func processCPUTime() (time.Duration, error) {
+	rusage := syscall.Rusage{}
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err != nil {
+		return 0, err
+	}
+	return time.Duration(rusage.Utime.Nano() + rusage.Stime.Nano()), nil
+}
+
+func processPeakRSS() (uint64, error) {
+	rusage := syscall.Rusage{}
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err != nil {
+		return 0, err
+	}
+	return uint64(rusage.Maxrss) * maxRSSUnit, nil
+}
+
+func openFileCount() (int, error) {
+	entries, err := os.ReadDir(processFDDir)
+	if err != nil {
+		return 0, err
+	}
+	// the directory read is itself an open file
+	return len(entries) - 1, nil
+}
@@ -0,0 +1,101 @@
+//go:build windows
+// +build windows
+
+package monitors
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+
+	procK32GetProcessMemoryInfo = kernel32.NewProc("K32GetProcessMemoryInfo")
+	procGetProcessHandleCount   = kernel32.NewProc("GetProcessHandleCount")
+)
+
+// PROCESS_MEMORY_COUNTERS
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+func processCPUTime() (time.Duration, error) {
+
+	var (
+		creationTime, exitTime,
+		kernelTime, userTime windows.Filetime
+	)
+
+	if err := windows.GetProcessTimes(
+		windows.CurrentProcess(),
+		&creationTime, &exitTime, &kernelTime, &userTime,
+	); err != nil {
+		return 0, err
+	}
+	// file times are in 100 nanosecond intervals
+	return time.Duration((filetimeTicks(kernelTime) + filetimeTicks(userTime)) * 100), nil
+}
+
+// the working set size is the
+// resident set size of the process
+func processRSS() (uint64, error) {
+	counters := processMemoryCounters{}
+	counters.cb = uint32(unsafe.Sizeof(counters))
+	if r, _, err := procK32GetProcessMemoryInfo.Call(
+		uintptr(windows.CurrentProcess()),
+		uintptr(unsafe.Pointer(&counters)),
+		uintptr(counters.cb),
+	); r == 0 {
+		return 0, err
+	}
+	return uint64(counters.WorkingSetSize), nil
+}
+
+// the peak working set size is the largest
+// resident set size of the process
+func processPeakRSS() (uint64, error) {
+	counters := processMemoryCounters{}
+	counters.cb = uint32(unsafe.Sizeof(counters))
+	if r, _, err := procK32GetProcessMemoryInfo.Call(
+		uintptr(windows.CurrentProcess()),
+		uintptr(unsafe.Pointer(&counters)),
+		uintptr(counters.cb),
+	); r == 0 {
+		return 0, err
+	}
+	return uint64(counters.PeakWorkingSetSize), nil
+}
+
+// open files are counted as the
+// open handles of the process
+func openFileCount() (int, error) {
+	var count uint32
+	if r, _, err := procGetProcessHandleCount.Call(
+		uintptr(windows.CurrentProcess()),
+		uintptr(unsafe.Pointer(&count)),
+	); r == 0 {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// windows does not maintain a load average
+func hostLoadAverage() ([3]float64, error) {
+	return [3]float64{}, errResourceUnsupported
+}
+
+func filetimeTicks(ft windows.Filetime) int64 {
+	return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+}
@@ -0,0 +1,97 @@
+package monitors
+
+import (
+	"fmt"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+// name of the sender the monitor
+// service was created with
+const DefaultSender = "default"
+
+// senderQueue is the backlog and the retry state of
+// the events posted via a single sender. a sender
+// that fails to post only delays its own backlog.
+type senderQueue struct {
+	name   string
+	sender Sender
+
+	eventPayloads []*eventPayload
+	// non-metric events such as lifecycle
+	// events queued for the next post
+	queuedEvents []*cloudevents.Event
+
+	// durable store of payloads not yet posted
+	outbox *events.Outbox
+	// handles backoff and dead-lettering
+	// of events rejected by the sender
+	retryManager *events.RetryManager
+}
+
+func newSenderQueue(name string, sender Sender, collectCount int) *senderQueue {
+	return &senderQueue{
+		name:   name,
+		sender: sender,
+
+		// payload for each snapshot collected
+		eventPayloads: make([]*eventPayload, 0, collectCount),
+	}
+}
+
+// Adds a sender to which all events collected or
+// queued from now on are posted in addition to the
+// service's other senders. Each sender retains the
+// events it failed to post independently of the
+// other senders.
+func (ms *MonitorService) AddSender(name string, sender Sender) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.senderQueue(name) != nil {
+		return fmt.Errorf("sender '%s' has already been added", name)
+	}
+	ms.senders = append(ms.senders,
+		newSenderQueue(name, sender, ms.collectCount+1))
+	return nil
+}
+
+// Removes the named sender. Any events the
+// sender has yet to post are discarded.
+func (ms *MonitorService) RemoveSender(name string) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	for i, q := range ms.senders {
+		if q.name == name {
+			ms.senders = append(ms.senders[:i], ms.senders[i+1:]...)
+			break
+		}
+	}
+}
+
+// Sets a retry manager that determines when events
+// that were rejected by the named sender are reposted
+// and when they are given up on.
+func (ms *MonitorService) SetSenderRetryManager(name string, retryManager *events.RetryManager) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	q := ms.senderQueue(name)
+	if q == nil {
+		return fmt.Errorf("sender '%s' has not been added", name)
+	}
+	q.retryManager = retryManager
+	return nil
+}
+
+// returns the queue of the named sender
+func (ms *MonitorService) senderQueue(name string) *senderQueue {
+	for _, q := range ms.senders {
+		if q.name == name {
+			return q
+		}
+	}
+	return nil
+}
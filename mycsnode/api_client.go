@@ -40,6 +40,8 @@ type ApiClient struct {
 	restAuthClient  *rest.RestApiClient
 	keyRefreshMutex sync.Mutex
 
+	// background authentication timer which
+	// is guarded by the auth state mutex
 	authExecTimer *utils.ExecTimer
 
 	// x-auth-key header
@@ -54,6 +56,12 @@ type ApiClient struct {
 	// rest api client
 	isAuthenticated bool
 	authTimeout     time.Duration
+
+	// auth state and the subscribers
+	// to its transitions
+	authStatus        AuthStatus
+	authSubscriptions []*AuthSubscription
+	authStateMutex    sync.Mutex
 }
 
 type ErrorResponse struct {
@@ -199,18 +207,23 @@ func (a *ApiClient) IsRunning() bool {
 }
 
 func (a *ApiClient) Start() error {
-	a.authExecTimer = utils.NewExecTimer(a.ctx, a.AuthCallback, false)
-	return a.authExecTimer.Start(0)
+	authExecTimer := utils.NewExecTimer(a.ctx, a.AuthCallback, false)
+	a.authStateMutex.Lock()
+	a.authExecTimer = authExecTimer
+	a.authStateMutex.Unlock()
+
+	return authExecTimer.Start(0)
 }
 
 func (a *ApiClient) Stop() {
-	if a.authExecTimer != nil {
-		if err := a.authExecTimer.Stop(); err != nil {
+	if authExecTimer := a.backgroundAuth(); authExecTimer != nil {
+		if err := authExecTimer.Stop(); err != nil {
 			logger.DebugMessage(
 				"ApiClient.Stop(): Auth execution timer stopped with err: %s", 
 				err.Error())	
 		}
 	}
+	a.setAuthState(AuthStateStopped, nil)
 }
 
 func (a *ApiClient) AuthCallback() (time.Duration, error) {
@@ -234,7 +247,31 @@ func (a *ApiClient) AuthCallback() (time.Duration, error) {
 	return time.Duration(a.keyTimeoutAt - time.Now().UnixMilli() - 50), nil
 }
 
+// Authenticates with the space node and creates a new
+// session key. The transitions of the client's auth
+// state are delivered to its auth state subscribers.
 func (a *ApiClient) Authenticate() (bool, error) {
+
+	a.keyRefreshMutex.Lock()
+	defer a.keyRefreshMutex.Unlock()
+
+	// a valid key is being renewed
+	if a.isAuthenticated && time.Now().UnixMilli() < a.keyTimeoutAt {
+		a.setAuthState(AuthStateExpiring, nil)
+	} else {
+		a.setAuthState(AuthStateAuthenticating, nil)
+	}
+
+	isAuthenticated, err := a.authenticate()
+	if isAuthenticated {
+		a.setAuthState(AuthStateAuthenticated, nil)
+	} else {
+		a.setAuthState(AuthStateFailed, err)
+	}
+	return isAuthenticated, err
+}
+
+func (a *ApiClient) authenticate() (bool, error) {
 	
 	var (
 		err error
@@ -252,9 +289,6 @@ func (a *ApiClient) Authenticate() (bool, error) {
 		encryptionKey []byte
 	)
 
-	a.keyRefreshMutex.Lock()
-	defer a.keyRefreshMutex.Unlock()
-
 	a.isAuthenticated = false
 
 	if ecdhKey, err = crypto.NewECDHKey(); err != nil {
@@ -272,7 +306,7 @@ func (a *ApiClient) Authenticate() (bool, error) {
 		return false, err
 	}
 	logger.DebugMessage(
-		"ApiClient.Authenticate(): created auth request key with nonce '%d': %# v", 
+		"ApiClient.authenticate(): created auth request key with nonce '%d': %# v", 
 		authReqKey.Nonce, authReqKey)
 
 	if authReqKeyEncrypted, err = a.nodePublicKey.EncryptBase64(authReqKeyJSON); err != nil {
@@ -293,20 +327,15 @@ func (a *ApiClient) Authenticate() (bool, error) {
 	}
 	if err = a.restAuthClient.NewRequest(request).DoPost(response); err != nil {
 		logger.ErrorMessage(
-			"ApiClient.Authenticate(): HTTP error: %s", 
+			"ApiClient.authenticate(): HTTP error: %s", 
 			err.Error())
 
 		if len(errorResponse.ErrorMessage) > 0 {
 			logger.ErrorMessage(
-				"ApiClient.Authenticate(): Error message body: Error Code: %d; Error Message: %s", 
+				"ApiClient.authenticate(): Error message body: Error Code: %d; Error Message: %s", 
 				errorResponse.ErrorCode, errorResponse.ErrorMessage)
-	
-			// todo: return a custom error type 
-			// with parsed error object
-			return false, fmt.Errorf(errorResponse.ErrorMessage)	
-		} else {
-			return false, err
 		}
+		return false, newApiError(response.StatusCode, &errorResponse, err, true)
 	}
 
 	if authRespKeyJSON, err = a.clientRSAKey.DecryptBase64(authResponse.AuthRespKey); err != nil {
@@ -317,13 +346,24 @@ func (a *ApiClient) Authenticate() (bool, error) {
 		return false, err
 	}
 	logger.DebugMessage(
-		"ApiClient.Authenticate(): received auth response key with nonce '%d': %# v", 
+		"ApiClient.authenticate(): received auth response key with nonce '%d': %# v", 
 		authReqKey.Nonce, authRespKey)
 
-	if authRespKey.RefName != a.refName || 
-		authRespKey.Nonce != authReqKey.Nonce {
-		
-		return false, fmt.Errorf("invalid auth response")
+	if authRespKey.RefName != a.refName {
+		return false, &ApiError{
+			StatusCode: response.StatusCode,
+			Err: ErrInvalidCredentials,
+			Cause: fmt.Errorf("auth response is for '%s'", authRespKey.RefName),
+		}
+	}
+	if authRespKey.Nonce != authReqKey.Nonce {
+		// the response may have been replayed
+		// so a new auth request may succeed
+		return false, &ApiError{
+			StatusCode: response.StatusCode,
+			Retryable: true,
+			Err: ErrNonceMismatch,
+		}
 	}	
 
 	if encryptionKey, err = ecdhKey.SharedSecret(authRespKey.NodeECDHKey); err != nil {
@@ -345,6 +385,7 @@ func (a *ApiClient) Reset() {
 	defer a.keyRefreshMutex.Unlock()
 	
 	a.isAuthenticated = false
+	a.setAuthState(AuthStateUnauthenticated, nil)
 }
 
 //
@@ -360,35 +401,61 @@ func (a *ApiClient) IsAuthenticated() bool {
 		(time.Now().UnixNano() / int64(time.Millisecond)) < a.keyTimeoutAt
 }
 
+// Waits until the client has been authenticated by
+// its background authentication or the auth timeout
+// elapses. Returns false if the client did not
+// authenticate or if its authentication failed and
+// no background authentication has been started to
+// retry it.
 func (a *ApiClient) WaitForAuth() bool {
 	
-	if !a.IsAuthenticated() {
-		timer := time.NewTicker(10 * time.Millisecond)
-		defer timer.Stop()
-	
-		// trap ctrl-c
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
+	if a.IsAuthenticated() {
+		return true
+	}
 
-		// timeoout
-		timeoutAt := time.Duration(time.Now().UnixNano()) + a.authTimeout
-	
-		for {
-			select {
-			case <-c:
-				return false
-			case <-timer.C:
+	subscription := a.SubscribeAuthState(1)
+	defer subscription.Cancel()
+
+	// trap ctrl-c
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	defer signal.Stop(c)
+
+	// timeout
+	timer := time.NewTimer(a.authTimeout * time.Millisecond)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-c:
+			return false
+		case <-timer.C:
+			logger.TraceMessage("Timedout waiting for successful authentication with the MyCS Rest API.")
+			return false
+		case status := <-subscription.States():
+			switch status.State {
+			case AuthStateAuthenticated:
 				if a.IsAuthenticated() {
 					return true
 				}
-			}
-			if time.Duration(time.Now().UnixNano()) > timeoutAt {
-				logger.TraceMessage("Timedout waiting for successful authentication with the MyCS Rest API.")
+			case AuthStateFailed:
+				if a.backgroundAuth() == nil {
+					return false
+				}
+			case AuthStateStopped:
 				return false
 			}
 		}
 	}
-	return true
+}
+
+// returns the timer of the background authentication
+// or nil if background authentication was not started
+func (a *ApiClient) backgroundAuth() *utils.ExecTimer {
+	a.authStateMutex.Lock()
+	defer a.authStateMutex.Unlock()
+
+	return a.authExecTimer
 }
 
 func (a *ApiClient) AuthTokenKey() string {
@@ -0,0 +1,240 @@
+package mycsnode
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuthState is the state of the api client's
+// authentication with the space node
+type AuthState int
+
+const (
+	// the client has not authenticated or
+	// its authentication has been reset
+	AuthStateUnauthenticated AuthState = iota
+	// the client is authenticating
+	AuthStateAuthenticating
+	// the client has a valid session key
+	AuthStateAuthenticated
+	// the client's session key is about to
+	// expire and is being renewed
+	AuthStateExpiring
+	// the client failed to authenticate
+	AuthStateFailed
+	// the client's background authentication
+	// has been stopped
+	AuthStateStopped
+)
+
+func (s AuthState) String() string {
+	switch s {
+	case AuthStateUnauthenticated:
+		return "unauthenticated"
+	case AuthStateAuthenticating:
+		return "authenticating"
+	case AuthStateAuthenticated:
+		return "authenticated"
+	case AuthStateExpiring:
+		return "expiring"
+	case AuthStateFailed:
+		return "failed"
+	case AuthStateStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// AuthStatus describes a transition of
+// the api client's auth state
+type AuthStatus struct {
+	State AuthState
+	// error with which authentication failed
+	Err error
+	// time the session key expires if authenticated
+	ExpiresAt time.Time
+
+	Timestamp time.Time
+}
+
+// AuthSubscription receives the auth state
+// transitions of an api client
+type AuthSubscription struct {
+	client *ApiClient
+
+	states chan AuthStatus
+
+	// callback subscriptions
+	callback func(status AuthStatus)
+	done     chan struct{}
+	// set while the callback is handling a transition
+	inCallback atomic.Bool
+
+	closeOnce sync.Once
+}
+
+// Returns the current auth status of the client.
+func (a *ApiClient) AuthStatus() AuthStatus {
+	a.authStateMutex.Lock()
+	defer a.authStateMutex.Unlock()
+
+	return a.authStatus
+}
+
+// Subscribes to the client's auth state transitions
+// which are delivered on the subscription's channel
+// starting with the current status. The channel
+// buffers at most 'bufferSize' transitions after which
+// the oldest transitions are dropped so a slow
+// subscriber always receives the latest status.
+func (a *ApiClient) SubscribeAuthState(bufferSize int) *AuthSubscription {
+
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	s := &AuthSubscription{
+		client: a,
+		states: make(chan AuthStatus, bufferSize),
+	}
+	a.addAuthSubscription(s)
+	return s
+}
+
+// Subscribes to the client's auth state transitions
+// and invokes the callback with them in the order they
+// occurred starting with the current status. The callback
+// is invoked on a separate goroutine. Like the channel of
+// SubscribeAuthState at most 'bufferSize' transitions are
+// buffered for a slow callback after which the oldest
+// are dropped, so intermediate transitions may be missed
+// but the callback is always invoked with the latest
+// status.
+func (a *ApiClient) SubscribeAuthStateFunc(
+	bufferSize int,
+	callback func(status AuthStatus),
+) *AuthSubscription {
+
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	s := &AuthSubscription{
+		client:   a,
+		states:   make(chan AuthStatus, bufferSize),
+		callback: callback,
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		for status := range s.states {
+			s.inCallback.Store(true)
+			s.callback(status)
+			s.inCallback.Store(false)
+		}
+	}()
+	a.addAuthSubscription(s)
+	return s
+}
+
+func (a *ApiClient) addAuthSubscription(s *AuthSubscription) {
+	a.authStateMutex.Lock()
+	defer a.authStateMutex.Unlock()
+
+	a.authSubscriptions = append(a.authSubscriptions, s)
+	s.deliver(a.authStatus)
+}
+
+func (a *ApiClient) removeAuthSubscription(s *AuthSubscription) {
+	a.authStateMutex.Lock()
+	defer a.authStateMutex.Unlock()
+
+	for i, ss := range a.authSubscriptions {
+		if ss == s {
+			a.authSubscriptions = append(a.authSubscriptions[:i], a.authSubscriptions[i+1:]...)
+			break
+		}
+	}
+}
+
+// sets the client's auth state and delivers
+// the transition to all subscribers
+func (a *ApiClient) setAuthState(state AuthState, err error) {
+	a.authStateMutex.Lock()
+	defer a.authStateMutex.Unlock()
+
+	status := AuthStatus{
+		State:     state,
+		Err:       err,
+		Timestamp: time.Now(),
+	}
+	if state == AuthStateAuthenticated {
+		status.ExpiresAt = time.UnixMilli(a.keyTimeoutAt)
+	}
+	a.authStatus = status
+	for _, s := range a.authSubscriptions {
+		s.deliver(status)
+	}
+}
+
+// Returns the channel on which auth state transitions
+// are delivered. The channel is closed when the
+// subscription is cancelled. Callback subscriptions
+// should not read from this channel.
+func (s *AuthSubscription) States() <-chan AuthStatus {
+	return s.states
+}
+
+// Cancels the subscription and closes its channel.
+// For callback subscriptions this waits for all
+// buffered transitions to be handled unless the
+// callback is handling a transition, such as when
+// it is called from the callback, in which case it
+// returns immediately and no further transitions
+// are handled once the callback returns.
+func (s *AuthSubscription) Cancel() {
+	s.client.removeAuthSubscription(s)
+	s.closeOnce.Do(func() {
+		close(s.states)
+	})
+	if s.done != nil {
+		if s.inCallback.Load() {
+			// the callback may be the caller in
+			// which case it cannot wait for itself
+			s.discardBuffered()
+			return
+		}
+		<-s.done
+	}
+}
+
+// drains the transitions buffered for a callback
+// subscription cancelled while its callback was
+// handling a transition
+func (s *AuthSubscription) discardBuffered() {
+	for {
+		select {
+		case _, ok := <-s.states:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// delivers the status without blocking by
+// dropping the oldest buffered transitions
+func (s *AuthSubscription) deliver(status AuthStatus) {
+	for {
+		select {
+		case s.states <- status:
+			return
+		default:
+		}
+		select {
+		case <-s.states:
+		default:
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package mycsnode_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/mycsnode"
+
+	mycs_mocks "github.com/appbricks/mycloudspace-common/test/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MyCS Node API Auth State", func() {
+
+	var (
+		err error
+
+		mockNodeService *mycs_mocks.MockNodeService
+
+		apiClient *mycsnode.ApiClient
+		handler   *mycs_mocks.MockServiceHandler
+	)
+
+	BeforeEach(func() {
+		mockNodeService = mycs_mocks.StartMockNodeServices()
+
+		apiClient = mockNodeService.NewApiClient()
+		handler = mockNodeService.NewServiceHandler()
+	})
+
+	AfterEach(func() {
+		mockNodeService.Stop()
+	})
+
+	// returns the states buffered by the subscription
+	bufferedStates := func(subscription *mycsnode.AuthSubscription) []mycsnode.AuthStatus {
+		states := []mycsnode.AuthStatus{}
+		for {
+			select {
+			case status := <-subscription.States():
+				states = append(states, status)
+			default:
+				return states
+			}
+		}
+	}
+
+	It("delivers the auth state transitions to subscribers", func() {
+
+		subscription := apiClient.SubscribeAuthState(10)
+		defer subscription.Cancel()
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendAuthResponse)
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendAuthResponse)
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			RespondWithError(authErrorResponse, 400)
+
+		_, err = apiClient.Authenticate()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = apiClient.Authenticate()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = apiClient.Authenticate()
+		Expect(err).To(HaveOccurred())
+		apiClient.Stop()
+		Expect(mockNodeService.TestServer.Done()).To(BeTrue())
+
+		states := bufferedStates(subscription)
+		Expect(len(states)).To(Equal(8))
+		Expect(states[0].State).To(Equal(mycsnode.AuthStateUnauthenticated))
+		Expect(states[1].State).To(Equal(mycsnode.AuthStateAuthenticating))
+		Expect(states[2].State).To(Equal(mycsnode.AuthStateAuthenticated))
+		Expect(states[2].ExpiresAt).To(BeTemporally(">", time.Now()))
+		// renewing a valid key
+		Expect(states[3].State).To(Equal(mycsnode.AuthStateExpiring))
+		Expect(states[4].State).To(Equal(mycsnode.AuthStateAuthenticated))
+		Expect(states[5].State).To(Equal(mycsnode.AuthStateExpiring))
+		Expect(states[6].State).To(Equal(mycsnode.AuthStateFailed))
+		Expect(errors.Is(states[6].Err, mycsnode.ErrInvalidCredentials)).To(BeTrue())
+		Expect(states[7].State).To(Equal(mycsnode.AuthStateStopped))
+
+		Expect(apiClient.AuthStatus().State).To(Equal(mycsnode.AuthStateStopped))
+	})
+
+	It("delivers only the latest transitions to a slow subscriber", func() {
+
+		subscription := apiClient.SubscribeAuthState(1)
+		defer subscription.Cancel()
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendAuthResponse)
+
+		_, err = apiClient.Authenticate()
+		Expect(err).ToNot(HaveOccurred())
+
+		states := bufferedStates(subscription)
+		Expect(len(states)).To(Equal(1))
+		Expect(states[0].State).To(Equal(mycsnode.AuthStateAuthenticated))
+	})
+
+	It("cancels a callback subscription from its callback", func() {
+
+		var (
+			subscription *mycsnode.AuthSubscription
+			states       []mycsnode.AuthState
+		)
+
+		subscribed := make(chan struct{})
+		cancelled := make(chan struct{})
+		subscription = apiClient.SubscribeAuthStateFunc(10, func(status mycsnode.AuthStatus) {
+			<-subscribed
+			states = append(states, status.State)
+			if status.State == mycsnode.AuthStateAuthenticated {
+				subscription.Cancel()
+				close(cancelled)
+			}
+		})
+		close(subscribed)
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendAuthResponse)
+
+		_, err = apiClient.Authenticate()
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(cancelled).Should(BeClosed())
+
+		// transitions after the cancellation
+		// are not delivered
+		apiClient.Stop()
+		subscription.Cancel()
+		Expect(states).To(Equal([]mycsnode.AuthState{
+			mycsnode.AuthStateUnauthenticated,
+			mycsnode.AuthStateAuthenticating,
+			mycsnode.AuthStateAuthenticated,
+		}))
+	})
+
+	It("waits for the background authentication to complete", func() {
+
+		var (
+			mx     sync.Mutex
+			states []mycsnode.AuthState
+		)
+
+		subscription := apiClient.SubscribeAuthStateFunc(10, func(status mycsnode.AuthStatus) {
+			mx.Lock()
+			defer mx.Unlock()
+			states = append(states, status.State)
+		})
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			RespondWithError(authErrorResponse, 400)
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendAuthResponse)
+
+		err = apiClient.Start()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apiClient.WaitForAuth()).To(BeTrue())
+		Expect(apiClient.IsAuthenticated()).To(BeTrue())
+		apiClient.Stop()
+		Expect(apiClient.WaitForAuth()).To(BeTrue())
+		Expect(mockNodeService.TestServer.Done()).To(BeTrue())
+
+		// waits for the callbacks of all
+		// delivered transitions
+		subscription.Cancel()
+		Expect(states).To(Equal([]mycsnode.AuthState{
+			mycsnode.AuthStateUnauthenticated,
+			mycsnode.AuthStateAuthenticating,
+			mycsnode.AuthStateFailed,
+			mycsnode.AuthStateAuthenticating,
+			mycsnode.AuthStateAuthenticated,
+			mycsnode.AuthStateStopped,
+		}))
+	})
+})
@@ -0,0 +1,110 @@
+package mycsnode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid client credentials")
+	ErrNonceMismatch      = errors.New("auth response nonce does not match the request")
+	ErrNodeNotRunning     = errors.New("space node is not running")
+	ErrKeyExpired         = errors.New("session key has expired")
+	ErrRequestFailed      = errors.New("space node api request failed")
+)
+
+// ApiError is returned when a request to the space
+// node's api fails. It can be matched with one of
+// the Err* errors above via errors.Is to determine
+// the cause of the failure.
+type ApiError struct {
+	// http status of the response which is 0
+	// if the node could not be reached
+	StatusCode int
+
+	// error returned by the node if any
+	ErrorCode    int
+	ErrorMessage string
+
+	// whether the request may succeed if it is
+	// retried after re-authenticating or once the
+	// node is reachable
+	Retryable bool
+
+	// one of the Err* errors above
+	Err error
+	// underlying error if any
+	Cause error
+}
+
+func (e *ApiError) Error() string {
+	if len(e.ErrorMessage) > 0 {
+		return fmt.Sprintf("%s: %s (error code %d)", e.Err.Error(), e.ErrorMessage, e.ErrorCode)
+	}
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s", e.Err.Error(), e.Cause.Error())
+	}
+	return e.Err.Error()
+}
+
+// Returns whether the request may succeed if it is
+// retried. This allows events that failed to publish
+// with this error to be classified for retries.
+func (e *ApiError) IsRetryable() bool {
+	return e.Retryable
+}
+
+func (e *ApiError) Unwrap() []error {
+	if e.Cause != nil {
+		return []error{e.Err, e.Cause}
+	}
+	return []error{e.Err}
+}
+
+// returns an api error for a failed request classified
+// by the response's status. a client error response to
+// an auth request means the client's credentials were
+// rejected whereas an unauthorized response to any other
+// request means the session key is no longer valid.
+func newApiError(
+	statusCode int,
+	errorResponse *ErrorResponse,
+	cause error,
+	isAuthRequest bool,
+) *ApiError {
+
+	apiError := &ApiError{
+		StatusCode:   statusCode,
+		ErrorCode:    errorResponse.ErrorCode,
+		ErrorMessage: errorResponse.ErrorMessage,
+		Cause:        cause,
+	}
+	switch {
+	case statusCode == 0,
+		statusCode == http.StatusBadGateway,
+		statusCode == http.StatusServiceUnavailable,
+		statusCode == http.StatusGatewayTimeout:
+		// the node is offline or unreachable
+		apiError.Err = ErrNodeNotRunning
+		apiError.Retryable = true
+
+	case isAuthRequest &&
+		statusCode >= http.StatusBadRequest &&
+		statusCode < http.StatusInternalServerError &&
+		statusCode != http.StatusTooManyRequests:
+		// the node rejected the client's auth request
+		apiError.Err = ErrInvalidCredentials
+
+	case statusCode == http.StatusUnauthorized,
+		statusCode == http.StatusForbidden:
+		apiError.Err = ErrKeyExpired
+		apiError.Retryable = true
+
+	default:
+		apiError.Err = ErrRequestFailed
+		apiError.Retryable = statusCode == http.StatusTooManyRequests ||
+			statusCode >= http.StatusInternalServerError
+	}
+	return apiError
+}
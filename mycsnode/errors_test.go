@@ -0,0 +1,111 @@
+package mycsnode_test
+
+import (
+	"errors"
+
+	"github.com/appbricks/mycloudspace-common/mycsnode"
+
+	mycs_mocks "github.com/appbricks/mycloudspace-common/test/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MyCS Node API Errors", func() {
+
+	var (
+		err error
+
+		mockNodeService *mycs_mocks.MockNodeService
+		isStopped       bool
+	)
+
+	BeforeEach(func() {
+		mockNodeService = mycs_mocks.StartMockNodeServices()
+		isStopped = false
+	})
+
+	AfterEach(func() {
+		if !isStopped {
+			mockNodeService.Stop()
+		}
+	})
+
+	It("returns an invalid credentials error when the node rejects the auth request", func() {
+		apiClient := mockNodeService.NewApiClient()
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			RespondWithError(authErrorResponse, 400)
+
+		_, err = apiClient.Authenticate()
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, mycsnode.ErrInvalidCredentials)).To(BeTrue())
+		Expect(errors.Is(err, mycsnode.ErrNodeNotRunning)).To(BeFalse())
+
+		apiError := &mycsnode.ApiError{}
+		Expect(errors.As(err, &apiError)).To(BeTrue())
+		Expect(apiError.StatusCode).To(Equal(400))
+		Expect(apiError.ErrorCode).To(Equal(1001))
+		Expect(apiError.ErrorMessage).To(Equal("Request Error"))
+		Expect(apiError.Retryable).To(BeFalse())
+		Expect(mockNodeService.TestServer.Done()).To(BeTrue())
+	})
+
+	It("returns the error authentication failed with when invoking an api", func() {
+		apiClient := mockNodeService.NewApiClient()
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			RespondWithError(authErrorResponse, 400)
+
+		_, err = apiClient.Authenticate()
+		Expect(err).To(HaveOccurred())
+
+		_, err = apiClient.CreateMeshAuthKey(0)
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, mycsnode.ErrInvalidCredentials)).To(BeTrue())
+		Expect(errors.Is(err, mycsnode.ErrKeyExpired)).To(BeFalse())
+
+		apiError := &mycsnode.ApiError{}
+		Expect(errors.As(err, &apiError)).To(BeTrue())
+		Expect(apiError.StatusCode).To(Equal(400))
+		Expect(apiError.Retryable).To(BeFalse())
+		Expect(mockNodeService.TestServer.Done()).To(BeTrue())
+	})
+
+	It("returns a nonce mismatch error when the auth response is for a different request", func() {
+		apiClient := mockNodeService.NewApiClient()
+		handler := mockNodeService.NewServiceHandler()
+		handler.NonceOffset = 1
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendAuthResponse)
+
+		isAuthenticated, err := apiClient.Authenticate()
+		Expect(isAuthenticated).To(BeFalse())
+		Expect(errors.Is(err, mycsnode.ErrNonceMismatch)).To(BeTrue())
+		Expect(apiClient.IsAuthenticated()).To(BeFalse())
+		Expect(mockNodeService.TestServer.Done()).To(BeTrue())
+	})
+
+	It("returns a node not running error when the node cannot be reached", func() {
+		apiClient := mockNodeService.NewApiClient()
+		mockNodeService.Stop()
+		isStopped = true
+
+		_, err = apiClient.Authenticate()
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, mycsnode.ErrNodeNotRunning)).To(BeTrue())
+		Expect(errors.Is(err, mycsnode.ErrInvalidCredentials)).To(BeFalse())
+
+		apiError := &mycsnode.ApiError{}
+		Expect(errors.As(err, &apiError)).To(BeTrue())
+		Expect(apiError.StatusCode).To(Equal(0))
+		Expect(apiError.Retryable).To(BeTrue())
+	})
+})
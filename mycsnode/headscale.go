@@ -1,5 +1,15 @@
 package mycsnode
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/mevansam/goutils/logger"
+	"github.com/mevansam/goutils/rest"
+)
+
 type CreateMeshAuthKeyReq struct {
 	ExpiresIn int64 `json:"expiresIn,omitempty"`
 }
@@ -15,3 +25,126 @@ type TSNode struct {
 	Endpoints []string `json:"endpoints,omitempty"`
 	Routes    []string `json:"routes,omitempty"`
 }
+
+type MeshAuthKey struct {
+	AuthKey   string `json:"authKey"`
+	CreatedAt int64  `json:"createdAt,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"`
+	Used      bool   `json:"used,omitempty"`
+	Revoked   bool   `json:"revoked,omitempty"`
+}
+type ListMeshAuthKeysResp struct {
+	AuthKeys []MeshAuthKey `json:"authKeys"`
+}
+
+const meshAuthKeyPath = "/meshAuthKey"
+
+// Creates an auth key with which a device can join the
+// space node's mesh network. The key expires after the
+// given number of seconds or the node's default if 0.
+func (a *ApiClient) CreateMeshAuthKey(expiresIn int64) (*CreateMeshAuthKeyResp, error) {
+
+	var (
+		err error
+	)
+
+	createMeshAuthKeyResp := &CreateMeshAuthKeyResp{}
+	if err = a.invoke(
+		http.MethodPost, meshAuthKeyPath,
+		&CreateMeshAuthKeyReq{ExpiresIn: expiresIn},
+		createMeshAuthKeyResp,
+	); err != nil {
+		return nil, err
+	}
+	return createMeshAuthKeyResp, nil
+}
+
+// Returns the mesh auth keys created by the client.
+func (a *ApiClient) ListMeshAuthKeys() ([]MeshAuthKey, error) {
+
+	var (
+		err error
+	)
+
+	listMeshAuthKeysResp := &ListMeshAuthKeysResp{}
+	if err = a.invoke(
+		http.MethodGet, meshAuthKeyPath,
+		nil, listMeshAuthKeysResp,
+	); err != nil {
+		return nil, err
+	}
+	return listMeshAuthKeysResp.AuthKeys, nil
+}
+
+// Revokes the given mesh auth key so it can no
+// longer be used to join the mesh network.
+func (a *ApiClient) RevokeMeshAuthKey(authKey string) error {
+	return a.invoke(
+		http.MethodDelete, meshAuthKeyPath + "/" + url.PathEscape(authKey),
+		nil, nil,
+	)
+}
+
+// invokes an api of the node once the client has been
+// authenticated. the request and response bodies are
+// encrypted with the client's session key by the rest
+// api client.
+func (a *ApiClient) invoke(method, path string, reqBody, respBody interface{}) error {
+
+	var (
+		err error
+
+		errorResponse ErrorResponse
+	)
+
+	if !a.WaitForAuth() {
+		// return the error authentication failed
+		// with if known instead of assuming the
+		// session key expired
+		if status := a.AuthStatus(); status.State == AuthStateFailed && status.Err != nil {
+			return status.Err
+		}
+		return &ApiError{
+			Retryable: true,
+			Err: ErrKeyExpired,
+			Cause: errors.New("timed out waiting for authentication"),
+		}
+	}
+
+	request := &rest.Request{
+		Path: path,
+		Headers: rest.NV{
+			"X-Auth-Key": a.AuthIDKey,
+		},
+		Body: reqBody,
+	}
+	response := &rest.Response{
+		Body: respBody,
+		Error: &errorResponse,
+	}
+
+	restApiClient := a.RestApiClient.NewRequest(request)
+	switch method {
+	case http.MethodGet:
+		err = restApiClient.DoGet(response)
+	case http.MethodPost:
+		err = restApiClient.DoPost(response)
+	case http.MethodDelete:
+		err = restApiClient.DoDelete(response)
+	default:
+		return fmt.Errorf("unsupported request method '%s'", method)
+	}
+	if err != nil {
+		logger.ErrorMessage(
+			"ApiClient.invoke(): HTTP error invoking %s %s: %s",
+			method, path, err.Error())
+
+		if len(errorResponse.ErrorMessage) > 0 {
+			logger.ErrorMessage(
+				"ApiClient.invoke(): Error message body: Error Code: %d; Error Message: %s",
+				errorResponse.ErrorCode, errorResponse.ErrorMessage)
+		}
+		return newApiError(response.StatusCode, &errorResponse, err, false)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package mycsnode_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/appbricks/mycloudspace-common/mycsnode"
+
+	mycs_mocks "github.com/appbricks/mycloudspace-common/test/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MyCS Node Mesh API", func() {
+
+	var (
+		err error
+
+		mockNodeService *mycs_mocks.MockNodeService
+
+		apiClient *mycsnode.ApiClient
+		handler   *mycs_mocks.MockServiceHandler
+	)
+
+	BeforeEach(func() {
+		mockNodeService = mycs_mocks.StartMockNodeServices()
+
+		apiClient = mockNodeService.NewApiClient()
+		handler = mockNodeService.NewServiceHandler()
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/auth").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendAuthResponse)
+
+		isAuthenticated, err := apiClient.Authenticate()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(isAuthenticated).To(BeTrue())
+	})
+
+	AfterEach(func() {
+		mockNodeService.Stop()
+	})
+
+	It("creates, lists and revokes mesh auth keys", func() {
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/meshAuthKey").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendCreateMeshAuthKeyResponse)
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/meshAuthKey").
+			ExpectMethod("POST").
+			WithCallbackTest(handler.SendCreateMeshAuthKeyResponse)
+
+		createMeshAuthKeyResp, err := apiClient.CreateMeshAuthKey(3600)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(createMeshAuthKeyResp.AuthKey).To(Equal("mesh-auth-key-1"))
+		Expect(createMeshAuthKeyResp.DNS).To(Equal([]string{"100.64.0.1"}))
+		Expect(createMeshAuthKeyResp.SpaceNode.Name).To(Equal("space-node"))
+		Expect(createMeshAuthKeyResp.SpaceNode.IP).To(Equal("100.64.0.1"))
+
+		_, err = apiClient.CreateMeshAuthKey(0)
+		Expect(err).ToNot(HaveOccurred())
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/meshAuthKey/mesh-auth-key-1").
+			ExpectMethod("DELETE").
+			WithCallbackTest(handler.SendRevokeMeshAuthKeyResponse)
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/meshAuthKey").
+			ExpectMethod("GET").
+			WithCallbackTest(handler.SendListMeshAuthKeysResponse)
+
+		err = apiClient.RevokeMeshAuthKey("mesh-auth-key-1")
+		Expect(err).ToNot(HaveOccurred())
+
+		authKeys, err := apiClient.ListMeshAuthKeys()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(authKeys)).To(Equal(2))
+		Expect(authKeys[0].AuthKey).To(Equal("mesh-auth-key-1"))
+		Expect(authKeys[0].Revoked).To(BeTrue())
+		Expect(authKeys[1].AuthKey).To(Equal("mesh-auth-key-2"))
+		Expect(authKeys[1].Revoked).To(BeFalse())
+		Expect(authKeys[0].ExpiresAt - authKeys[0].CreatedAt).To(Equal(time.Hour.Milliseconds()))
+		// keys created without an expiry
+		// expire after the node's default
+		Expect(authKeys[1].ExpiresAt - authKeys[1].CreatedAt).To(Equal(mycs_mocks.DefaultMeshAuthKeyExpiry.Milliseconds()))
+		Expect(mockNodeService.TestServer.Done()).To(BeTrue())
+	})
+
+	It("returns the error message of a failed request", func() {
+
+		mockNodeService.TestServer.PushRequest().
+			ExpectPath("/meshAuthKey/unknown-key").
+			ExpectMethod("DELETE").
+			RespondWithError(meshAuthKeyErrorResponse, 404)
+
+		err = apiClient.RevokeMeshAuthKey("unknown-key")
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, mycsnode.ErrRequestFailed)).To(BeTrue())
+
+		apiError := &mycsnode.ApiError{}
+		Expect(errors.As(err, &apiError)).To(BeTrue())
+		Expect(apiError.StatusCode).To(Equal(404))
+		Expect(apiError.ErrorCode).To(Equal(1004))
+		Expect(apiError.ErrorMessage).To(Equal("Auth key not found"))
+		Expect(apiError.Retryable).To(BeFalse())
+		Expect(mockNodeService.TestServer.Done()).To(BeTrue())
+	})
+})
+
+const meshAuthKeyErrorResponse = `{"errorCode":1004,"errorMessage":"Auth key not found"}`
@@ -0,0 +1,21 @@
+package tailscale
+
+import (
+	"tailscale.com/ipn/ipnstate"
+)
+
+// Returns a daemon that is not started which can be
+// used to test its peer transition checks.
+func NewTestDaemon() *TailscaleDaemon {
+	return &TailscaleDaemon{
+		peerStatus: make(map[string]*ipnstate.PeerStatus),
+	}
+}
+
+func (tsd *TailscaleDaemon) CheckPeerTransitions(peers ...*ipnstate.PeerStatus) {
+	tsd.mx.Lock()
+	peerEvents := tsd.checkPeerTransitions(peers)
+	tsd.mx.Unlock()
+
+	tsd.postEvents(peerEvents)
+}
@@ -15,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/go-multierror/multierror"
 	"github.com/mitchellh/go-homedir"
 	"github.com/sirupsen/logrus"
@@ -44,6 +45,9 @@ import (
 	"tailscale.com/wgengine/netstack"
 	"tailscale.com/wgengine/router"
 
+	"github.com/appbricks/mycloudspace-common/events"
+	"github.com/appbricks/mycloudspace-common/monitors"
+
 	cb_logger "github.com/mevansam/goutils/logger"
 	"github.com/mevansam/goutils/utils"
 )
@@ -75,6 +79,12 @@ type TailscaleDaemon struct {
 	// timer ping mesh nodes 
 	// to ensure connectivitity
 	nodeCheckTimer *utils.ExecTimer
+
+	// service via which mesh peer lifecycle
+	// events are posted and the last known
+	// status of each peer by node id
+	monitorService *monitors.MonitorService
+	peerStatus     map[string]*ipnstate.PeerStatus
 	
 	// released when ipn server exits
 	exit *sync.WaitGroup
@@ -132,6 +142,8 @@ func NewTailscaleDaemon(statePath string, logOut io.Writer) *TailscaleDaemon {
 
 		verbose: verboseLevel,
 
+		peerStatus: make(map[string]*ipnstate.PeerStatus),
+
 		exit: &sync.WaitGroup{},
 	}
 
@@ -141,6 +153,15 @@ func NewTailscaleDaemon(statePath string, logOut io.Writer) *TailscaleDaemon {
 	return tsd
 }
 
+// Sets the monitor service via which events are posted
+// when mesh peers come online or go offline.
+func (tsd *TailscaleDaemon) SetMonitorService(monitorService *monitors.MonitorService) {
+	tsd.mx.Lock()
+	defer tsd.mx.Unlock()
+
+	tsd.monitorService = monitorService
+}
+
 func (tsd *TailscaleDaemon) TunnelDeviceName() string {
 	return tsd.devName
 }
@@ -186,6 +207,8 @@ func (tsd *TailscaleDaemon) nodeCheck() (to time.Duration, err error) {
 		return
 	}
 
+	var peerEvents []*cloudevents.Event
+
 	tsd.mx.Lock()
 	defer func() {
 		tsd.mx.Unlock()
@@ -195,10 +218,17 @@ func (tsd *TailscaleDaemon) nodeCheck() (to time.Duration, err error) {
 		if perr := recover(); perr != nil {
 			cb_logger.ErrorMessage("TailscaleDaemon.nodeCheck(): Underlying tailscale daemon paniced: %v", perr)
 		}
+		tsd.postEvents(peerEvents)
 	}()
 
-	for _, ps := range tsd.LocalBackend.Status().Peer {
+	status := tsd.LocalBackend.Status()
+	peers := make([]*ipnstate.PeerStatus, 0, len(status.Peer))
+	for _, ps := range status.Peer {
+		peers = append(peers, ps)
+	}
+	peerEvents = tsd.checkPeerTransitions(peers)
 
+	for _, ps := range peers {
 		if ps.Online {
 			peerStatus := ps
 			go func() {
@@ -265,6 +295,116 @@ func (tsd *TailscaleDaemon) nodeCheck() (to time.Duration, err error) {
 	return
 }
 
+// checks the online state transitions of the peers in
+// the netmap and returns the events to be posted for
+// them. peers that were online when last checked but
+// are no longer in the netmap have gone offline.
+func (tsd *TailscaleDaemon) checkPeerTransitions(peers []*ipnstate.PeerStatus) []*cloudevents.Event {
+
+	peerEvents := []*cloudevents.Event{}
+	addEvent := func(event *cloudevents.Event) {
+		if event != nil {
+			peerEvents = append(peerEvents, event)
+		}
+	}
+
+	current := make(map[string]bool)
+	for _, ps := range peers {
+		current[string(ps.ID)] = true
+		addEvent(tsd.checkPeerTransition(ps))
+	}
+	for peerID, lastStatus := range tsd.peerStatus {
+		if current[peerID] {
+			continue
+		}
+		cb_logger.DebugMessage(
+			"TailscaleDaemon.checkPeerTransitions(): Peer '%s' (%s) was removed from the netmap.",
+			lastStatus.DNSName, peerID,
+		)
+		removed := *lastStatus
+		removed.Online = false
+		addEvent(tsd.checkPeerTransition(&removed))
+		delete(tsd.peerStatus, peerID)
+	}
+	return peerEvents
+}
+
+// returns a peer-online or peer-offline event if the
+// peer's online state has changed since it was last
+// checked. peers seen for the first time only result
+// in an event if they are online.
+func (tsd *TailscaleDaemon) checkPeerTransition(ps *ipnstate.PeerStatus) *cloudevents.Event {
+
+	var (
+		err error
+
+		event     *cloudevents.Event
+		eventType string
+		subject   string
+	)
+
+	peerID := string(ps.ID)
+	lastStatus, seen := tsd.peerStatus[peerID]
+	// a copy is retained so the offline event of a peer
+	// removed from the netmap can describe the peer
+	status := *ps
+	tsd.peerStatus[peerID] = &status
+
+	if (seen && lastStatus.Online == ps.Online) || (!seen && !ps.Online) {
+		return nil
+	}
+	if ps.Online {
+		eventType = events.MeshPeerOnlineEventType
+		subject = "Mesh Peer Online"
+	} else {
+		eventType = events.MeshPeerOfflineEventType
+		subject = "Mesh Peer Offline"
+	}
+	cb_logger.DebugMessage(
+		"TailscaleDaemon.checkPeerTransition(): Peer '%s' (%s) online state changed to %t.",
+		ps.DNSName, peerID, ps.Online,
+	)
+	if tsd.monitorService == nil {
+		return nil
+	}
+
+	addresses := make([]string, 0, len(ps.TailscaleIPs))
+	for _, ip := range ps.TailscaleIPs {
+		addresses = append(addresses, ip.String())
+	}
+	if event, err = events.NewLifecycleEvent(eventType, subject, &events.MeshPeerData{
+		PeerID:    peerID,
+		HostName:  ps.HostName,
+		DNSName:   ps.DNSName,
+		Addresses: addresses,
+		Online:    ps.Online,
+		LastSeen:  ps.LastSeen,
+	}); err != nil {
+		cb_logger.ErrorMessage(
+			"TailscaleDaemon.checkPeerTransition(): Unable to create '%s' event for peer '%s': %s",
+			eventType, ps.DNSName, err.Error(),
+		)
+		return nil
+	}
+	return event
+}
+
+// posts the given events via the monitor service. the
+// events are posted without the lock held so checking
+// the peers does not wait on the monitor service.
+func (tsd *TailscaleDaemon) postEvents(peerEvents []*cloudevents.Event) {
+	tsd.mx.Lock()
+	monitorService := tsd.monitorService
+	tsd.mx.Unlock()
+
+	if monitorService == nil {
+		return
+	}
+	for _, event := range peerEvents {
+		monitorService.PostEvent(event)
+	}
+}
+
 // copied from tailscale/cmd/tailscaled
 
 // defaultTunName returns the default tun device name for the platform.
@@ -1,8 +1,14 @@
 package tailscale_test
 
 import (
+	"strconv"
 	"strings"
+	"time"
 
+	"tailscale.com/ipn/ipnstate"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	"github.com/appbricks/mycloudspace-common/monitors"
 	"github.com/appbricks/mycloudspace-common/tailscale"
 	"github.com/mevansam/goutils/logger"
 	"github.com/mevansam/goutils/run"
@@ -38,4 +44,73 @@ var _ = Describe("Tailscale Daemon", func() {
 		Expect(output).To(ContainSubstring("flushing log."))
 		Expect(output).To(ContainSubstring("logger closing down"))
 	})
+
+	It("posts events when mesh peers come online, go offline or are removed from the netmap", func() {
+
+		bus := events.NewBus(0)
+		defer bus.Close()
+		sub := bus.Subscribe("io.appbricks.mycs.mesh.*", 10, events.DropNewest)
+
+		msvc := monitors.NewMonitorService(nil, 1, 100)
+		msvc.SetEventBus(bus)
+
+		tsd := tailscale.NewTestDaemon()
+		tsd.SetMonitorService(msvc)
+
+		peer1 := &ipnstate.PeerStatus{ID: "node1", HostName: "peer1", DNSName: "peer1.mesh.", Online: true}
+		peer2 := &ipnstate.PeerStatus{ID: "node2", HostName: "peer2", DNSName: "peer2.mesh."}
+
+		// peers seen for the first time only
+		// result in an event if they are online
+		tsd.CheckPeerTransitions(peer1, peer2)
+		Expect(receivePeerEvents(sub, 1)).To(Equal([]string{"peer-online:node1:true"}))
+		tsd.CheckPeerTransitions(peer1, peer2)
+		Expect(receivePeerEvents(sub, 0)).To(BeEmpty())
+
+		peer2.Online = true
+		tsd.CheckPeerTransitions(peer1, peer2)
+		Expect(receivePeerEvents(sub, 1)).To(Equal([]string{"peer-online:node2:true"}))
+
+		peer1.Online = false
+		tsd.CheckPeerTransitions(peer1, peer2)
+		Expect(receivePeerEvents(sub, 1)).To(Equal([]string{"peer-offline:node1:false"}))
+
+		// removing an offline peer from the
+		// netmap does not result in an event
+		tsd.CheckPeerTransitions(peer2)
+		Expect(receivePeerEvents(sub, 0)).To(BeEmpty())
+
+		// an online peer removed from
+		// the netmap has gone offline
+		tsd.CheckPeerTransitions()
+		Expect(receivePeerEvents(sub, 1)).To(Equal([]string{"peer-offline:node2:false"}))
+		tsd.CheckPeerTransitions()
+		Expect(receivePeerEvents(sub, 0)).To(BeEmpty())
+
+		// a removed peer that rejoins the
+		// netmap is seen for the first time
+		tsd.CheckPeerTransitions(peer1, peer2)
+		Expect(receivePeerEvents(sub, 1)).To(Equal([]string{"peer-online:node2:true"}))
+	})
 })
+
+// returns the type suffix, peer id and online
+// state of the given number of peer events
+func receivePeerEvents(sub *events.Subscription, count int) []string {
+	received := []string{}
+	for i := 0; i < count; i++ {
+		select {
+		case event := <-sub.Events():
+			data := events.MeshPeerData{}
+			Expect(event.DataAs(&data)).To(Succeed())
+			received = append(received,
+				strings.TrimPrefix(event.Type(), "io.appbricks.mycs.mesh.")+":"+
+					data.PeerID+":"+strconv.FormatBool(data.Online),
+			)
+		case <-time.After(time.Second):
+			Fail("timed out waiting for peer event")
+		}
+	}
+	Consistently(sub.Events(), 50*time.Millisecond).ShouldNot(Receive())
+	return received
+}
@@ -2,8 +2,10 @@ package mocks
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -38,12 +40,24 @@ type MockServiceHandler struct {
 	devicePublicKey *crypto.RSAPublicKey
 
 	authIDKey string
+
+	// offset added to the nonce of auth responses
+	// to simulate a mismatched or replayed response
+	NonceOffset int64
+
+	// mesh auth keys created via the
+	// mock mesh auth key api
+	MeshAuthKeys []mycsnode.MeshAuthKey
 }
 
 var (
 	testServerPort int32
 )
 
+// expiry the mock applies to mesh auth keys
+// created without one like the node's default
+const DefaultMeshAuthKeyExpiry = 24 * time.Hour
+
 func init() {
 	testServerPort = 9000
 }
@@ -156,7 +170,7 @@ func (h *MockServiceHandler) SendAuthResponse(w http.ResponseWriter, r *http.Req
 	// return shared secret and nonce
 	authRespKey := &mycsnode.AuthRespKey{
 		NodeECDHKey: ecdhPublicKey,
-		Nonce: authReqKey.Nonce,
+		Nonce: authReqKey.Nonce + h.NonceOffset,
 		// Nonce is in ms so need to convert it and add 2s
 		TimeoutAt: int64(time.Duration(authReqKey.Nonce) * time.Millisecond + 2 * time.Second) / int64(time.Millisecond),
 		RefName: deviceName,
@@ -197,6 +211,90 @@ func (h *MockServiceHandler) ValidateEncryption(apiClient *mycsnode.ApiClient) {
 	Expect(plainText).To(Equal("plain text test"))
 }
 
+func (h *MockServiceHandler) SendCreateMeshAuthKeyResponse(w http.ResponseWriter, r *http.Request, body string) *string {
+	defer GinkgoRecover()
+
+	createMeshAuthKeyReq := &mycsnode.CreateMeshAuthKeyReq{}
+	h.DecryptRequest(r, body, createMeshAuthKeyReq)
+
+	expiresIn := time.Duration(createMeshAuthKeyReq.ExpiresIn) * time.Second
+	if expiresIn == 0 {
+		expiresIn = DefaultMeshAuthKeyExpiry
+	}
+	now := time.Now()
+	authKey := mycsnode.MeshAuthKey{
+		AuthKey:   fmt.Sprintf("mesh-auth-key-%d", len(h.MeshAuthKeys)+1),
+		CreatedAt: now.UnixMilli(),
+		ExpiresAt: now.Add(expiresIn).UnixMilli(),
+	}
+	h.MeshAuthKeys = append(h.MeshAuthKeys, authKey)
+
+	return h.EncryptResponse(&mycsnode.CreateMeshAuthKeyResp{
+		AuthKey: authKey.AuthKey,
+		DNS:     []string{"100.64.0.1"},
+		SpaceNode: mycsnode.TSNode{
+			Name:      "space-node",
+			IP:        "100.64.0.1",
+			Endpoints: []string{"127.0.0.1:41641"},
+		},
+	})
+}
+
+func (h *MockServiceHandler) SendListMeshAuthKeysResponse(w http.ResponseWriter, r *http.Request, body string) *string {
+	defer GinkgoRecover()
+
+	h.DecryptRequest(r, body, nil)
+	return h.EncryptResponse(&mycsnode.ListMeshAuthKeysResp{
+		AuthKeys: h.MeshAuthKeys,
+	})
+}
+
+func (h *MockServiceHandler) SendRevokeMeshAuthKeyResponse(w http.ResponseWriter, r *http.Request, body string) *string {
+	defer GinkgoRecover()
+
+	h.DecryptRequest(r, body, nil)
+
+	authKey := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	for i, k := range h.MeshAuthKeys {
+		if k.AuthKey == authKey {
+			h.MeshAuthKeys[i].Revoked = true
+			return nil
+		}
+	}
+	Fail(fmt.Sprintf("mesh auth key '%s' to revoke was not found", authKey))
+	return nil
+}
+
+// validates that the request was sent by the authenticated
+// client and decrypts its body into the given value
+func (h *MockServiceHandler) DecryptRequest(r *http.Request, body string, v interface{}) {
+
+	Expect(r.Header.Get("X-Auth-Key")).To(Equal(h.authIDKey))
+	if v == nil || len(body) == 0 {
+		return
+	}
+
+	handlerCrypt, err := crypto.NewCrypt(h.encryptionKey)
+	Expect(err).ToNot(HaveOccurred())
+	plainText, err := handlerCrypt.DecryptB64(body)
+	Expect(err).ToNot(HaveOccurred())
+	err = json.Unmarshal([]byte(plainText), v)
+	Expect(err).ToNot(HaveOccurred())
+}
+
+// returns the given value as an encrypted response body
+func (h *MockServiceHandler) EncryptResponse(v interface{}) *string {
+
+	responseJSON, err := json.Marshal(v)
+	Expect(err).ToNot(HaveOccurred())
+
+	handlerCrypt, err := crypto.NewCrypt(h.encryptionKey)
+	Expect(err).ToNot(HaveOccurred())
+	responseBody, err := handlerCrypt.EncryptB64(string(responseJSON))
+	Expect(err).ToNot(HaveOccurred())
+	return &responseBody
+}
+
 const loggedInUserID = `7a4ae0c0-a25f-4376-9816-b45df8da5e88`
 const deviceIDKey = `b1f187f2-1019-4848-ae7c-4db0cec1f256|F+IVHNUM85lwwLSfGdlZCR2gcDpzDs1wF6CcEjWOr2zL/Kr5Fw1Utu1BX2i+2p+b5v8sSfy9g1AdYZhHKLKI7qeXWg9n/E1r8YzCyunVeByiWpWpn51Afca+pg5wQMlnLD4Sy8SHRICZj9XDF/9MYna/iX8FKNtVEymOSceYVkgAuH/YypNLp48D6Wk9oOJGLb5OBiAnnpNqrLadQ3kbShoLvl41ynfkNX3pqOMj5Y2qWGOoFkiru+zch6xlit5XrKVIOpV/iWwjNJTOjCaNJ2bcuMNFcF6EA8DgnfQPjgR2CfJhoENoCSo7ieO9EAfQmZJS3fWPiIgo8tCGW7cneNWbWz5agKn5tjrmeGXkwkPDKnbRpTBLeZ6akNP2C6GncEHICXvbetP46DcoZjLBt5sPx8vQeQ3EYFehi4PDz6LuWvppAkMa2pmI4VTQIdRxUH4Rp23MgcKQ40vHRA7FDP4JSmyseRozfSksBXWjZIul0/QDV3yYvkKaeOqYWwQv+sZiV8ZFHVFQDYr8yBzvxR3WCyyJSP+jmWIfC32WHIwV1KTtxZXlYwGHs/JmScTcR4Gs9qTdemsdLIvro6wPmO6vsdMJqgp3NggzN3pkaIkvps+8tmGsqB7N7KxRmln9TFnKP3urp56CwnNzRKV8Z9tVBNxYJOnL1jxbVsMjniY=`
 const deviceID = `676741a9-0608-4633-b293-05e49bea6504`
@@ -0,0 +1,65 @@
+package vpn
+
+import (
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/appbricks/mycloudspace-common/monitors"
+)
+
+// exposes the lifecycle of a wireguard session
+// so it can be tested without a tunnel device
+
+type WireguardSession = wireguardSession
+
+func NewWireguardSession(
+	monitorService *monitors.MonitorService,
+	ifaceName string,
+	endpoints []string,
+) *WireguardSession {
+	return newWireguardSession(monitorService, ifaceName, endpoints)
+}
+
+func (s *wireguardSession) ID() string {
+	return s.id
+}
+
+func (s *wireguardSession) Connect(recd, sent int64) {
+	s.connect(recd, sent)
+}
+
+func (s *wireguardSession) Disconnect(reason string, recd, sent int64) {
+	s.disconnect(reason, recd, sent)
+}
+
+func (s *wireguardSession) CheckHandshakes(peers []wgtypes.Peer) {
+	s.checkHandshakes(peers)
+}
+
+// moves the session's start time back so handshakes
+// can go stale without waiting for the timeout
+func (s *wireguardSession) Backdate(d time.Duration) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.startTime = s.startTime.Add(-d)
+}
+
+// exposes the metrics maintained for the peers of a
+// wireguard device so they can be tested without a
+// tunnel device
+
+type WireguardPeerMetrics = wireguardPeerMetrics
+
+func NewWireguardPeerMetrics(monitor *monitors.Monitor) *WireguardPeerMetrics {
+	return newWireguardPeerMetrics(monitor)
+}
+
+func (p *wireguardPeerMetrics) Record(peers []wgtypes.Peer) {
+	p.record(peers)
+}
+
+func (p *wireguardPeerMetrics) Clear() {
+	p.clear()
+}
@@ -1,20 +1,82 @@
 package vpn
 
 import (
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	"github.com/appbricks/mycloudspace-common/monitors"
+
 	"github.com/mevansam/goutils/logger"
 )
 
+// a peer's handshake is considered stale if it has
+// not completed within wireguard's rekey interval of
+// 2 minutes plus the time allowed for rekey attempts
+const staleHandshakeTimeout = 3 * time.Minute
+
+// wireguardSession emits the lifecycle
+// events of a wireguard tunnel session
+type wireguardSession struct {
+	monitorService *monitors.MonitorService
+
+	id        string
+	ifaceName string
+	endpoints []string
+	startTime time.Time
+
+	connected bool
+	// tunnel traffic totals when the session connected
+	// which are subtracted from the totals reported on
+	// disconnect to give the traffic of the session
+	recdAtConnect, sentAtConnect int64
+	// public keys of peers whose
+	// handshake has gone stale
+	staleHandshakes map[string]bool
+
+	mx sync.Mutex
+}
+
+// wireguardPeerMetrics maintains the traffic and
+// handshake metrics of each peer of a tunnel on the
+// tunnel's monitor. metrics are added and removed as
+// peers are added to and removed from the device.
+type wireguardPeerMetrics struct {
+	monitor *monitors.Monitor
+
+	// metrics by peer public key
+	peers map[string]*peerMetricSet
+	// traffic counters of removed peers which are
+	// deleted from the monitor only once the traffic
+	// recorded since they were last collected has
+	// been collected
+	retired map[string]*peerMetricSet
+
+	mx sync.Mutex
+}
+
+type peerMetricSet struct {
+	sent, recd   *monitors.Counter
+	handshakeAge *monitors.Gauge
+
+	// whether the monitor has been collected
+	// since the peer's metrics were retired
+	collected bool
+}
+
 func (w *wireguard) recordNetworkMetrics() (time.Duration, error) {
 
 	var (
 		err error
 		
+		device     *wgtypes.Device
 		sent, recd int64
 	)
 
-	if recd, sent, err = w.wgctrlClient.BytesTransmitted(); err != nil {
+	if device, err = w.wgctrlClient.Device(); err != nil {
 		logger.ErrorMessage(
 			"wireguard.recordNetworkMetrics(): Failed to retrieve wireguard device information: %s", 
 			err.Error(),
@@ -22,6 +84,15 @@ func (w *wireguard) recordNetworkMetrics() (time.Duration, error) {
 		w.metricsError = err
 		
 	} else {
+		w.session.checkHandshakes(device.Peers)
+		w.peerMetrics.record(device.Peers)
+
+		// the tunnel totals are computed from the same
+		// snapshot of the device as the peer metrics
+		for _, peer := range device.Peers {
+			recd += peer.ReceiveBytes
+			sent += peer.TransmitBytes
+		}
 		if recd > 0 {
 			w.recd.Set(recd)
 		}
@@ -37,3 +108,284 @@ func (w *wireguard) recordNetworkMetrics() (time.Duration, error) {
 func (w *wireguard) BytesTransmitted() (int64, int64, error) {
 	return w.recd.Get(), w.sent.Get(), w.metricsError
 }
+
+// records the final traffic of each peer and retires
+// the peer metrics when the tunnel is disconnected
+func (w *wireguard) retirePeerMetrics() {
+	if w.peerMetrics == nil {
+		return
+	}
+	if w.wgctrlClient != nil {
+		if device, err := w.wgctrlClient.Device(); err == nil {
+			w.peerMetrics.record(device.Peers)
+		}
+	}
+	w.peerMetrics.clear()
+}
+
+func newWireguardSession(
+	monitorService *monitors.MonitorService,
+	ifaceName string,
+	endpoints []string,
+) *wireguardSession {
+
+	return &wireguardSession{
+		monitorService: monitorService,
+
+		id:        uuid.NewString(),
+		ifaceName: ifaceName,
+		endpoints: endpoints,
+
+		staleHandshakes: make(map[string]bool),
+	}
+}
+
+// emits the session's connected event. the given
+// tunnel traffic totals are those at the time the
+// session connected.
+func (s *wireguardSession) connect(recd, sent int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.connected = true
+	s.startTime = time.Now()
+	s.recdAtConnect = recd
+	s.sentAtConnect = sent
+
+	s.postEvent(events.VPNConnectedEventType, "VPN Session Connected", &events.VPNSessionData{
+		SessionID: s.id,
+		Interface: s.ifaceName,
+		VPNType:   "wireguard",
+		Endpoints: s.endpoints,
+		StartTime: s.startTime,
+	})
+}
+
+// emits the session's disconnected event if
+// the connected event was emitted previously.
+// the given tunnel traffic totals are reduced
+// by those when the session connected.
+func (s *wireguardSession) disconnect(reason string, recd, sent int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if !s.connected {
+		return
+	}
+	s.connected = false
+	endTime := time.Now()
+
+	s.postEvent(events.VPNDisconnectedEventType, "VPN Session Disconnected", &events.VPNSessionData{
+		SessionID:     s.id,
+		Interface:     s.ifaceName,
+		VPNType:       "wireguard",
+		Endpoints:     s.endpoints,
+		StartTime:     s.startTime,
+		EndTime:       &endTime,
+		BytesSent:     sent - s.sentAtConnect,
+		BytesReceived: recd - s.recdAtConnect,
+		Reason:        reason,
+	})
+}
+
+// emits a handshake-stale event for each peer whose
+// last handshake is older than staleHandshakeTimeout.
+// a peer is flagged only once until it completes a
+// new handshake.
+func (s *wireguardSession) checkHandshakes(peers []wgtypes.Peer) {
+	if s == nil {
+		return
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if !s.connected {
+		return
+	}
+	now := time.Now()
+	for _, peer := range peers {
+		publicKey := peer.PublicKey.String()
+
+		// peers that have not completed their first
+		// handshake are measured from session start
+		since := peer.LastHandshakeTime
+		if since.Before(s.startTime) {
+			since = s.startTime
+		}
+		age := now.Sub(since)
+		if age < staleHandshakeTimeout {
+			delete(s.staleHandshakes, publicKey)
+			continue
+		}
+		if s.staleHandshakes[publicKey] {
+			continue
+		}
+		s.staleHandshakes[publicKey] = true
+
+		logger.WarnMessage(
+			"wireguardSession.checkHandshakes(): Handshake with peer %s on '%s' is stale. Last handshake was %s ago.",
+			publicKey, s.ifaceName, age.String(),
+		)
+		endpoint := ""
+		if peer.Endpoint != nil {
+			endpoint = peer.Endpoint.String()
+		}
+		s.postEvent(events.VPNHandshakeStaleEventType, "VPN Handshake Stale", &events.VPNHandshakeData{
+			SessionID:     s.id,
+			Interface:     s.ifaceName,
+			PeerPublicKey: publicKey,
+			Endpoint:      endpoint,
+			LastHandshake: peer.LastHandshakeTime,
+			HandshakeAge:  int64(age.Seconds()),
+		})
+	}
+}
+
+func newWireguardPeerMetrics(monitor *monitors.Monitor) *wireguardPeerMetrics {
+	p := &wireguardPeerMetrics{
+		monitor: monitor,
+		peers:   make(map[string]*peerMetricSet),
+		retired: make(map[string]*peerMetricSet),
+	}
+	monitor.OnCollect(p.collect)
+	return p
+}
+
+// updates the metrics of the given peers adding metrics
+// for new peers and retiring the metrics of peers that
+// are no longer configured
+func (p *wireguardPeerMetrics) record(peers []wgtypes.Peer) {
+	if p == nil {
+		return
+	}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	now := time.Now()
+	current := make(map[string]bool)
+	for _, peer := range peers {
+		publicKey := peer.PublicKey.String()
+		current[publicKey] = true
+
+		pm, exists := p.peers[publicKey]
+		if !exists {
+			pm, exists = p.retired[publicKey]
+			if exists {
+				// the peer was re-added before its
+				// counters were deleted
+				delete(p.retired, publicKey)
+				pm.collected = false
+				p.monitor.AddGauge(pm.handshakeAge)
+				p.peers[publicKey] = pm
+			}
+		}
+		if !exists {
+			// the endpoint attribute is that of the peer when
+			// it was first seen as it may change if it roams
+			endpoint := ""
+			if peer.Endpoint != nil {
+				endpoint = peer.Endpoint.String()
+			}
+			attribs := func() map[string]string {
+				return map[string]string{
+					"peer":     publicKey,
+					"endpoint": endpoint,
+				}
+			}
+			pm = &peerMetricSet{
+				sent:         monitors.NewCounterWithAttribs("peerSent", true, true, attribs()),
+				recd:         monitors.NewCounterWithAttribs("peerRecd", true, true, attribs()),
+				handshakeAge: monitors.NewGaugeWithAttribs("peerHandshakeAge", attribs()),
+			}
+			p.monitor.AddCounter(pm.sent)
+			p.monitor.AddCounter(pm.recd)
+			p.monitor.AddGauge(pm.handshakeAge)
+			p.peers[publicKey] = pm
+
+			logger.DebugMessage(
+				"wireguardPeerMetrics.record(): Added metrics for peer %s with endpoint '%s'.",
+				publicKey, endpoint,
+			)
+		}
+		pm.sent.Set(peer.TransmitBytes)
+		pm.recd.Set(peer.ReceiveBytes)
+		if !peer.LastHandshakeTime.IsZero() {
+			// seconds since the last handshake
+			pm.handshakeAge.Set(now.Sub(peer.LastHandshakeTime).Seconds())
+		}
+	}
+	for publicKey, pm := range p.peers {
+		if !current[publicKey] {
+			p.retire(publicKey, pm)
+		}
+	}
+}
+
+// retires the metrics of all peers
+func (p *wireguardPeerMetrics) clear() {
+	if p == nil {
+		return
+	}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	for publicKey, pm := range p.peers {
+		p.retire(publicKey, pm)
+	}
+}
+
+// removes the handshake age of a peer that is no longer
+// configured. its traffic counters are retained until
+// the traffic recorded since the monitor was last
+// collected has been collected.
+func (p *wireguardPeerMetrics) retire(publicKey string, pm *peerMetricSet) {
+	p.monitor.DeleteGauge(pm.handshakeAge)
+	delete(p.peers, publicKey)
+	pm.collected = false
+	p.retired[publicKey] = pm
+
+	logger.DebugMessage(
+		"wireguardPeerMetrics.retire(): Retired metrics for peer %s.",
+		publicKey,
+	)
+}
+
+// called before each collection of the monitor to
+// delete the counters of retired peers which were
+// collected by the previous collection
+func (p *wireguardPeerMetrics) collect() {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	for publicKey, pm := range p.retired {
+		if !pm.collected {
+			// the collection that follows includes
+			// the peer's final traffic
+			pm.collected = true
+			continue
+		}
+		p.monitor.DeleteCounter(pm.sent)
+		p.monitor.DeleteCounter(pm.recd)
+		delete(p.retired, publicKey)
+
+		logger.DebugMessage(
+			"wireguardPeerMetrics.collect(): Removed metrics for peer %s.",
+			publicKey,
+		)
+	}
+}
+
+func (s *wireguardSession) postEvent(eventType, subject string, data interface{}) {
+	if s.monitorService == nil {
+		return
+	}
+	event, err := events.NewLifecycleEvent(eventType, subject, data)
+	if err != nil {
+		logger.ErrorMessage(
+			"wireguardSession.postEvent(): Unable to create '%s' event for session %s: %s",
+			eventType, s.id, err.Error(),
+		)
+		return
+	}
+	s.monitorService.PostEvent(event)
+}
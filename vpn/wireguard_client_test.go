@@ -3,16 +3,25 @@ package vpn_test
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"regexp"
+	"sync"
 	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
 
 	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"github.com/appbricks/mycloudspace-common/events"
+	"github.com/appbricks/mycloudspace-common/monitors"
 	"github.com/appbricks/mycloudspace-common/vpn"
 	"github.com/mevansam/goutils/logger"
 	"github.com/mevansam/goutils/network"
@@ -135,6 +144,279 @@ var _ = Describe("Wireguard Client", func() {
 	})
 })
 
+var _ = Describe("Wireguard Session", func() {
+
+	var (
+		bus  *events.Bus
+		sub  *events.Subscription
+		msvc *monitors.MonitorService
+	)
+
+	BeforeEach(func() {
+		bus = events.NewBus(0)
+		sub = bus.Subscribe("io.appbricks.mycs.vpn.*", 10, events.DropNewest)
+
+		msvc = monitors.NewMonitorService(nil, 1, 100)
+		msvc.SetEventBus(bus)
+	})
+
+	AfterEach(func() {
+		bus.Close()
+	})
+
+	It("posts connected and disconnected events for a session", func() {
+
+		session := vpn.NewWireguardSession(msvc, "utun9", []string{"34.204.21.102:3399"})
+
+		// a session that never connected
+		// is not reported as disconnected
+		session.Disconnect("device closed", 0, 0)
+		Consistently(sub.Events(), 50*time.Millisecond).ShouldNot(Receive())
+
+		session.Connect(0, 0)
+		connected := events.VPNSessionData{}
+		receiveVPNEvent(sub, events.VPNConnectedEventType, &connected)
+		Expect(connected.SessionID).To(Equal(session.ID()))
+		Expect(connected.Interface).To(Equal("utun9"))
+		Expect(connected.VPNType).To(Equal("wireguard"))
+		Expect(connected.Endpoints).To(Equal([]string{"34.204.21.102:3399"}))
+		Expect(connected.EndTime).To(BeNil())
+
+		session.Disconnect("disconnected by client", 2048, 1024)
+		disconnected := events.VPNSessionData{}
+		receiveVPNEvent(sub, events.VPNDisconnectedEventType, &disconnected)
+		Expect(disconnected.SessionID).To(Equal(session.ID()))
+		Expect(disconnected.StartTime.Equal(connected.StartTime)).To(BeTrue())
+		Expect(disconnected.EndTime).NotTo(BeNil())
+		Expect(disconnected.EndTime.Before(disconnected.StartTime)).To(BeFalse())
+		Expect(disconnected.BytesReceived).To(Equal(int64(2048)))
+		Expect(disconnected.BytesSent).To(Equal(int64(1024)))
+		Expect(disconnected.Reason).To(Equal("disconnected by client"))
+
+		// the session is only reported
+		// as disconnected once
+		session.Disconnect("device closed", 2048, 1024)
+		Consistently(sub.Events(), 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("reports the traffic of a session since it connected", func() {
+
+		session := vpn.NewWireguardSession(msvc, "utun9", []string{"34.204.21.102:3399"})
+
+		// totals include the traffic of earlier
+		// sessions of the same client
+		session.Connect(4096, 512)
+		receiveVPNEvent(sub, events.VPNConnectedEventType, &events.VPNSessionData{})
+
+		session.Disconnect("device closed", 6144, 1536)
+		disconnected := events.VPNSessionData{}
+		receiveVPNEvent(sub, events.VPNDisconnectedEventType, &disconnected)
+		Expect(disconnected.BytesReceived).To(Equal(int64(2048)))
+		Expect(disconnected.BytesSent).To(Equal(int64(1024)))
+	})
+
+	It("posts a handshake stale event once per stale handshake while connected", func() {
+
+		privateKey, err := wgtypes.GeneratePrivateKey()
+		Expect(err).NotTo(HaveOccurred())
+		peer := wgtypes.Peer{
+			PublicKey: privateKey.PublicKey(),
+			Endpoint:  &net.UDPAddr{IP: net.ParseIP("34.204.21.102"), Port: 3399},
+		}
+
+		session := vpn.NewWireguardSession(msvc, "utun9", []string{"34.204.21.102:3399"})
+		session.Connect(0, 0)
+		receiveVPNEvent(sub, events.VPNConnectedEventType, &events.VPNSessionData{})
+
+		// peers without a handshake are measured
+		// from the start of the session
+		session.CheckHandshakes([]wgtypes.Peer{peer})
+		Consistently(sub.Events(), 50*time.Millisecond).ShouldNot(Receive())
+
+		session.Backdate(5 * time.Minute)
+		session.CheckHandshakes([]wgtypes.Peer{peer})
+		stale := events.VPNHandshakeData{}
+		receiveVPNEvent(sub, events.VPNHandshakeStaleEventType, &stale)
+		Expect(stale.SessionID).To(Equal(session.ID()))
+		Expect(stale.PeerPublicKey).To(Equal(peer.PublicKey.String()))
+		Expect(stale.Endpoint).To(Equal("34.204.21.102:3399"))
+		Expect(stale.LastHandshake.IsZero()).To(BeTrue())
+		Expect(stale.HandshakeAge).To(BeNumerically(">=", 300))
+
+		session.CheckHandshakes([]wgtypes.Peer{peer})
+		Consistently(sub.Events(), 50*time.Millisecond).ShouldNot(Receive())
+
+		// a new handshake resets the stale state
+		peer.LastHandshakeTime = time.Now()
+		session.CheckHandshakes([]wgtypes.Peer{peer})
+		Consistently(sub.Events(), 50*time.Millisecond).ShouldNot(Receive())
+
+		peer.LastHandshakeTime = time.Now().Add(-4 * time.Minute)
+		session.CheckHandshakes([]wgtypes.Peer{peer})
+		receiveVPNEvent(sub, events.VPNHandshakeStaleEventType, &stale)
+		Expect(stale.HandshakeAge).To(BeNumerically(">=", 240))
+
+		// handshakes are not checked once disconnected
+		session.Disconnect("device closed", 0, 0)
+		receiveVPNEvent(sub, events.VPNDisconnectedEventType, &events.VPNSessionData{})
+		peer.LastHandshakeTime = time.Time{}
+		session.CheckHandshakes([]wgtypes.Peer{peer})
+		Consistently(sub.Events(), 50*time.Millisecond).ShouldNot(Receive())
+	})
+})
+
+var _ = Describe("Wireguard Peer Metrics", func() {
+
+	var (
+		rs      *recordingSender
+		msvc    *monitors.MonitorService
+		metrics *vpn.WireguardPeerMetrics
+
+		peerA, peerB wgtypes.Peer
+	)
+
+	newPeer := func() wgtypes.Peer {
+		privateKey, err := wgtypes.GeneratePrivateKey()
+		Expect(err).NotTo(HaveOccurred())
+		return wgtypes.Peer{
+			PublicKey:         privateKey.PublicKey(),
+			LastHandshakeTime: time.Now(),
+		}
+	}
+
+	// returns the peer traffic counters of the
+	// snapshot collected when the service stops
+	collect := func() map[string]int64 {
+		numEvents := len(rs.events)
+		msvc.Stop()
+		Expect(len(rs.events)).To(BeNumerically("<=", numEvents+1))
+
+		counters := map[string]int64{}
+		if len(rs.events) == numEvents {
+			return counters
+		}
+		data := struct {
+			Monitors []struct {
+				Counters []struct {
+					Name    string            `json:"name"`
+					Value   int64             `json:"value"`
+					Attribs map[string]string `json:"attribs"`
+				} `json:"counters"`
+			} `json:"monitors"`
+		}{}
+		err := json.Unmarshal(rs.events[numEvents].Data(), &data)
+		Expect(err).NotTo(HaveOccurred())
+		for _, m := range data.Monitors {
+			for _, c := range m.Counters {
+				counters[c.Attribs["peer"]+"/"+c.Name] = c.Value
+			}
+		}
+		return counters
+	}
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		monitors.NewPrometheusHandler(msvc, "").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return recorder.Body.String()
+	}
+
+	BeforeEach(func() {
+		rs = &recordingSender{}
+		msvc = monitors.NewMonitorService(rs, 1, 100)
+		metrics = vpn.NewWireguardPeerMetrics(msvc.NewMonitor("space-vpn"))
+
+		peerA = newPeer()
+		peerB = newPeer()
+	})
+
+	It("records the traffic of peers as they are added", func() {
+
+		peerA.TransmitBytes, peerA.ReceiveBytes = 100, 200
+		metrics.Record([]wgtypes.Peer{peerA})
+		Expect(collect()).To(Equal(map[string]int64{
+			peerA.PublicKey.String() + "/peerSent": 100,
+			peerA.PublicKey.String() + "/peerRecd": 200,
+		}))
+
+		peerA.TransmitBytes = 150
+		peerB.TransmitBytes, peerB.ReceiveBytes = 10, 20
+		metrics.Record([]wgtypes.Peer{peerA, peerB})
+		Expect(collect()).To(Equal(map[string]int64{
+			peerA.PublicKey.String() + "/peerSent": 50,
+			peerB.PublicKey.String() + "/peerSent": 10,
+			peerB.PublicKey.String() + "/peerRecd": 20,
+		}))
+		Expect(scrape()).To(ContainSubstring(`peerHandshakeAge{endpoint="",peer="` + peerB.PublicKey.String() + `"}`))
+	})
+
+	It("collects the final traffic of removed peers before removing their metrics", func() {
+
+		peerA.TransmitBytes = 100
+		peerB.TransmitBytes = 50
+		metrics.Record([]wgtypes.Peer{peerA, peerB})
+		collect()
+
+		// traffic recorded since the last collection
+		// is collected after the peer is removed
+		peerA.TransmitBytes = 150
+		peerB.TransmitBytes = 80
+		metrics.Record([]wgtypes.Peer{peerA, peerB})
+		metrics.Record([]wgtypes.Peer{peerA})
+		Expect(scrape()).NotTo(ContainSubstring(`peerHandshakeAge{endpoint="",peer="` + peerB.PublicKey.String() + `"}`))
+		Expect(collect()).To(Equal(map[string]int64{
+			peerA.PublicKey.String() + "/peerSent": 50,
+			peerB.PublicKey.String() + "/peerSent": 30,
+		}))
+		Expect(scrape()).To(ContainSubstring(`peer="` + peerB.PublicKey.String() + `"`))
+
+		// the removed peer's counters are deleted
+		// with the next collection
+		peerA.TransmitBytes = 160
+		metrics.Record([]wgtypes.Peer{peerA})
+		Expect(collect()).To(Equal(map[string]int64{
+			peerA.PublicKey.String() + "/peerSent": 10,
+		}))
+		Expect(scrape()).NotTo(ContainSubstring(`peer="` + peerB.PublicKey.String() + `"`))
+
+		// a peer that is added again starts new counters
+		peerB.TransmitBytes = 5
+		metrics.Record([]wgtypes.Peer{peerA, peerB})
+		Expect(collect()).To(Equal(map[string]int64{
+			peerB.PublicKey.String() + "/peerSent": 5,
+		}))
+	})
+
+	It("collects the final traffic of all peers when the tunnel disconnects", func() {
+
+		peerA.TransmitBytes = 100
+		peerB.ReceiveBytes = 100
+		metrics.Record([]wgtypes.Peer{peerA, peerB})
+		collect()
+
+		peerA.TransmitBytes = 120
+		peerB.ReceiveBytes = 130
+		metrics.Record([]wgtypes.Peer{peerA, peerB})
+		metrics.Clear()
+		Expect(collect()).To(Equal(map[string]int64{
+			peerA.PublicKey.String() + "/peerSent": 20,
+			peerB.PublicKey.String() + "/peerRecd": 30,
+		}))
+
+		Expect(collect()).To(BeEmpty())
+		Expect(scrape()).NotTo(ContainSubstring("peer="))
+	})
+})
+
+func receiveVPNEvent(sub *events.Subscription, eventType string, data interface{}) {
+	select {
+	case event := <-sub.Events():
+		Expect(event.Type()).To(Equal(eventType))
+		Expect(event.DataAs(data)).To(Succeed())
+	case <-time.After(time.Second):
+		Fail("timed out waiting for vpn event")
+	}
+}
+
 func checkDevExists(ifaceName string) bool {
 	ifaces, err := net.Interfaces()
 	Expect(err).NotTo(HaveOccurred())
@@ -156,4 +438,16 @@ peer: AnTKCPYQCkNACBUsB2otfk+V/D3ZiBpNaQJHsSw0hEo=
   allowed ips: 0.0.0.0/0
   latest handshake: 0001-01-01 00:00:00 +0000 UTC
   transfer: 0 B received, 148 B sent
-`
\ No newline at end of file
+`
+
+type recordingSender struct {
+	events []*cloudevents.Event
+	mx     sync.Mutex
+}
+
+func (s *recordingSender) PostMeasurementEvents(cloudEvents []*cloudevents.Event) ([]events.CloudEventError, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.events = append(s.events, cloudEvents...)
+	return []events.CloudEventError{}, nil
+}
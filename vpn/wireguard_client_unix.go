@@ -40,6 +40,13 @@ type wireguard struct {
 	// bytes sent and received through the tunnel
 	sent, recd *monitors.Counter
 
+	// emits tunnel lifecycle events
+	// via the monitor service
+	monitorService *monitors.MonitorService
+	session        *wireguardSession
+	// per peer metrics of the tunnel
+	peerMetrics *wireguardPeerMetrics
+
 	metricsTimer *utils.ExecTimer
 	metricsError error
 }
@@ -62,6 +69,8 @@ func newWireguardClient(cfg *wireguardConfig, monitorService *monitors.MonitorSe
 
 		close:        make(chan bool),
 		disconnected: make(chan bool),
+
+		monitorService: monitorService,
 	}
 
 	w.sent = monitors.NewCounter("sent", true, true)
@@ -72,6 +81,11 @@ func newWireguardClient(cfg *wireguardConfig, monitorService *monitors.MonitorSe
 		monitor := monitorService.NewMonitor("space-vpn")
 		monitor.AddCounter(w.sent)
 		monitor.AddCounter(w.recd)	
+		// live throughput in bytes/sec
+		monitor.AddDerivedMetric(monitors.NewRateMetric("sentRate", w.sent))
+		monitor.AddDerivedMetric(monitors.NewRateMetric("recdRate", w.recd))
+
+		w.peerMetrics = newWireguardPeerMetrics(monitor)
 	}
 
 	return w, nil
@@ -145,11 +159,14 @@ func (w *wireguard) Connect() error {
 	if w.wgctrlClient, err = NewWireguardCtrlClient(w.ifaceName); err != nil {
 		return err
 	}
+	w.session = newWireguardSession(w.monitorService, w.ifaceName, w.cfg.peerAddresses)
 	
 	// handle termination of services
 	go func() {
 		var (
 			err error
+
+			reason string
 		)
 
 		// stop recieving interrupt
@@ -161,9 +178,13 @@ func (w *wireguard) Connect() error {
 
 		select {
 			case <-w.close:
+				reason = "disconnected by client"
 			case <-w.device.Wait():
+				reason = "device closed"
 		}		
 		deviceLogger.Verbosef("Shutting down wireguard tunnel")
+		w.session.disconnect(reason, w.recd.Get(), w.sent.Get())
+		w.retirePeerMetrics()
 
 		if err = w.wgctrlService.Stop(); err != nil {
 			logger.DebugMessage("wireguard.Connect(): Error closing UAPI socket: %s", err.Error())
@@ -219,6 +240,7 @@ func (w *wireguard) Connect() error {
 			err.Error(),
 		)
 	}
+	w.session.connect(w.recd.Get(), w.sent.Get())
 
 	return nil
 }
@@ -27,6 +27,13 @@ type wireguard struct {
 	// bytes sent and received through the tunnel
 	sent, recd *monitors.Counter
 
+	// emits tunnel lifecycle events
+	// via the monitor service
+	monitorService *monitors.MonitorService
+	session        *wireguardSession
+	// per peer metrics of the tunnel
+	peerMetrics *wireguardPeerMetrics
+
 	metricsTimer *utils.ExecTimer
 	metricsError error
 }
@@ -79,6 +86,8 @@ func newWireguardClient(cfg *wireguardConfig, monitorService *monitors.MonitorSe
 		cfg:            cfg,
 		tunnelName:     cfg.configFileName[:strings.LastIndex(cfg.configFileName, ".")],
 		configFilePath: filepath.Join(os.TempDir(), cfg.configFileName),
+
+		monitorService: monitorService,
 	}
 
 	w.sent = monitors.NewCounter("sent", true, true)
@@ -89,6 +98,11 @@ func newWireguardClient(cfg *wireguardConfig, monitorService *monitors.MonitorSe
 		monitor := monitorService.NewMonitor("space-vpn")
 		monitor.AddCounter(w.sent)
 		monitor.AddCounter(w.recd)	
+		// live throughput in bytes/sec
+		monitor.AddDerivedMetric(monitors.NewRateMetric("sentRate", w.sent))
+		monitor.AddDerivedMetric(monitors.NewRateMetric("recdRate", w.recd))
+
+		w.peerMetrics = newWireguardPeerMetrics(monitor)
 	}
 
 	return w, nil
@@ -125,6 +139,7 @@ func (w *wireguard) Connect() error {
 	if w.wgctrlClient, err = NewWireguardCtrlClient(w.tunnelName); err != nil {
 		return err
 	}
+	w.session = newWireguardSession(w.monitorService, w.tunnelName, w.cfg.peerAddresses)
 
 	// start background thread to record tunnel metrics
 	w.metricsTimer = utils.NewExecTimer(context.Background(), w.recordNetworkMetrics, false)
@@ -134,6 +149,7 @@ func (w *wireguard) Connect() error {
 			err.Error(),
 		)
 	}	
+	w.session.connect(w.recd.Get(), w.sent.Get())
 	return nil
 }
 
@@ -141,6 +157,10 @@ func (w *wireguard) Disconnect() error {
 	if w.metricsTimer != nil {
 		_ = w.metricsTimer.Stop()
 	}
+	if w.session != nil {
+		w.session.disconnect("disconnected by client", w.recd.Get(), w.sent.Get())
+	}
+	w.retirePeerMetrics()
 
 	if err := wireguardEXE.Run([]string{ "/uninstalltunnelservice", w.tunnelName }); err != nil {		
 		logger.ErrorMessage(